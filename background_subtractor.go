@@ -0,0 +1,238 @@
+//go:build cgo
+// +build cgo
+
+package opencv
+
+import (
+	"fmt"
+	"gopkg.in/sensorbee/opencv.v0/bridge"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"strings"
+	"sync"
+)
+
+var (
+	algorithmPath     = data.MustCompilePath("algorithm")
+	historyPath       = data.MustCompilePath("history")
+	thresholdPath     = data.MustCompilePath("threshold")
+	detectShadowsPath = data.MustCompilePath("detect_shadows")
+	learningRatePath  = data.MustCompilePath("learning_rate")
+	minAreaPath       = data.MustCompilePath("min_area")
+)
+
+// defaultBackgroundThresholds are default thresholds of each algorithm, which
+// are same as OpenCV's default values.
+var defaultBackgroundThresholds = map[string]float64{
+	"mog2": 16,
+	"knn":  400,
+}
+
+// NewBackgroundSubtractor returns backgroundSubtractor state, which has a
+// background model updated by each frame.
+//
+// algorithm: "mog2" (Gaussian mixture, cv::BackgroundSubtractorMOG2) or "knn"
+// (K-nearest neighbours, cv::BackgroundSubtractorKNN). Default is "mog2".
+//
+// history: The number of last frames which affect the background model.
+// Default is 500.
+//
+// threshold: A threshold of the distance between a pixel and the model to be
+// background. It is the squared Mahalanobis distance for "mog2" (default 16),
+// and the squared distance to samples for "knn" (default 400).
+//
+// detect_shadows: If set `true` then shadows are detected and marked as 127 in
+// the foreground mask, they are not foreground. Default is true.
+//
+// learning_rate: How fast the model is updated, from 0 (not updated) to 1
+// (reinitialized by each frame). A negative value chooses it automatically
+// from history. Default is -1.
+//
+// min_area: Foreground regions whose area is less than it are not returned as
+// rectangles. Default is 0.
+func NewBackgroundSubtractor(ctx *core.Context, params data.Map) (
+	core.SharedState, error) {
+	algorithm := "mog2"
+	if v, err := params.Get(algorithmPath); err == nil {
+		if algorithm, err = data.AsString(v); err != nil {
+			return nil, err
+		}
+		algorithm = strings.ToLower(algorithm)
+	}
+	threshold, ok := defaultBackgroundThresholds[algorithm]
+	if !ok {
+		return nil, fmt.Errorf("'%v' algorithm is not supported", algorithm)
+	}
+	if v, err := params.Get(thresholdPath); err == nil {
+		if threshold, err = data.ToFloat(v); err != nil {
+			return nil, err
+		}
+		if threshold <= 0 {
+			return nil, fmt.Errorf("threshold must be positive: %v", threshold)
+		}
+	}
+
+	history := int64(500)
+	if v, err := params.Get(historyPath); err == nil {
+		if history, err = data.AsInt(v); err != nil {
+			return nil, err
+		}
+		if history < 1 {
+			return nil, fmt.Errorf("history must be positive: %v", history)
+		}
+	}
+	detectShadows := true
+	if v, err := params.Get(detectShadowsPath); err == nil {
+		if detectShadows, err = data.AsBool(v); err != nil {
+			return nil, err
+		}
+	}
+	learningRate := -1.0
+	if v, err := params.Get(learningRatePath); err == nil {
+		if learningRate, err = data.ToFloat(v); err != nil {
+			return nil, err
+		}
+		if learningRate > 1 {
+			return nil, fmt.Errorf("learning_rate must not be greater than 1: %v",
+				learningRate)
+		}
+	}
+	minArea, err := parseMinArea(params)
+	if err != nil {
+		return nil, err
+	}
+
+	var bs bridge.BackgroundSubtractor
+	if algorithm == "knn" {
+		bs, err = bridge.NewBackgroundSubtractorKNN(int(history), threshold,
+			detectShadows)
+	} else {
+		bs, err = bridge.NewBackgroundSubtractorMOG2(int(history), threshold,
+			detectShadows)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &backgroundSubtractor{
+		bs:           bs,
+		learningRate: learningRate,
+		minArea:      minArea,
+	}, nil
+}
+
+// parseMinArea returns "min_area" parameter, which is 0 when it is not set.
+func parseMinArea(params data.Map) (float64, error) {
+	v, err := params.Get(minAreaPath)
+	if err != nil {
+		return 0, nil
+	}
+	minArea, err := data.ToFloat(v)
+	if err != nil {
+		return 0, err
+	}
+	if minArea < 0 {
+		return 0, fmt.Errorf("min_area must not be negative: %v", minArea)
+	}
+	return minArea, nil
+}
+
+// backgroundSubtractor has a background model. The model is updated by each
+// frame in order, so calls are serialized by the mutex.
+type backgroundSubtractor struct {
+	m            sync.Mutex
+	bs           bridge.BackgroundSubtractor
+	learningRate float64
+	minArea      float64
+}
+
+// Terminate the background model.
+func (b *backgroundSubtractor) Terminate(ctx *core.Context) error {
+	b.m.Lock()
+	defer b.m.Unlock()
+	b.bs.Delete()
+	return nil
+}
+
+func lookupBackgroundSubtractor(ctx *core.Context, name string) (
+	*backgroundSubtractor, error) {
+	st, err := ctx.SharedStates.Get(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if s, ok := st.(*backgroundSubtractor); ok {
+		return s, nil
+	}
+	return nil, fmt.Errorf(
+		"state '%v' cannot be converted to background_subtractor.state", name)
+}
+
+// SubtractBackground updates the background model with the frame and returns
+// foreground of it.
+//
+// subtractorName: backgroundSubtractor state name.
+//
+// img: a frame as RawData map structure. Frames of a state are required to
+// have the same size, the model is reinitialized when the size is changed.
+//
+// Returns a map which has "mask", "rects" and "ratio". "mask" is a "cvmat1b"
+// RawData map of the same size as the frame, 255 is foreground, 127 is shadow
+// and 0 is background. It can be used as "mask" parameter of
+// DetectMultiScale. "rects" is an array of bounding rectangles of foreground
+// regions, and "ratio" is the ratio of foreground pixels in the frame.
+func SubtractBackground(ctx *core.Context, subtractorName string,
+	img data.Map) (data.Map, error) {
+	b, err := lookupBackgroundSubtractor(ctx, subtractorName)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := ConvertMapToRawData(img)
+	if err != nil {
+		return nil, err
+	}
+	mat, err := defaultMatVec3bPool.get(&raw)
+	if err != nil {
+		return nil, err
+	}
+	defer defaultMatVec3bPool.put(mat)
+
+	mask, err := b.apply(mat)
+	if err != nil {
+		return nil, err
+	}
+	defer mask.Delete()
+	rects, maskRaw, err := foregroundRegions(mask, b.minArea)
+	if err != nil {
+		return nil, err
+	}
+	return data.Map{
+		"mask":  maskRaw.ConvertToDataMap(),
+		"rects": rects,
+		"ratio": data.Float(maskRaw.foregroundRatio()),
+	}, nil
+}
+
+func (b *backgroundSubtractor) apply(mat bridge.MatVec3b) (bridge.Mat, error) {
+	b.m.Lock()
+	defer b.m.Unlock()
+	return b.bs.Apply(mat, b.learningRate)
+}
+
+// foregroundRegions returns bounding rectangles of foreground regions whose
+// area is not less than minArea, and RawData of the mask.
+func foregroundRegions(mask bridge.Mat, minArea float64) (data.Array, RawData,
+	error) {
+	rects, err := bridge.ForegroundRects(mask, minArea)
+	if err != nil {
+		return nil, RawData{}, err
+	}
+	ret := make(data.Array, len(rects))
+	for i, r := range rects {
+		ret[i] = convertFromBridgeRect(r)
+	}
+	raw, err := MatToRawData(mask)
+	if err != nil {
+		return nil, RawData{}, err
+	}
+	return ret, raw, nil
+}
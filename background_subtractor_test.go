@@ -0,0 +1,114 @@
+//go:build cgo
+// +build cgo
+
+package opencv
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"testing"
+)
+
+// filledCVMAT returns a "cvmat" RawData map whose pixels are all the value.
+func filledCVMAT(width, height int, value byte) data.Map {
+	b := make([]byte, width*height*3)
+	for i := range b {
+		b[i] = value
+	}
+	return data.Map{
+		"format": data.String("cvmat"),
+		"width":  data.Int(width),
+		"height": data.Int(height),
+		"image":  data.Blob(b),
+	}
+}
+
+func TestNewBackgroundSubtractor(t *testing.T) {
+	Convey("Given a SensorBee's core.Context", t, func() {
+		ctx := &core.Context{}
+		Convey("When create state with each algorithm", func() {
+			for _, a := range []string{"mog2", "KNN"} {
+				st, err := NewBackgroundSubtractor(ctx, data.Map{
+					"algorithm": data.String(a),
+					"history":   data.Int(100),
+				})
+				Convey("Then state should be created: "+a, func() {
+					So(err, ShouldBeNil)
+					So(st.Terminate(ctx), ShouldBeNil)
+				})
+			}
+		})
+		Convey("When create state with invalid parameters", func() {
+			cases := map[string]data.Map{
+				"unsupported algorithm": {"algorithm": data.String("gmg")},
+				"zero history":          {"history": data.Int(0)},
+				"negative threshold":    {"threshold": data.Float(-1)},
+				"invalid detect_shadow": {"detect_shadows": data.Int(1)},
+				"large learning_rate":   {"learning_rate": data.Float(1.5)},
+				"negative min_area":     {"min_area": data.Int(-1)},
+			}
+			for name, params := range cases {
+				Convey("Then it should return an error: "+name, func() {
+					_, err := NewBackgroundSubtractor(ctx, params)
+					So(err, ShouldNotBeNil)
+				})
+			}
+		})
+	})
+}
+
+func TestSubtractBackground(t *testing.T) {
+	Convey("Given a background subtractor which learned a black background", t, func() {
+		ctx := core.NewContext(nil)
+		st, err := NewBackgroundSubtractor(ctx, data.Map{})
+		So(err, ShouldBeNil)
+		So(ctx.SharedStates.Add("bg", "opencv_background_subtractor", st),
+			ShouldBeNil)
+		Reset(func() {
+			st.Terminate(ctx)
+		})
+		black := filledCVMAT(4, 4, 0)
+		for i := 0; i < 10; i++ {
+			_, err := SubtractBackground(ctx, "bg", black)
+			So(err, ShouldBeNil)
+		}
+
+		Convey("When apply the background frame", func() {
+			fg, err := SubtractBackground(ctx, "bg", black)
+			Convey("Then it should have no foreground", func() {
+				So(err, ShouldBeNil)
+				So(fg["ratio"], ShouldEqual, data.Float(0))
+				So(fg["rects"], ShouldResemble, data.Array{})
+			})
+			Convey("Then the mask should be a gray image of the frame size", func() {
+				m, err := data.AsMap(fg["mask"])
+				So(err, ShouldBeNil)
+				mask, err := ConvertMapToRawData(m)
+				So(err, ShouldBeNil)
+				So(mask.Format, ShouldEqual, TypeCVMAT1b)
+				So(mask.Width, ShouldEqual, 4)
+				So(mask.Height, ShouldEqual, 4)
+			})
+		})
+		Convey("When apply a white frame", func() {
+			fg, err := SubtractBackground(ctx, "bg", filledCVMAT(4, 4, 255))
+			Convey("Then the whole frame should be foreground", func() {
+				So(err, ShouldBeNil)
+				So(fg["ratio"], ShouldEqual, data.Float(1))
+				So(fg["rects"], ShouldResemble, data.Array{data.Map{
+					"x":      data.Int(0),
+					"y":      data.Int(0),
+					"width":  data.Int(4),
+					"height": data.Int(4),
+				}})
+			})
+		})
+		Convey("When apply with a state which is not a background subtractor", func() {
+			_, err := SubtractBackground(ctx, "not_exist", black)
+			Convey("Then it should return an error", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
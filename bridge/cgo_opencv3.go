@@ -0,0 +1,12 @@
+//go:build !opencv4
+// +build !opencv4
+
+package bridge
+
+// OpenCV 3.x is linked by default, build with "opencv4" tag to use OpenCV 4.x.
+
+/*
+#cgo linux pkg-config: opencv
+#cgo darwin pkg-config: opencv
+*/
+import "C"
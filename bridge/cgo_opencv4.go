@@ -0,0 +1,13 @@
+//go:build opencv4
+// +build opencv4
+
+package bridge
+
+// OpenCV 4.x is linked when built with "opencv4" tag, e.g.
+// `go build -tags opencv4`. OpenCV 4.x requires C++11.
+
+/*
+#cgo pkg-config: opencv4
+#cgo CXXFLAGS: -std=c++11
+*/
+import "C"
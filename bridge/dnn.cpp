@@ -0,0 +1,97 @@
+#include "dnn.h"
+
+#include <string.h>
+
+#ifdef BRIDGE_HAS_DNN
+// outputNames returns names of unconnected output layers, which are outputs
+// of the whole network.
+static std::vector<cv::String> outputNames(cv::dnn::Net& n) {
+  std::vector<cv::String> layers = n.getLayerNames();
+  std::vector<int> outs = n.getUnconnectedOutLayers();
+  std::vector<cv::String> names;
+  for (size_t i = 0; i < outs.size(); ++i) {
+    // layer ids start from 1, 0 is the input layer
+    names.push_back(layers[outs[i] - 1]);
+  }
+  return names;
+}
+#endif
+
+Net Net_ReadNet(const char* model, const char* config, const char* framework,
+    struct Error* err) {
+  BRIDGE_TRY
+#ifdef BRIDGE_HAS_DNN
+    cv::dnn::Net net = cv::dnn::readNet(model, config, framework);
+    if (net.empty()) {
+      Error_Set(err, "the model has no layer");
+      return NULL;
+    }
+    return new cv::dnn::Net(net);
+#else
+    Error_Set(err, "dnn requires OpenCV 3.4 or later");
+#endif
+  BRIDGE_CATCH(err)
+  return NULL;
+}
+
+void Net_Delete(Net n) {
+#ifdef BRIDGE_HAS_DNN
+  delete n;
+#endif
+}
+
+struct Tensors Net_Forward(Net n, MatVec3b img, struct BlobParams params,
+    struct Error* err) {
+  BRIDGE_TRY
+#ifdef BRIDGE_HAS_DNN
+    cv::Size size(params.width, params.height);
+    if (size.width == 0 || size.height == 0) {
+      size = img->size();
+    }
+    cv::Mat blob = cv::dnn::blobFromImage(*img, params.scale, size,
+      cv::Scalar(params.mean[0], params.mean[1], params.mean[2]),
+      params.swapRB != 0, params.crop != 0);
+    n->setInput(blob);
+    std::vector<cv::String> names = outputNames(*n);
+    std::vector<cv::Mat> outs;
+    n->forward(outs, names);
+
+    int length = outs.size();
+    Tensors ret = {new Tensor[length], length};
+    for (int i = 0; i < length; ++i) {
+      cv::Mat out = outs[i];
+      if (out.depth() != CV_32F) {
+        out.convertTo(out, CV_32F);
+      }
+      if (!out.isContinuous()) {
+        out = out.clone();
+      }
+      Tensor t;
+      t.name = toByteArray(names[i].c_str(), names[i].size());
+      t.dims = out.dims;
+      t.shape = new int[out.dims];
+      for (int d = 0; d < out.dims; ++d) {
+        t.shape[d] = out.size[d];
+      }
+      t.length = out.total() * out.channels();
+      t.data = new float[t.length];
+      memcpy(t.data, out.ptr<float>(), t.length * sizeof(float));
+      ret.tensors[i] = t;
+    }
+    return ret;
+#else
+    Error_Set(err, "dnn requires OpenCV 3.4 or later");
+#endif
+  BRIDGE_CATCH(err)
+  Tensors empty = {NULL, 0};
+  return empty;
+}
+
+void Tensors_Delete(struct Tensors ts) {
+  for (int i = 0; i < ts.length; ++i) {
+    ByteArray_Release(ts.tensors[i].name);
+    delete[] ts.tensors[i].shape;
+    delete[] ts.tensors[i].data;
+  }
+  delete[] ts.tensors;
+}
@@ -0,0 +1,104 @@
+package bridge
+
+/*
+#include <stdlib.h>
+#include "dnn.h"
+*/
+import "C"
+import (
+	"reflect"
+	"unsafe"
+)
+
+// Net is a bind of `cv::dnn::Net`, which requires OpenCV 3.4 or later.
+type Net struct {
+	p C.Net
+}
+
+// ReadNet reads a network model by `cv::dnn::readNet`. The framework is
+// detected from the file extension of model, e.g. ".onnx", ".caffemodel" or
+// ".pb". config is a text file of the network, which is required by some
+// frameworks, and can be empty. framework is an explicit name of the
+// framework and can be empty.
+func ReadNet(model string, config string, framework string) (Net, error) {
+	cModel := C.CString(model)
+	defer C.free(unsafe.Pointer(cModel))
+	cConfig := C.CString(config)
+	defer C.free(unsafe.Pointer(cConfig))
+	cFramework := C.CString(framework)
+	defer C.free(unsafe.Pointer(cFramework))
+
+	var cErr C.struct_Error
+	p := C.Net_ReadNet(cModel, cConfig, cFramework, &cErr)
+	if err := toGoError(cErr); err != nil {
+		return Net{}, err
+	}
+	return Net{p: p}, nil
+}
+
+// Delete Net's pointer.
+func (n *Net) Delete() {
+	C.Net_Delete(n.p)
+	n.p = nil
+}
+
+// BlobParams is parameters of `cv::dnn::blobFromImage` to make an input blob
+// of the network from an image. Zero Width or Height means the size of the
+// image. Mean is subtracted from each channel before Scale is multiplied.
+type BlobParams struct {
+	Width  int
+	Height int
+	Scale  float64
+	Mean   [3]float64
+	SwapRB bool
+	Crop   bool
+}
+
+// NewBlobParams returns parameters which does not change pixel values.
+func NewBlobParams() BlobParams {
+	return BlobParams{
+		Scale: 1.0,
+	}
+}
+
+func (p *BlobParams) toC() C.struct_BlobParams {
+	return C.struct_BlobParams{
+		width:  C.int(p.Width),
+		height: C.int(p.Height),
+		scale:  C.double(p.Scale),
+		mean: [3]C.double{C.double(p.Mean[0]), C.double(p.Mean[1]),
+			C.double(p.Mean[2])},
+		swapRB: C.int(boolToInt(p.SwapRB)),
+		crop:   C.int(boolToInt(p.Crop)),
+	}
+}
+
+// Forward makes an input blob from the image and runs forward pass of the
+// network. Returns outputs of all unconnected output layers. A Net is not
+// thread-safe, it must not be used by multiple goroutines concurrently.
+func (n *Net) Forward(img MatVec3b, params BlobParams) ([]Tensor, error) {
+	var cErr C.struct_Error
+	ret := C.Net_Forward(n.p, img.p, params.toC(), &cErr)
+	if err := toGoError(cErr); err != nil {
+		return nil, err
+	}
+	defer C.Tensors_Delete(ret)
+
+	length := int(ret.length)
+	hdr := reflect.SliceHeader{
+		Data: uintptr(unsafe.Pointer(ret.tensors)),
+		Len:  length,
+		Cap:  length,
+	}
+	cTensors := *(*[]C.Tensor)(unsafe.Pointer(&hdr))
+
+	tensors := make([]Tensor, length)
+	for i, t := range cTensors {
+		tensors[i] = Tensor{
+			Name:  string(toGoBytes(t.name)),
+			Shape: toGoInts(t.shape, int(t.dims)),
+			Data:  toGoFloat32s(t.data, int(t.length)),
+		}
+	}
+	return tensors, nil
+}
@@ -0,0 +1,57 @@
+#ifndef _OPENCV_BRIDGE_DNN_H_
+#define _OPENCV_BRIDGE_DNN_H_
+
+#include "opencv_bridge.h"
+
+#ifdef __cplusplus
+// cv::dnn::readNet is available in OpenCV 3.4 or later, bridge functions of
+// Net return an error on older versions.
+#if CV_VERSION_MAJOR > 3 || (CV_VERSION_MAJOR == 3 && CV_VERSION_MINOR >= 4)
+#define BRIDGE_HAS_DNN
+#include <opencv2/dnn.hpp>
+#endif
+extern "C" {
+#endif
+
+// BlobParams is parameters of cv::dnn::blobFromImage. Zero width or height
+// means the size of the image.
+typedef struct BlobParams {
+  int width;
+  int height;
+  double scale;
+  double mean[3];
+  int swapRB;
+  int crop;
+} BlobParams;
+// Tensor is an output blob of a layer, data has `length` floats in row-major
+// order of shape.
+typedef struct Tensor {
+  struct ByteArray name;
+  int* shape;
+  int dims;
+  float* data;
+  int length;
+} Tensor;
+typedef struct Tensors {
+  Tensor* tensors;
+  int length;
+} Tensors;
+
+#if defined(__cplusplus) && defined(BRIDGE_HAS_DNN)
+typedef cv::dnn::Net* Net;
+#else
+typedef void* Net;
+#endif
+
+Net Net_ReadNet(const char* model, const char* config, const char* framework,
+  struct Error* err);
+void Net_Delete(Net n);
+struct Tensors Net_Forward(Net n, MatVec3b img, struct BlobParams params,
+  struct Error* err);
+void Tensors_Delete(struct Tensors ts);
+
+#ifdef __cplusplus
+}
+#endif
+
+#endif //_OPENCV_BRIDGE_DNN_H_
@@ -0,0 +1,356 @@
+package bridge
+
+/*
+#include <stdlib.h>
+#include "util.h"
+#include "opencv_bridge.h"
+*/
+import "C"
+import (
+	"fmt"
+	"reflect"
+	"unsafe"
+)
+
+// Depths of Mat elements, values are same as OpenCV's CV_8U, CV_8S and so on.
+const (
+	CvDepth8U = iota
+	CvDepth8S
+	CvDepth16U
+	CvDepth16S
+	CvDepth32S
+	CvDepth32F
+	CvDepth64F
+)
+
+const (
+	cvChannelShift = 3
+	cvDepthMask    = (1 << cvChannelShift) - 1
+	cvMaxChannels  = 512
+)
+
+// MatType is a type of Mat elements, values are same as OpenCV's CV_8UC1,
+// CV_32FC3 and so on.
+type MatType int
+
+// Types of Mat elements.
+const (
+	CvType8UC1  MatType = CvDepth8U
+	CvType8UC2  MatType = CvDepth8U + 1<<cvChannelShift
+	CvType8UC3  MatType = CvDepth8U + 2<<cvChannelShift
+	CvType8UC4  MatType = CvDepth8U + 3<<cvChannelShift
+	CvType8SC1  MatType = CvDepth8S
+	CvType8SC2  MatType = CvDepth8S + 1<<cvChannelShift
+	CvType8SC3  MatType = CvDepth8S + 2<<cvChannelShift
+	CvType8SC4  MatType = CvDepth8S + 3<<cvChannelShift
+	CvType16UC1 MatType = CvDepth16U
+	CvType16UC2 MatType = CvDepth16U + 1<<cvChannelShift
+	CvType16UC3 MatType = CvDepth16U + 2<<cvChannelShift
+	CvType16UC4 MatType = CvDepth16U + 3<<cvChannelShift
+	CvType16SC1 MatType = CvDepth16S
+	CvType16SC2 MatType = CvDepth16S + 1<<cvChannelShift
+	CvType16SC3 MatType = CvDepth16S + 2<<cvChannelShift
+	CvType16SC4 MatType = CvDepth16S + 3<<cvChannelShift
+	CvType32SC1 MatType = CvDepth32S
+	CvType32SC2 MatType = CvDepth32S + 1<<cvChannelShift
+	CvType32SC3 MatType = CvDepth32S + 2<<cvChannelShift
+	CvType32SC4 MatType = CvDepth32S + 3<<cvChannelShift
+	CvType32FC1 MatType = CvDepth32F
+	CvType32FC2 MatType = CvDepth32F + 1<<cvChannelShift
+	CvType32FC3 MatType = CvDepth32F + 2<<cvChannelShift
+	CvType32FC4 MatType = CvDepth32F + 3<<cvChannelShift
+	CvType64FC1 MatType = CvDepth64F
+	CvType64FC2 MatType = CvDepth64F + 1<<cvChannelShift
+	CvType64FC3 MatType = CvDepth64F + 2<<cvChannelShift
+	CvType64FC4 MatType = CvDepth64F + 3<<cvChannelShift
+)
+
+var depthNames = []string{"8U", "8S", "16U", "16S", "32S", "32F", "64F"}
+
+var depthSizes = []int{1, 1, 2, 2, 4, 4, 8}
+
+// NewMatType returns a MatType of the depth and the number of channels, same
+// as OpenCV's CV_MAKETYPE. Returns an error when the depth or channels is
+// out of range.
+func NewMatType(depth int, channels int) (MatType, error) {
+	if depth < 0 || depth >= len(depthNames) {
+		return 0, fmt.Errorf("unsupported depth: %d", depth)
+	}
+	if channels < 1 || channels > cvMaxChannels {
+		return 0, fmt.Errorf("unsupported number of channels: %d", channels)
+	}
+	return MatType(depth + (channels-1)<<cvChannelShift), nil
+}
+
+// Depth returns the depth of elements.
+func (t MatType) Depth() int {
+	return int(t) & cvDepthMask
+}
+
+// Channels returns the number of channels.
+func (t MatType) Channels() int {
+	return int(t)>>cvChannelShift + 1
+}
+
+// ElemSize1 returns the number of bytes of a channel. It returns 0 when the
+// depth is not supported, e.g. CV_16F of OpenCV 4.
+func (t MatType) ElemSize1() int {
+	d := t.Depth()
+	if d >= len(depthSizes) {
+		return 0
+	}
+	return depthSizes[d]
+}
+
+// ElemSize returns the number of bytes of an element (= a pixel).
+func (t MatType) ElemSize() int {
+	return t.ElemSize1() * t.Channels()
+}
+
+// String returns OpenCV style type name without "CV_" prefix, e.g. "8UC3".
+// It returns "unknown" when the depth is not supported.
+func (t MatType) String() string {
+	d := t.Depth()
+	if d >= len(depthNames) {
+		return "unknown"
+	}
+	return fmt.Sprintf("%sC%d", depthNames[d], t.Channels())
+}
+
+// Mat is a bind of `cv::Mat`, which can have any depth and channels.
+type Mat struct {
+	p C.Mat
+}
+
+// NewMat returns a new empty Mat.
+func NewMat() Mat {
+	return Mat{p: C.Mat_New()}
+}
+
+// NewMatWithSize returns a new Mat which is filled with 0.
+func NewMatWithSize(rows int, cols int, t MatType) (Mat, error) {
+	var cErr C.struct_Error
+	p := C.Mat_NewWithSize(C.int(rows), C.int(cols), C.int(t), &cErr)
+	if err := toGoError(cErr); err != nil {
+		return Mat{}, err
+	}
+	return Mat{p: p}, nil
+}
+
+// NewMatFromBytes returns a new Mat which has a copy of data. step is the
+// number of bytes of each row, 0 means rows are tightly packed. Returns an
+// error when data is too short. Returned Mat is required to delete after
+// using.
+func NewMatFromBytes(rows int, cols int, t MatType, step int, data []byte) (
+	Mat, error) {
+	if step == 0 {
+		step = cols * t.ElemSize()
+	}
+	cr := C.struct_RawData{
+		width:  C.int(cols),
+		height: C.int(rows),
+		step:   C.int(step),
+		data:   toByteArray(data),
+	}
+	var cErr C.struct_Error
+	p := C.RawData_ToMat(cr, C.int(t), &cErr)
+	if err := toGoError(cErr); err != nil {
+		return Mat{}, fmt.Errorf(
+			"%v: rows=%d, cols=%d, type=%v, step=%d, length=%d", err,
+			rows, cols, t, step, len(data))
+	}
+	return Mat{p: p}, nil
+}
+
+// NewMatFromInt8s returns a new CV_8SC{channels} Mat, see NewMatFromBytes.
+func NewMatFromInt8s(rows int, cols int, channels int, data []int8) (Mat,
+	error) {
+	return newMatFromSlice(rows, cols, CvDepth8S, channels,
+		sliceToBytes(data, 1))
+}
+
+// NewMatFromUint16s returns a new CV_16UC{channels} Mat, see NewMatFromBytes.
+func NewMatFromUint16s(rows int, cols int, channels int, data []uint16) (Mat,
+	error) {
+	return newMatFromSlice(rows, cols, CvDepth16U, channels,
+		sliceToBytes(data, 2))
+}
+
+// NewMatFromInt16s returns a new CV_16SC{channels} Mat, see NewMatFromBytes.
+func NewMatFromInt16s(rows int, cols int, channels int, data []int16) (Mat,
+	error) {
+	return newMatFromSlice(rows, cols, CvDepth16S, channels,
+		sliceToBytes(data, 2))
+}
+
+// NewMatFromInt32s returns a new CV_32SC{channels} Mat, see NewMatFromBytes.
+func NewMatFromInt32s(rows int, cols int, channels int, data []int32) (Mat,
+	error) {
+	return newMatFromSlice(rows, cols, CvDepth32S, channels,
+		sliceToBytes(data, 4))
+}
+
+// NewMatFromFloat32s returns a new CV_32FC{channels} Mat, see
+// NewMatFromBytes.
+func NewMatFromFloat32s(rows int, cols int, channels int, data []float32) (
+	Mat, error) {
+	return newMatFromSlice(rows, cols, CvDepth32F, channels,
+		sliceToBytes(data, 4))
+}
+
+// NewMatFromFloat64s returns a new CV_64FC{channels} Mat, see
+// NewMatFromBytes.
+func NewMatFromFloat64s(rows int, cols int, channels int, data []float64) (
+	Mat, error) {
+	return newMatFromSlice(rows, cols, CvDepth64F, channels,
+		sliceToBytes(data, 8))
+}
+
+func newMatFromSlice(rows int, cols int, depth int, channels int,
+	data []byte) (Mat, error) {
+	t, err := NewMatType(depth, channels)
+	if err != nil {
+		return Mat{}, err
+	}
+	return NewMatFromBytes(rows, cols, t, 0, data)
+}
+
+// Delete object.
+func (m *Mat) Delete() {
+	C.Mat_Delete(m.p)
+	m.p = nil
+}
+
+// Rows returns the number of rows.
+func (m *Mat) Rows() int {
+	return int(C.Mat_Rows(m.p))
+}
+
+// Cols returns the number of columns.
+func (m *Mat) Cols() int {
+	return int(C.Mat_Cols(m.p))
+}
+
+// Type returns the type of elements.
+func (m *Mat) Type() MatType {
+	return MatType(C.Mat_Type(m.p))
+}
+
+// Empty returns the Mat is empty or not.
+func (m *Mat) Empty() bool {
+	return C.Mat_Empty(m.p) != 0
+}
+
+// ToRawData converts Mat to RawData. Returns rows, cols, type, step and a
+// copy of data. See MatVec3b.ToRawData about step.
+func (m *Mat) ToRawData() (int, int, MatType, int, []byte) {
+	r := C.Mat_ToRawData(m.p)
+	return int(r.height), int(r.width), m.Type(), int(r.step),
+		toGoBytes(r.data)
+}
+
+// ToBytes returns a copy of data whose rows are tightly packed.
+func (m *Mat) ToBytes() []byte {
+	rows, cols, t, step, b := m.ToRawData()
+	rowSize := cols * t.ElemSize()
+	if step == rowSize {
+		return b
+	}
+	packed := make([]byte, rows*rowSize)
+	for y := 0; y < rows; y++ {
+		copy(packed[y*rowSize:(y+1)*rowSize], b[y*step:])
+	}
+	return packed
+}
+
+// ToInt8s returns a copy of data, the Mat's depth is required to be CV_8S.
+func (m *Mat) ToInt8s() ([]int8, error) {
+	b, err := m.toBytesOfDepth(CvDepth8S)
+	if err != nil {
+		return nil, err
+	}
+	ret := make([]int8, len(b))
+	copy(sliceToBytes(ret, 1), b)
+	return ret, nil
+}
+
+// ToUint16s returns a copy of data, the Mat's depth is required to be CV_16U.
+func (m *Mat) ToUint16s() ([]uint16, error) {
+	b, err := m.toBytesOfDepth(CvDepth16U)
+	if err != nil {
+		return nil, err
+	}
+	ret := make([]uint16, len(b)/2)
+	copy(sliceToBytes(ret, 2), b)
+	return ret, nil
+}
+
+// ToInt16s returns a copy of data, the Mat's depth is required to be CV_16S.
+func (m *Mat) ToInt16s() ([]int16, error) {
+	b, err := m.toBytesOfDepth(CvDepth16S)
+	if err != nil {
+		return nil, err
+	}
+	ret := make([]int16, len(b)/2)
+	copy(sliceToBytes(ret, 2), b)
+	return ret, nil
+}
+
+// ToInt32s returns a copy of data, the Mat's depth is required to be CV_32S.
+func (m *Mat) ToInt32s() ([]int32, error) {
+	b, err := m.toBytesOfDepth(CvDepth32S)
+	if err != nil {
+		return nil, err
+	}
+	ret := make([]int32, len(b)/4)
+	copy(sliceToBytes(ret, 4), b)
+	return ret, nil
+}
+
+// ToFloat32s returns a copy of data, the Mat's depth is required to be
+// CV_32F.
+func (m *Mat) ToFloat32s() ([]float32, error) {
+	b, err := m.toBytesOfDepth(CvDepth32F)
+	if err != nil {
+		return nil, err
+	}
+	ret := make([]float32, len(b)/4)
+	copy(sliceToBytes(ret, 4), b)
+	return ret, nil
+}
+
+// ToFloat64s returns a copy of data, the Mat's depth is required to be
+// CV_64F.
+func (m *Mat) ToFloat64s() ([]float64, error) {
+	b, err := m.toBytesOfDepth(CvDepth64F)
+	if err != nil {
+		return nil, err
+	}
+	ret := make([]float64, len(b)/8)
+	copy(sliceToBytes(ret, 8), b)
+	return ret, nil
+}
+
+func (m *Mat) toBytesOfDepth(depth int) ([]byte, error) {
+	if t := m.Type(); t.Depth() != depth {
+		return nil, fmt.Errorf("the type of Mat is %v, not %vC*", t,
+			depthNames[depth])
+	}
+	return m.ToBytes(), nil
+}
+
+// sliceToBytes returns a byte view of a numeric slice whose element size is
+// elemSize, the view shares the memory with the slice.
+func sliceToBytes(slice interface{}, elemSize int) []byte {
+	v := reflect.ValueOf(slice)
+	if v.Len() == 0 {
+		return []byte{}
+	}
+	length := v.Len() * elemSize
+	hdr := reflect.SliceHeader{
+		Data: v.Pointer(),
+		Len:  length,
+		Cap:  length,
+	}
+	return *(*[]byte)(unsafe.Pointer(&hdr))
+}
@@ -2,25 +2,107 @@
 
 #include <string.h>
 
+// rawDataSize returns the number of bytes of the image which has `step` bytes
+// per row. The last row is not padded, ROI views of a Mat have no data after
+// the last pixel of the row.
+static int rawDataSize(int width, int height, int step, int elemSize) {
+  if (width == 0 || height == 0) {
+    return 0;
+  }
+  return (height - 1) * step + width * elemSize;
+}
+
+// validRawData returns the RawData is able to be viewed as a Mat or not.
+static int validRawData(struct RawData r, int elemSize) {
+  if (r.width < 0 || r.height < 0 || r.step < r.width * elemSize) {
+    return 0;
+  }
+  return r.data.length >= rawDataSize(r.width, r.height, r.step, elemSize);
+}
+
+static const char* invalidRawDataMessage =
+  "invalid raw data: data is too short for width, height and step";
+
+Mat Mat_New() {
+  return new cv::Mat();
+}
+
+Mat Mat_NewWithSize(int rows, int cols, int type, struct Error* err) {
+  BRIDGE_TRY
+    return new cv::Mat(rows, cols, type, cv::Scalar::all(0));
+  BRIDGE_CATCH(err)
+  return NULL;
+}
+
+void Mat_Delete(Mat m) {
+  delete m;
+}
+
+int Mat_Rows(Mat m) {
+  return m->rows;
+}
+
+int Mat_Cols(Mat m) {
+  return m->cols;
+}
+
+int Mat_Type(Mat m) {
+  return m->type();
+}
+
+int Mat_Empty(Mat m) {
+  return m->empty();
+}
+
+struct RawData Mat_ToRawData(Mat m) {
+  int width = m->cols;
+  int height = m->rows;
+  int step = m->step[0];
+  int size = rawDataSize(width, height, step, m->elemSize());
+  char* data = reinterpret_cast<char*>(m->data);
+  ByteArray byteData = {data, size};
+  RawData raw = {width, height, step, byteData};
+  return raw;
+}
+
+Mat RawData_ToMat(struct RawData r, int type, struct Error* err) {
+  BRIDGE_TRY
+    if (!validRawData(r, CV_ELEM_SIZE(type))) {
+      Error_Set(err, invalidRawDataMessage);
+      return NULL;
+    }
+    cv::Mat view(r.height, r.width, type, r.data.data, r.step);
+    return new cv::Mat(view.clone());
+  BRIDGE_CATCH(err)
+  return NULL;
+}
+
 MatVec3b MatVec3b_New() {
   return new cv::Mat_<cv::Vec3b>();
 }
 
-struct ByteArray MatVec3b_ToJpegData(MatVec3b m, int quality){
-  std::vector<int> param(2);
-  param[0] = CV_IMWRITE_JPEG_QUALITY;
-  param[1] = quality;
-  std::vector<uchar> data;
-  cv::imencode(".jpg", *m, data, param);
-  return toByteArray(reinterpret_cast<const char*>(&data[0]), data.size());
+struct ByteArray MatVec3b_ToJpegData(MatVec3b m, int quality,
+    struct Error* err) {
+  BRIDGE_TRY
+    std::vector<int> param(2);
+    param[0] = cv::IMWRITE_JPEG_QUALITY;
+    param[1] = quality;
+    std::vector<uchar> data;
+    cv::imencode(".jpg", *m, data, param);
+    return toByteArray(reinterpret_cast<const char*>(&data[0]), data.size());
+  BRIDGE_CATCH(err)
+  ByteArray empty = {NULL, 0};
+  return empty;
 }
 
 void MatVec3b_Delete(MatVec3b m) {
   delete m;
 }
 
-void MatVec3b_CopyTo(MatVec3b src, MatVec3b dst) {
-  src->copyTo(*dst);
+void MatVec3b_CopyTo(MatVec3b src, MatVec3b dst, struct Error* err) {
+  BRIDGE_TRY
+    src->copyTo(*dst);
+  BRIDGE_CATCH(err)
 }
 
 int MatVec3b_Empty(MatVec3b m) {
@@ -30,20 +112,51 @@ int MatVec3b_Empty(MatVec3b m) {
 struct RawData MatVec3b_ToRawData(MatVec3b m) {
   int width = m->cols;
   int height = m->rows;
-  int size = width * height * 3;
+  int step = m->step[0];
+  int size = rawDataSize(width, height, step, 3);
   char* data = reinterpret_cast<char*>(m->data);
   ByteArray byteData = {data, size};
-  RawData raw = {width, height, byteData};
+  RawData raw = {width, height, step, byteData};
   return raw;
 }
 
-MatVec3b RawData_ToMatVec3b(struct RawData r) {
-  int rows = r.height;
-  int cols = r.width;
-  cv::Mat_<cv::Vec3b>* mat = new cv::Mat_<cv::Vec3b>(rows, cols);
-  unsigned char* data = reinterpret_cast<unsigned char*>(r.data.data);
-  mat->data = data;
-  return mat;
+MatVec3b RawData_ToMatVec3b(struct RawData r, struct Error* err) {
+  BRIDGE_TRY
+    if (!validRawData(r, 3)) {
+      Error_Set(err, invalidRawDataMessage);
+      return NULL;
+    }
+    cv::Vec3b* data = reinterpret_cast<cv::Vec3b*>(r.data.data);
+    cv::Mat_<cv::Vec3b> view(r.height, r.width, data, r.step);
+    return new cv::Mat_<cv::Vec3b>(view.clone());
+  BRIDGE_CATCH(err)
+  return NULL;
+}
+
+void MatVec3b_CopyFromRawData(MatVec3b m, struct RawData r,
+    struct Error* err) {
+  BRIDGE_TRY
+    if (!validRawData(r, 3)) {
+      Error_Set(err, invalidRawDataMessage);
+      return;
+    }
+    cv::Vec3b* data = reinterpret_cast<cv::Vec3b*>(r.data.data);
+    cv::Mat_<cv::Vec3b> view(r.height, r.width, data, r.step);
+    // copyTo does not reallocate the buffer of m when the size is same
+    view.copyTo(*m);
+  BRIDGE_CATCH(err)
+}
+
+MatVec3b RawData_ViewMatVec3b(struct RawData r, struct Error* err) {
+  BRIDGE_TRY
+    if (!validRawData(r, 3)) {
+      Error_Set(err, invalidRawDataMessage);
+      return NULL;
+    }
+    cv::Vec3b* data = reinterpret_cast<cv::Vec3b*>(r.data.data);
+    return new cv::Mat_<cv::Vec3b>(r.height, r.width, data, r.step);
+  BRIDGE_CATCH(err)
+  return NULL;
 }
 
 void MatVec4b_Delete(MatVec4b m) {
@@ -53,20 +166,25 @@ void MatVec4b_Delete(MatVec4b m) {
 struct RawData MatVec4b_ToRawData(MatVec4b m) {
   int width = m->cols;
   int height = m->rows;
-  int size = width * height * 4;
+  int step = m->step[0];
+  int size = rawDataSize(width, height, step, 4);
   char* data = reinterpret_cast<char*>(m->data);
   ByteArray byteData = {data, size};
-  RawData raw = {width, height, byteData};
+  RawData raw = {width, height, step, byteData};
   return raw;
 }
 
-MatVec4b RawData_ToMatVec4b(struct RawData r) {
-  int rows = r.height;
-  int cols = r.width;
-  cv::Mat_<cv::Vec4b>* mat = new cv::Mat_<cv::Vec4b>(rows, cols);
-  unsigned char* data = reinterpret_cast<unsigned char*>(r.data.data);
-  mat->data = data;
-  return mat;
+MatVec4b RawData_ToMatVec4b(struct RawData r, struct Error* err) {
+  BRIDGE_TRY
+    if (!validRawData(r, 4)) {
+      Error_Set(err, invalidRawDataMessage);
+      return NULL;
+    }
+    cv::Vec4b* data = reinterpret_cast<cv::Vec4b*>(r.data.data);
+    cv::Mat_<cv::Vec4b> view(r.height, r.width, data, r.step);
+    return new cv::Mat_<cv::Vec4b>(view.clone());
+  BRIDGE_CATCH(err)
+  return NULL;
 }
 
 VideoCapture VideoCapture_New() {
@@ -77,34 +195,79 @@ void VideoCapture_Delete(VideoCapture v) {
   delete v;
 }
 
-int VideoCapture_Open(VideoCapture v, const char* uri) {
-  return v->open(uri);
+int VideoCapture_Open(VideoCapture v, const char* uri, struct Error* err) {
+  BRIDGE_TRY
+    return v->open(uri);
+  BRIDGE_CATCH(err)
+  return 0;
+}
+
+int VideoCapture_OpenDevice(VideoCapture v, int device, struct Error* err) {
+  BRIDGE_TRY
+    return v->open(device);
+  BRIDGE_CATCH(err)
+  return 0;
 }
 
-int VideoCapture_OpenDevice(VideoCapture v, int device) {
-  return v->open(device);
+int VideoCapture_OpenWithAPI(VideoCapture v, const char* uri,
+    int apiPreference, struct Error* err) {
+  BRIDGE_TRY
+#if CV_VERSION_MAJOR > 3 || (CV_VERSION_MAJOR == 3 && CV_VERSION_MINOR >= 2)
+    return v->open(uri, apiPreference);
+#else
+    if (apiPreference != cv::CAP_ANY) {
+      Error_Set(err, "API preference requires OpenCV 3.2 or later");
+      return 0;
+    }
+    return v->open(uri);
+#endif
+  BRIDGE_CATCH(err)
+  return 0;
+}
+
+int VideoCapture_OpenDeviceWithAPI(VideoCapture v, int device,
+    int apiPreference, struct Error* err) {
+  BRIDGE_TRY
+#if CV_VERSION_MAJOR > 3 || (CV_VERSION_MAJOR == 3 && CV_VERSION_MINOR >= 4)
+    return v->open(device, apiPreference);
+#else
+    // older OpenCV selects the backend by the sum of the backend and the index
+    return v->open(apiPreference + device);
+#endif
+  BRIDGE_CATCH(err)
+  return 0;
 }
 
-void VideoCapture_Release(VideoCapture v) {
-  v->release();
+void VideoCapture_Release(VideoCapture v, struct Error* err) {
+  BRIDGE_TRY
+    v->release();
+  BRIDGE_CATCH(err)
 }
 
-void VideoCapture_Set(VideoCapture v, int prop, int param) {
-  v->set(prop, param);
+void VideoCapture_Set(VideoCapture v, int prop, int param,
+    struct Error* err) {
+  BRIDGE_TRY
+    v->set(prop, param);
+  BRIDGE_CATCH(err)
 }
 
 int VideoCapture_IsOpened(VideoCapture v) {
   return v->isOpened();
 }
 
-int VideoCapture_Read(VideoCapture v, MatVec3b buf) {
-  return v->read(*buf);
+int VideoCapture_Read(VideoCapture v, MatVec3b buf, struct Error* err) {
+  BRIDGE_TRY
+    return v->read(*buf);
+  BRIDGE_CATCH(err)
+  return 0;
 }
 
-void VideoCapture_Grab(VideoCapture v, int skip) {
-  for (int i =0; i < skip; i++) {
-    v->grab();
-  }
+void VideoCapture_Grab(VideoCapture v, int skip, struct Error* err) {
+  BRIDGE_TRY
+    for (int i =0; i < skip; i++) {
+      v->grab();
+    }
+  BRIDGE_CATCH(err)
 }
 
 VideoWriter VideoWriter_New() {
@@ -116,21 +279,29 @@ void VideoWriter_Delete(VideoWriter vw) {
 }
 
 void VideoWriter_Open(VideoWriter vw, const char* name, double fps, int width,
-    int height) {
-  vw->open(name, CV_FOURCC('M', 'J', 'P', 'G'), fps, cv::Size(width, height), true);
+    int height, struct Error* err) {
+  BRIDGE_TRY
+    vw->open(name, cv::VideoWriter::fourcc('M', 'J', 'P', 'G'), fps,
+      cv::Size(width, height), true);
+  BRIDGE_CATCH(err)
 }
 
 void VideoWriter_OpenWithMat(VideoWriter vw, const char* name, double fps,
-    MatVec3b img) {
-  vw->open(name, CV_FOURCC('M', 'J', 'P', 'G'), fps, img->size(), true);
+    MatVec3b img, struct Error* err) {
+  BRIDGE_TRY
+    vw->open(name, cv::VideoWriter::fourcc('M', 'J', 'P', 'G'), fps,
+      img->size(), true);
+  BRIDGE_CATCH(err)
 }
 
 int VideoWriter_IsOpened(VideoWriter vw) {
   return vw->isOpened();
 }
 
-void VideoWriter_Write(VideoWriter vw, MatVec3b img) {
-  *vw << *img;
+void VideoWriter_Write(VideoWriter vw, MatVec3b img, struct Error* err) {
+  BRIDGE_TRY
+    *vw << *img;
+  BRIDGE_CATCH(err)
 }
 
 CascadeClassifier CascadeClassifier_New() {
@@ -141,93 +312,428 @@ void CascadeClassifier_Delete(CascadeClassifier cs) {
   delete cs;
 }
 
-int CascadeClassifier_Load(CascadeClassifier cs, const char* name) {
-  return cs->load(name);
+int CascadeClassifier_Load(CascadeClassifier cs, const char* name,
+    struct Error* err) {
+  BRIDGE_TRY
+    return cs->load(name);
+  BRIDGE_CATCH(err)
+  return 0;
+}
+
+// values of DetectMultiScaleParams.equalize, same as bridge.Equalize*
+enum {
+  EQUALIZE_NONE = 0,
+  EQUALIZE_HIST = 1,
+  EQUALIZE_CLAHE = 2,
+};
+
+// preprocessForDetection returns the image converted to grayscale, equalized
+// and downscaled by the parameters. The returned image may share data with
+// img when no preprocessing is required.
+static cv::Mat preprocessForDetection(const cv::Mat& img,
+    const struct DetectMultiScaleParams& params) {
+  cv::Mat ret = img;
+  if (params.grayscale || params.equalize != EQUALIZE_NONE) {
+    cv::Mat gray;
+    cv::cvtColor(ret, gray, cv::COLOR_BGR2GRAY);
+    ret = gray;
+  }
+  if (params.equalize == EQUALIZE_HIST) {
+    cv::Mat equalized;
+    cv::equalizeHist(ret, equalized);
+    ret = equalized;
+  } else if (params.equalize == EQUALIZE_CLAHE) {
+    cv::Ptr<cv::CLAHE> clahe = cv::createCLAHE(params.claheClipLimit,
+      cv::Size(params.claheTileSize, params.claheTileSize));
+    cv::Mat equalized;
+    clahe->apply(ret, equalized);
+    ret = equalized;
+  }
+  if (params.downscale > 1.0) {
+    cv::Mat small;
+    cv::resize(ret, small, cv::Size(), 1.0 / params.downscale,
+      1.0 / params.downscale, cv::INTER_AREA);
+    ret = small;
+  }
+  return ret;
+}
+
+// scaledLength returns a length on the downscaled image. 0 means no limit
+// for OpenCV, so a nonzero length is kept 1 or larger.
+static int scaledLength(int length, double downscale) {
+  if (length == 0) {
+    return 0;
+  }
+  return std::max(cvRound(length / downscale), 1);
 }
 
-struct Rects CascadeClassifier_DetectMultiScale(CascadeClassifier cs, MatVec3b img) {
-  std::vector<cv::Rect> faces;
-  cs->detectMultiScale(*img, faces); // TODO control default parameter
-  Rect* rects = new Rect[faces.size()];
-  for (size_t i = 0; i < faces.size(); ++i) {
-    Rect r = {faces[i].x, faces[i].y, faces[i].width, faces[i].height};
-    rects[i] = r;
+// scaledSize returns size on the downscaled image.
+static cv::Size scaledSize(int width, int height, double downscale) {
+  if (downscale <= 1.0) {
+    return cv::Size(width, height);
   }
-  Rects ret = {rects, (int)faces.size()};
+  return cv::Size(scaledLength(width, downscale),
+    scaledLength(height, downscale));
+}
+
+// toOriginalRect maps a rect on the downscaled region image to the original
+// image, offset is the top-left of the region.
+static Rect toOriginalRect(const cv::Rect& r, double downscale,
+    const cv::Point& offset) {
+  if (downscale <= 1.0) {
+    Rect ret = {r.x + offset.x, r.y + offset.y, r.width, r.height};
+    return ret;
+  }
+  Rect ret = {cvRound(r.x * downscale) + offset.x,
+    cvRound(r.y * downscale) + offset.y, cvRound(r.width * downscale),
+    cvRound(r.height * downscale)};
   return ret;
 }
 
-void Rects_Delete(struct Rects rs) {
-  delete rs.rects;
-}
-
-void DrawRectsToImage(MatVec3b img, struct Rects rects) {
-  for (int i = 0; i < rects.length; ++i) {
-    Rect r = rects.rects[i];
-    cv::rectangle(*img, cv::Point(r.x, r.y), cv::Point(r.x+r.width, r.y+r.height),
-      cv::Scalar(0, 200, 0), 3, CV_AA);
-  }
-}
-
-MatVec4b LoadAlphaImg(const char* name) {
-  cv::Mat_<cv::Vec4b> img = cv::imread(name, cv::IMREAD_UNCHANGED);
-  return new cv::Mat_<cv::Vec4b>(img);
-}
-
-void MountAlphaImage(MatVec4b img, MatVec3b back, struct Rects rects) {
-  cv::Mat_<cv::Vec4b> resized;
-  for (int i = 0; i < rects.length; ++i) {
-    Rect r = rects.rects[i];
-    int col, row;
-    if (r.width < r.height) {
-      col = img->cols * r.height / img->rows;
-      row = r.height;
-    } else {
-      col = r.width;
-      row = img->rows * r.width / img->cols;
-    }
-    int ltx = r.x + r.width * 0.5 - col * 0.5;
-    int lty = r.y + r.height * 0.5 - row * 0.5;
-    std::vector<cv::Point2f> tgtPt;
-    tgtPt.push_back(cv::Point2f(ltx, lty));
-    tgtPt.push_back(cv::Point2f(ltx+col, lty));
-    tgtPt.push_back(cv::Point2f(ltx+col, lty+row));
-    tgtPt.push_back(cv::Point2f(ltx, lty+row));
-
-    cv::Mat img_rgb, img_aaa, img_backa;
-    std::vector<cv::Mat> planes_rgba, planes_rgb, planes_aaa, planes_backa;
-    int maxVal = pow(2, 8 * back->elemSize1()) - 1;
-
-    std::vector<cv::Point2f> srcPt;
-    srcPt.push_back(cv::Point2f(0, 0));
-    srcPt.push_back(cv::Point2f(img->cols-1, 0));
-    srcPt.push_back(cv::Point2f(img->cols-1, img->rows-1));
-    srcPt.push_back(cv::Point2f(0, img->rows-1));
-    cv::Mat mat = cv::getPerspectiveTransform(srcPt, tgtPt);
-
-    cv::Mat alpha0(back->rows, back->cols, img->type());
-    alpha0 = cv::Scalar::all(0);
-    cv::warpPerspective(*img, alpha0, mat, alpha0.size(), cv::INTER_CUBIC,
-      cv::BORDER_TRANSPARENT);
-
-    cv::split(alpha0, planes_rgba);
-
-    planes_rgb.push_back(planes_rgba[0]);
-    planes_rgb.push_back(planes_rgba[1]);
-    planes_rgb.push_back(planes_rgba[2]);
-    merge(planes_rgb, img_rgb);
-
-    planes_aaa.push_back(planes_rgba[3]);
-    planes_aaa.push_back(planes_rgba[3]);
-    planes_aaa.push_back(planes_rgba[3]);
-    merge(planes_aaa, img_aaa);
-
-    planes_backa.push_back(maxVal - planes_rgba[3]);
-    planes_backa.push_back(maxVal - planes_rgba[3]);
-    planes_backa.push_back(maxVal - planes_rgba[3]);
-    merge(planes_backa, img_backa);
-
-    *back = img_rgb.mul(img_aaa, 1.0/(float)maxVal)
-      + back->mul(img_backa, 1.0/(float)maxVal);
+// regionImage returns the part of img to detect, which is the intersection
+// of the image, the ROI, the bounding box of the polygon and the bounding box
+// of the mask. Pixels outside the polygon or the mask are filled with 0.
+// offset is set to the top-left of the part. Returns an empty Mat when the
+// intersection is empty.
+static cv::Mat regionImage(const cv::Mat& img,
+    const struct DetectRegion& region, cv::Point* offset) {
+  cv::Rect roi(0, 0, img.cols, img.rows);
+  if (region.roi.width > 0 && region.roi.height > 0) {
+    roi &= cv::Rect(region.roi.x, region.roi.y, region.roi.width,
+      region.roi.height);
+  }
+  std::vector<cv::Point> polygon;
+  for (int i = 0; i < region.polygon.length; ++i) {
+    Point p = region.polygon.points[i];
+    polygon.push_back(cv::Point(p.x, p.y));
+  }
+  if (!polygon.empty()) {
+    roi &= cv::boundingRect(polygon);
+  }
+  if (region.mask != NULL) {
+    CV_Assert(region.mask->type() == CV_8UC1 &&
+      region.mask->size() == img.size());
+    std::vector<cv::Point> nonZero;
+    cv::findNonZero(*region.mask, nonZero);
+    if (nonZero.empty()) {
+      return cv::Mat();
+    }
+    roi &= cv::boundingRect(nonZero);
   }
+  *offset = roi.tl();
+  if (roi.width <= 0 || roi.height <= 0) {
+    return cv::Mat();
+  }
+
+  cv::Mat part = img(roi);
+  if (polygon.empty() && region.mask == NULL) {
+    return part;
+  }
+  cv::Mat mask;
+  if (polygon.empty()) {
+    mask = cv::Mat(roi.size(), CV_8UC1, cv::Scalar(255));
+  } else {
+    mask = cv::Mat::zeros(roi.size(), CV_8UC1);
+    std::vector<std::vector<cv::Point> > polygons(1, polygon);
+    cv::fillPoly(mask, polygons, cv::Scalar(255), cv::LINE_8, 0, -roi.tl());
+  }
+  if (region.mask != NULL) {
+    cv::bitwise_and(mask, (*region.mask)(roi), mask);
+  }
+  cv::Mat masked = cv::Mat::zeros(part.size(), part.type());
+  part.copyTo(masked, mask);
+  return masked;
+}
+
+struct Rects CascadeClassifier_DetectMultiScale(CascadeClassifier cs, MatVec3b img,
+    struct DetectMultiScaleParams params, struct DetectRegion region,
+    struct Error* err) {
+  BRIDGE_TRY
+    cv::Point offset;
+    cv::Mat part = regionImage(*img, region, &offset);
+    std::vector<cv::Rect> faces;
+    if (!part.empty()) {
+      cs->detectMultiScale(preprocessForDetection(part, params), faces,
+        params.scaleFactor, params.minNeighbors, params.flags,
+        scaledSize(params.minWidth, params.minHeight, params.downscale),
+        scaledSize(params.maxWidth, params.maxHeight, params.downscale));
+    }
+    Rect* rects = new Rect[faces.size()];
+    for (size_t i = 0; i < faces.size(); ++i) {
+      rects[i] = toOriginalRect(faces[i], params.downscale, offset);
+    }
+    Rects ret = {rects, (int)faces.size()};
+    return ret;
+  BRIDGE_CATCH(err)
+  Rects empty = {NULL, 0};
+  return empty;
+}
+
+struct ScoredRects CascadeClassifier_DetectMultiScale3(CascadeClassifier cs,
+    MatVec3b img, struct DetectMultiScaleParams params,
+    struct DetectRegion region, struct Error* err) {
+  BRIDGE_TRY
+    cv::Point offset;
+    cv::Mat part = regionImage(*img, region, &offset);
+    std::vector<cv::Rect> objects;
+    std::vector<int> levels;
+    std::vector<double> weights;
+    if (!part.empty()) {
+      cs->detectMultiScale(preprocessForDetection(part, params), objects,
+        levels, weights, params.scaleFactor, params.minNeighbors,
+        params.flags,
+        scaledSize(params.minWidth, params.minHeight, params.downscale),
+        scaledSize(params.maxWidth, params.maxHeight, params.downscale), true);
+    }
+    // levels and weights have the same length as objects when
+    // outputRejectLevels is true
+    int length = objects.size();
+    ScoredRects ret = {new Rect[length], new int[length], new double[length],
+      length};
+    for (int i = 0; i < length; ++i) {
+      ret.rects[i] = toOriginalRect(objects[i], params.downscale, offset);
+      ret.levels[i] = levels[i];
+      ret.weights[i] = weights[i];
+    }
+    return ret;
+  BRIDGE_CATCH(err)
+  ScoredRects empty = {NULL, NULL, NULL, 0};
+  return empty;
+}
+
+HOGDescriptor HOGDescriptor_New() {
+  return new cv::HOGDescriptor();
+}
+
+void HOGDescriptor_Delete(HOGDescriptor hog) {
+  delete hog;
+}
+
+int HOGDescriptor_Load(HOGDescriptor hog, const char* name,
+    struct Error* err) {
+  BRIDGE_TRY
+    return hog->load(name);
+  BRIDGE_CATCH(err)
+  return 0;
+}
+
+void HOGDescriptor_SetDefaultPeopleDetector(HOGDescriptor hog,
+    struct Error* err) {
+  BRIDGE_TRY
+    hog->setSVMDetector(cv::HOGDescriptor::getDefaultPeopleDetector());
+  BRIDGE_CATCH(err)
+}
+
+void HOGDescriptor_SetDaimlerPeopleDetector(HOGDescriptor hog,
+    struct Error* err) {
+  BRIDGE_TRY
+    // the Daimler detector is trained with 48x96 windows
+    hog->winSize = cv::Size(48, 96);
+    hog->setSVMDetector(cv::HOGDescriptor::getDaimlerPeopleDetector());
+  BRIDGE_CATCH(err)
+}
+
+struct ScoredRects HOGDescriptor_DetectMultiScale(HOGDescriptor hog,
+    MatVec3b img, struct HOGDetectParams params, struct Error* err) {
+  BRIDGE_TRY
+    std::vector<cv::Rect> objects;
+    std::vector<double> weights;
+    if (!img->empty()) {
+      hog->detectMultiScale(*img, objects, weights, params.hitThreshold,
+        cv::Size(params.winStrideWidth, params.winStrideHeight),
+        cv::Size(params.paddingWidth, params.paddingHeight), params.scale,
+        params.finalThreshold, params.useMeanshiftGrouping != 0);
+    }
+    // HOG has no reject levels, levels is left NULL
+    int length = objects.size();
+    ScoredRects ret = {new Rect[length], NULL, new double[length], length};
+    for (int i = 0; i < length; ++i) {
+      cv::Rect r = objects[i];
+      Rect rect = {r.x, r.y, r.width, r.height};
+      ret.rects[i] = rect;
+      ret.weights[i] = weights[i];
+    }
+    return ret;
+  BRIDGE_CATCH(err)
+  ScoredRects empty = {NULL, NULL, NULL, 0};
+  return empty;
+}
+
+void Rects_Delete(struct Rects rs) {
+  delete[] rs.rects;
+}
+
+void ScoredRects_Delete(struct ScoredRects rs) {
+  delete[] rs.rects;
+  delete[] rs.levels;
+  delete[] rs.weights;
+}
+
+void DrawRectsToImage(MatVec3b img, struct Rects rects, struct Error* err) {
+  BRIDGE_TRY
+    for (int i = 0; i < rects.length; ++i) {
+      Rect r = rects.rects[i];
+      cv::rectangle(*img, cv::Point(r.x, r.y), cv::Point(r.x+r.width, r.y+r.height),
+        cv::Scalar(0, 200, 0), 3, cv::LINE_AA);
+    }
+  BRIDGE_CATCH(err)
+}
+
+struct ScoredRects Rects_Group(struct Rects rects, int groupThreshold,
+    double eps, struct Error* err) {
+  BRIDGE_TRY
+    std::vector<cv::Rect> rectList;
+    for (int i = 0; i < rects.length; ++i) {
+      Rect r = rects.rects[i];
+      rectList.push_back(cv::Rect(r.x, r.y, r.width, r.height));
+    }
+    std::vector<int> counts;
+    cv::groupRectangles(rectList, counts, groupThreshold, eps);
+    // levels has the number of rectangles in each group, weights is left NULL
+    int length = rectList.size();
+    ScoredRects ret = {new Rect[length], new int[length], NULL, length};
+    for (int i = 0; i < length; ++i) {
+      cv::Rect r = rectList[i];
+      Rect rect = {r.x, r.y, r.width, r.height};
+      ret.rects[i] = rect;
+      ret.levels[i] = counts[i];
+    }
+    return ret;
+  BRIDGE_CATCH(err)
+  ScoredRects empty = {NULL, NULL, NULL, 0};
+  return empty;
+}
+
+struct Rects Mat_ForegroundRects(Mat mask, double minArea,
+    struct Error* err) {
+  BRIDGE_TRY
+    // only 255 is foreground, shadows of background subtractors are 127
+    cv::Mat fg;
+    cv::threshold(*mask, fg, 254, 255, cv::THRESH_BINARY);
+    std::vector<std::vector<cv::Point> > contours;
+    cv::findContours(fg, contours, cv::RETR_EXTERNAL, cv::CHAIN_APPROX_SIMPLE);
+    std::vector<cv::Rect> rects;
+    for (size_t i = 0; i < contours.size(); ++i) {
+      if (cv::contourArea(contours[i]) >= minArea) {
+        rects.push_back(cv::boundingRect(contours[i]));
+      }
+    }
+    int length = rects.size();
+    Rects ret = {new Rect[length], length};
+    for (int i = 0; i < length; ++i) {
+      Rect r = {rects[i].x, rects[i].y, rects[i].width, rects[i].height};
+      ret.rects[i] = r;
+    }
+    return ret;
+  BRIDGE_CATCH(err)
+  Rects empty = {NULL, 0};
+  return empty;
+}
+
+Mat MatVec3b_ToBlurredGray(MatVec3b img, int blurSize, struct Error* err) {
+  BRIDGE_TRY
+    cv::Mat gray;
+    cv::cvtColor(*img, gray, cv::COLOR_BGR2GRAY);
+    if (blurSize > 1) {
+      cv::GaussianBlur(gray, gray, cv::Size(blurSize, blurSize), 0);
+    }
+    return new cv::Mat(gray);
+  BRIDGE_CATCH(err)
+  return NULL;
+}
+
+Mat Mat_DiffMask(Mat a, Mat b, double threshold, int dilate,
+    struct Error* err) {
+  BRIDGE_TRY
+    cv::Mat diff;
+    cv::absdiff(*a, *b, diff);
+    cv::threshold(diff, diff, threshold, 255, cv::THRESH_BINARY);
+    if (dilate > 0) {
+      cv::dilate(diff, diff, cv::Mat(), cv::Point(-1, -1), dilate);
+    }
+    return new cv::Mat(diff);
+  BRIDGE_CATCH(err)
+  return NULL;
+}
+
+MatVec4b LoadAlphaImg(const char* name, struct Error* err) {
+  BRIDGE_TRY
+    cv::Mat_<cv::Vec4b> img = cv::imread(name, cv::IMREAD_UNCHANGED);
+    return new cv::Mat_<cv::Vec4b>(img);
+  BRIDGE_CATCH(err)
+  return NULL;
+}
+
+void MountAlphaImage(MatVec4b img, MatVec3b back, struct Rects rects,
+    struct Error* err) {
+  BRIDGE_TRY
+    // an empty image causes division by zero, which is not an exception
+    CV_Assert(!img->empty());
+    for (int i = 0; i < rects.length; ++i) {
+      Rect r = rects.rects[i];
+      int col, row;
+      if (r.width < r.height) {
+        col = img->cols * r.height / img->rows;
+        row = r.height;
+      } else {
+        col = r.width;
+        row = img->rows * r.width / img->cols;
+      }
+      int ltx = r.x + r.width * 0.5 - col * 0.5;
+      int lty = r.y + r.height * 0.5 - row * 0.5;
+      std::vector<cv::Point2f> tgtPt;
+      tgtPt.push_back(cv::Point2f(ltx, lty));
+      tgtPt.push_back(cv::Point2f(ltx+col, lty));
+      tgtPt.push_back(cv::Point2f(ltx+col, lty+row));
+      tgtPt.push_back(cv::Point2f(ltx, lty+row));
+
+      cv::Mat img_rgb, img_aaa, img_backa;
+      std::vector<cv::Mat> planes_rgba, planes_rgb, planes_aaa, planes_backa;
+      int maxVal = pow(2, 8 * back->elemSize1()) - 1;
+
+      std::vector<cv::Point2f> srcPt;
+      srcPt.push_back(cv::Point2f(0, 0));
+      srcPt.push_back(cv::Point2f(img->cols-1, 0));
+      srcPt.push_back(cv::Point2f(img->cols-1, img->rows-1));
+      srcPt.push_back(cv::Point2f(0, img->rows-1));
+      cv::Mat mat = cv::getPerspectiveTransform(srcPt, tgtPt);
+
+      cv::Mat alpha0(back->rows, back->cols, img->type());
+      alpha0 = cv::Scalar::all(0);
+      cv::warpPerspective(*img, alpha0, mat, alpha0.size(), cv::INTER_CUBIC,
+        cv::BORDER_TRANSPARENT);
+
+      cv::split(alpha0, planes_rgba);
+
+      planes_rgb.push_back(planes_rgba[0]);
+      planes_rgb.push_back(planes_rgba[1]);
+      planes_rgb.push_back(planes_rgba[2]);
+      merge(planes_rgb, img_rgb);
+
+      planes_aaa.push_back(planes_rgba[3]);
+      planes_aaa.push_back(planes_rgba[3]);
+      planes_aaa.push_back(planes_rgba[3]);
+      merge(planes_aaa, img_aaa);
+
+      planes_backa.push_back(maxVal - planes_rgba[3]);
+      planes_backa.push_back(maxVal - planes_rgba[3]);
+      planes_backa.push_back(maxVal - planes_rgba[3]);
+      merge(planes_backa, img_backa);
+
+      // write the result into the buffer of `back`, not to reallocate it
+      cv::Mat blended = img_rgb.mul(img_aaa, 1.0/(float)maxVal)
+        + back->mul(img_backa, 1.0/(float)maxVal);
+      blended.copyTo(*back);
+    }
+  BRIDGE_CATCH(err)
+}
+
+struct ByteArray OpenCV_Version() {
+  cv::String v = cv::getVersionString();
+  return toByteArray(v.c_str(), v.size());
+}
+
+struct ByteArray OpenCV_BuildInformation() {
+  const cv::String& info = cv::getBuildInformation();
+  return toByteArray(info.c_str(), info.size());
 }
@@ -1,14 +1,13 @@
 package bridge
 
 /*
-#cgo linux pkg-config: opencv
-#cgo darwin pkg-config: opencv
 #include <stdlib.h>
 #include "util.h"
 #include "opencv_bridge.h"
 */
 import "C"
 import (
+	"fmt"
 	"reflect"
 	"sync"
 	"unsafe"
@@ -23,6 +22,20 @@ const (
 	CvCapPropFps = 5
 )
 
+const (
+	// CvCapAny is OpenCV API preference to select a backend automatically
+	CvCapAny = 0
+	// CvCapV4L2 is OpenCV API preference of Video4Linux2
+	CvCapV4L2 = 200
+	// CvCapGStreamer is OpenCV API preference of GStreamer
+	CvCapGStreamer = 1800
+	// CvCapFFmpeg is OpenCV API preference of FFmpeg
+	CvCapFFmpeg = 1900
+	// CvCapImages is OpenCV API preference of image sequence, e.g.
+	// "img_%02d.jpg"
+	CvCapImages = 2000
+)
+
 // CMatVec3b is an alias for C pointer.
 type CMatVec3b C.MatVec3b
 
@@ -47,10 +60,14 @@ func NewMatVec3bWithCPointer(p CMatVec3b) MatVec3b {
 }
 
 // ToJpegData convert to JPEG data.
-func (m *MatVec3b) ToJpegData(quality int) []byte {
-	b := C.MatVec3b_ToJpegData(m.p, C.int(quality))
+func (m *MatVec3b) ToJpegData(quality int) ([]byte, error) {
+	var cErr C.struct_Error
+	b := C.MatVec3b_ToJpegData(m.p, C.int(quality), &cErr)
+	if err := toGoError(cErr); err != nil {
+		return nil, err
+	}
 	defer C.ByteArray_Release(b)
-	return toGoBytes(b)
+	return toGoBytes(b), nil
 }
 
 // Delete object.
@@ -60,8 +77,10 @@ func (m *MatVec3b) Delete() {
 }
 
 // CopyTo copies MatVec3b.
-func (m *MatVec3b) CopyTo(dst *MatVec3b) {
-	C.MatVec3b_CopyTo(m.p, dst.p)
+func (m *MatVec3b) CopyTo(dst *MatVec3b) error {
+	var cErr C.struct_Error
+	C.MatVec3b_CopyTo(m.p, dst.p, &cErr)
+	return toGoError(cErr)
 }
 
 // Empty returns the MatVec3b is empty or not.
@@ -70,21 +89,83 @@ func (m *MatVec3b) Empty() bool {
 	return isEmpty != 0
 }
 
-// ToRawData converts MatVec3b to RawData.
-func (m *MatVec3b) ToRawData() (int, int, []byte) {
+// ToRawData converts MatVec3b to RawData. Returns width, height, step (the
+// number of bytes of each row) and data. When the MatVec3b is not continuous,
+// e.g. a region of interest, step is larger than `width * 3` and each row is
+// followed by padding bytes except the last row.
+func (m *MatVec3b) ToRawData() (int, int, int, []byte) {
 	r := C.MatVec3b_ToRawData(m.p)
-	return int(r.width), int(r.height), toGoBytes(r.data)
+	return int(r.width), int(r.height), int(r.step), toGoBytes(r.data)
+}
+
+// ToRawDataInto is same as ToRawData but copies data into buf to reuse it. A
+// new slice is allocated only when the capacity of buf is not enough. Returned
+// data shares the memory with buf in other cases.
+func (m *MatVec3b) ToRawDataInto(buf []byte) (int, int, int, []byte) {
+	r := C.MatVec3b_ToRawData(m.p)
+	return int(r.width), int(r.height), int(r.step),
+		copyFromByteArray(buf, r.data)
+}
+
+// CopyFromRawData copies RawData to the MatVec3b. Unlike ToMatVec3b, the
+// MatVec3b reuses its own buffer when the size is not changed, so a MatVec3b
+// can be used repeatedly for frames without reallocation. Returns an error
+// when data is too short for width, height and step.
+func (m *MatVec3b) CopyFromRawData(width int, height int, step int,
+	data []byte) error {
+	cr := C.struct_RawData{
+		width:  C.int(width),
+		height: C.int(height),
+		step:   C.int(step),
+		data:   toByteArray(data),
+	}
+	var cErr C.struct_Error
+	C.MatVec3b_CopyFromRawData(m.p, cr, &cErr)
+	if err := toGoError(cErr); err != nil {
+		return fmt.Errorf("%v: width=%d, height=%d, step=%d, length=%d", err,
+			width, height, step, len(data))
+	}
+	return nil
 }
 
-// ToMatVec3b converts RawData to MatVec3b. Returned MatVec3b is required to
-// delete after using.
-func ToMatVec3b(width int, height int, data []byte) MatVec3b {
+// ToMatVec3b converts RawData to MatVec3b. step is the number of bytes of each
+// row, returns an error when data is too short for width, height and step.
+// data is copied, returned MatVec3b does not refer data and modifying one does
+// not affect the other. Returned MatVec3b is required to delete after using.
+func ToMatVec3b(width int, height int, step int, data []byte) (MatVec3b, error) {
 	cr := C.struct_RawData{
 		width:  C.int(width),
 		height: C.int(height),
+		step:   C.int(step),
 		data:   toByteArray(data),
 	}
-	return MatVec3b{p: C.RawData_ToMatVec3b(cr)}
+	var cErr C.struct_Error
+	p := C.RawData_ToMatVec3b(cr, &cErr)
+	if err := toGoError(cErr); err != nil {
+		return MatVec3b{}, fmt.Errorf("%v: width=%d, height=%d, step=%d, length=%d",
+			err, width, height, step, len(data))
+	}
+	return MatVec3b{p: p}, nil
+}
+
+// NewMatVec3bOnCByteArray returns a new MatVec3b which refers the C byte
+// array as its data without copying. Drawing on the MatVec3b modifies buf.
+// buf must not be released until the returned MatVec3b is deleted.
+func NewMatVec3bOnCByteArray(width int, height int, step int, buf CByteArray) (
+	MatVec3b, error) {
+	cr := C.struct_RawData{
+		width:  C.int(width),
+		height: C.int(height),
+		step:   C.int(step),
+		data:   buf.b,
+	}
+	var cErr C.struct_Error
+	p := C.RawData_ViewMatVec3b(cr, &cErr)
+	if err := toGoError(cErr); err != nil {
+		return MatVec3b{}, fmt.Errorf("%v: width=%d, height=%d, step=%d, length=%d",
+			err, width, height, step, buf.Len())
+	}
+	return MatVec3b{p: p}, nil
 }
 
 // MatVec4b is a bind of `cv::Mat_<cv::Vec4b>`
@@ -98,21 +179,31 @@ func (m *MatVec4b) Delete() {
 	m.p = nil
 }
 
-// ToRawData converts MatVec4b to RawData.
-func (m *MatVec4b) ToRawData() (int, int, []byte) {
+// ToRawData converts MatVec4b to RawData. Returns width, height, step and
+// data, same as MatVec3b.
+func (m *MatVec4b) ToRawData() (int, int, int, []byte) {
 	r := C.MatVec4b_ToRawData(m.p)
-	return int(r.width), int(r.height), toGoBytes(r.data)
+	return int(r.width), int(r.height), int(r.step), toGoBytes(r.data)
 }
 
-// ToMatVec4b converts RawData to MatVec4b. Returned MatVec4b is required to
-// delete after using.
-func ToMatVec4b(width int, height int, data []byte) MatVec4b {
+// ToMatVec4b converts RawData to MatVec4b. step is the number of bytes of each
+// row, returns an error when data is too short for width, height and step.
+// data is copied same as ToMatVec3b. Returned MatVec4b is required to delete
+// after using.
+func ToMatVec4b(width int, height int, step int, data []byte) (MatVec4b, error) {
 	cr := C.struct_RawData{
 		width:  C.int(width),
 		height: C.int(height),
+		step:   C.int(step),
 		data:   toByteArray(data),
 	}
-	return MatVec4b{p: C.RawData_ToMatVec4b(cr)}
+	var cErr C.struct_Error
+	p := C.RawData_ToMatVec4b(cr, &cErr)
+	if err := toGoError(cErr); err != nil {
+		return MatVec4b{}, fmt.Errorf("%v: width=%d, height=%d, step=%d, length=%d",
+			err, width, height, step, len(data))
+	}
+	return MatVec4b{p: p}, nil
 }
 
 // VideoCapture is a bind of `cv::VideoCapture`.
@@ -131,26 +222,81 @@ func (v *VideoCapture) Delete() {
 	v.p = nil
 }
 
-// Open a video data and prepares to start capturing.
-func (v *VideoCapture) Open(uri string) bool {
+// Open a video data and prepares to start capturing. Returns an error when
+// the video data cannot be opened.
+func (v *VideoCapture) Open(uri string) error {
 	cURI := C.CString(uri)
 	defer C.free(unsafe.Pointer(cURI))
-	return C.VideoCapture_Open(v.p, cURI) != 0
+	var cErr C.struct_Error
+	ok := C.VideoCapture_Open(v.p, cURI, &cErr) != 0
+	if err := toGoError(cErr); err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("cannot open '%v'", uri)
+	}
+	return nil
 }
 
-// OpenDevice opens a video device and prepares to start capturing.
-func (v *VideoCapture) OpenDevice(device int) bool {
-	return C.VideoCapture_OpenDevice(v.p, C.int(device)) != 0
+// OpenDevice opens a video device and prepares to start capturing. Returns an
+// error when the device cannot be opened.
+func (v *VideoCapture) OpenDevice(device int) error {
+	var cErr C.struct_Error
+	ok := C.VideoCapture_OpenDevice(v.p, C.int(device), &cErr) != 0
+	if err := toGoError(cErr); err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("cannot open device %v", device)
+	}
+	return nil
+}
+
+// OpenWithAPI opens a video data with the backend specified by apiPreference,
+// e.g. CvCapFFmpeg. CvCapAny is same as Open.
+func (v *VideoCapture) OpenWithAPI(uri string, apiPreference int) error {
+	cURI := C.CString(uri)
+	defer C.free(unsafe.Pointer(cURI))
+	var cErr C.struct_Error
+	ok := C.VideoCapture_OpenWithAPI(v.p, cURI, C.int(apiPreference), &cErr) != 0
+	if err := toGoError(cErr); err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("cannot open '%v' with API preference %v", uri,
+			apiPreference)
+	}
+	return nil
+}
+
+// OpenDeviceWithAPI opens a video device with the backend specified by
+// apiPreference, e.g. CvCapV4L2. CvCapAny is same as OpenDevice.
+func (v *VideoCapture) OpenDeviceWithAPI(device int, apiPreference int) error {
+	var cErr C.struct_Error
+	ok := C.VideoCapture_OpenDeviceWithAPI(v.p, C.int(device),
+		C.int(apiPreference), &cErr) != 0
+	if err := toGoError(cErr); err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("cannot open device %v with API preference %v",
+			device, apiPreference)
+	}
+	return nil
 }
 
 // Release video capture object.
-func (v *VideoCapture) Release() {
-	C.VideoCapture_Release(v.p)
+func (v *VideoCapture) Release() error {
+	var cErr C.struct_Error
+	C.VideoCapture_Release(v.p, &cErr)
+	return toGoError(cErr)
 }
 
 // Set parameter with property (=key).
-func (v *VideoCapture) Set(prop int, param int) {
-	C.VideoCapture_Set(v.p, C.int(prop), C.int(param))
+func (v *VideoCapture) Set(prop int, param int) error {
+	var cErr C.struct_Error
+	C.VideoCapture_Set(v.p, C.int(prop), C.int(param), &cErr)
+	return toGoError(cErr)
 }
 
 // IsOpened returns the video capture opens a file(or device) or not.
@@ -161,13 +307,20 @@ func (v *VideoCapture) IsOpened() bool {
 
 // Read set frame to argument MatVec3b, returns `false` when the video capture
 // cannot read frame.
-func (v *VideoCapture) Read(m MatVec3b) bool {
-	return C.VideoCapture_Read(v.p, m.p) != 0
+func (v *VideoCapture) Read(m MatVec3b) (bool, error) {
+	var cErr C.struct_Error
+	ok := C.VideoCapture_Read(v.p, m.p, &cErr) != 0
+	if err := toGoError(cErr); err != nil {
+		return false, err
+	}
+	return ok, nil
 }
 
 // Grab `skip` count frames.
-func (v *VideoCapture) Grab(skip int) {
-	C.VideoCapture_Grab(v.p, C.int(skip))
+func (v *VideoCapture) Grab(skip int) error {
+	var cErr C.struct_Error
+	C.VideoCapture_Grab(v.p, C.int(skip), &cErr)
+	return toGoError(cErr)
 }
 
 // VideoWriter is a bind of `cv::VideoWriter`.
@@ -188,17 +341,22 @@ func (vw *VideoWriter) Delete() {
 }
 
 // Open a video writer.
-func (vw *VideoWriter) Open(name string, fps float64, width int, height int) {
+func (vw *VideoWriter) Open(name string, fps float64, width int, height int) error {
 	cName := C.CString(name)
 	defer C.free(unsafe.Pointer(cName))
-	C.VideoWriter_Open(vw.p, cName, C.double(fps), C.int(width), C.int(height))
+	var cErr C.struct_Error
+	C.VideoWriter_Open(vw.p, cName, C.double(fps), C.int(width), C.int(height),
+		&cErr)
+	return toGoError(cErr)
 }
 
 // OpenWithMat opens video writer.
-func (vw *VideoWriter) OpenWithMat(name string, fps float64, img MatVec3b) {
+func (vw *VideoWriter) OpenWithMat(name string, fps float64, img MatVec3b) error {
 	cName := C.CString(name)
 	defer C.free(unsafe.Pointer(cName))
-	C.VideoWriter_OpenWithMat(vw.p, cName, C.double(fps), img.p)
+	var cErr C.struct_Error
+	C.VideoWriter_OpenWithMat(vw.p, cName, C.double(fps), img.p, &cErr)
+	return toGoError(cErr)
 }
 
 // IsOpened returns the video writer opens a file or not.
@@ -208,10 +366,12 @@ func (vw *VideoWriter) IsOpened() bool {
 }
 
 // Write the image to file.
-func (vw *VideoWriter) Write(img MatVec3b) {
+func (vw *VideoWriter) Write(img MatVec3b) error {
 	vw.mu.Lock()
 	defer vw.mu.Unlock()
-	C.VideoWriter_Write(vw.p, img.p)
+	var cErr C.struct_Error
+	C.VideoWriter_Write(vw.p, img.p, &cErr)
+	return toGoError(cErr)
 }
 
 // CascadeClassifier is a bind of `cv::CascadeClassifier`
@@ -230,27 +390,291 @@ func (c *CascadeClassifier) Delete() {
 	c.p = nil
 }
 
-// Load cascade configuration file to classifier.
-func (c *CascadeClassifier) Load(name string) bool {
+// Load cascade configuration file to classifier. Returns an error when the
+// file cannot be loaded.
+func (c *CascadeClassifier) Load(name string) error {
 	cName := C.CString(name)
 	defer C.free(unsafe.Pointer(cName))
-	return C.CascadeClassifier_Load(c.p, cName) != 0
+	var cErr C.struct_Error
+	ok := C.CascadeClassifier_Load(c.p, cName, &cErr) != 0
+	if err := toGoError(cErr); err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("cannot load the file '%v'", name)
+	}
+	return nil
 }
 
-// Rect represents rectangle. X and Y is a start point of Width and Height.
-type Rect struct {
-	X      int
-	Y      int
-	Width  int
-	Height int
+// Equalization methods of an image before detection.
+const (
+	// EqualizeNone does not equalize the image.
+	EqualizeNone = iota
+	// EqualizeHist equalizes the histogram by `cv::equalizeHist`.
+	EqualizeHist
+	// EqualizeCLAHE equalizes the histogram by `cv::CLAHE`.
+	EqualizeCLAHE
+)
+
+// DetectMultiScaleParams is parameters of `cv::CascadeClassifier::
+// detectMultiScale`. Zero min or max size means no limit.
+//
+// The image is preprocessed before detection. Grayscale converts it to
+// grayscale, Equalize equalizes its histogram after converting to grayscale,
+// and Downscale larger than 1 shrinks it by the factor. Min and max size are
+// sizes on the original image, and detected rectangles are mapped back to
+// the original image.
+type DetectMultiScaleParams struct {
+	ScaleFactor  float64
+	MinNeighbors int
+	Flags        int
+	MinWidth     int
+	MinHeight    int
+	MaxWidth     int
+	MaxHeight    int
+
+	Grayscale      bool
+	Equalize       int
+	CLAHEClipLimit float64
+	CLAHETileSize  int
+	Downscale      float64
+}
+
+// NewDetectMultiScaleParams returns parameters which are same as OpenCV's
+// default values, without preprocessing.
+func NewDetectMultiScaleParams() DetectMultiScaleParams {
+	return DetectMultiScaleParams{
+		ScaleFactor:    1.1,
+		MinNeighbors:   3,
+		Equalize:       EqualizeNone,
+		CLAHEClipLimit: 2.0,
+		CLAHETileSize:  8,
+		Downscale:      1.0,
+	}
+}
+
+func (p *DetectMultiScaleParams) toC() C.struct_DetectMultiScaleParams {
+	return C.struct_DetectMultiScaleParams{
+		scaleFactor:  C.double(p.ScaleFactor),
+		minNeighbors: C.int(p.MinNeighbors),
+		flags:        C.int(p.Flags),
+		minWidth:     C.int(p.MinWidth),
+		minHeight:    C.int(p.MinHeight),
+		maxWidth:     C.int(p.MaxWidth),
+		maxHeight:    C.int(p.MaxHeight),
+
+		grayscale:      C.int(boolToInt(p.Grayscale)),
+		equalize:       C.int(p.Equalize),
+		claheClipLimit: C.double(p.CLAHEClipLimit),
+		claheTileSize:  C.int(p.CLAHETileSize),
+		downscale:      C.double(p.Downscale),
+	}
+}
+
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
 }
 
 // DetectMultiScale detects something which is decided by loaded file. Returns
 // multi results addressed with rectangle.
-func (c *CascadeClassifier) DetectMultiScale(img MatVec3b) []Rect {
-	ret := C.CascadeClassifier_DetectMultiScale(c.p, img.p)
+func (c *CascadeClassifier) DetectMultiScale(img MatVec3b) ([]Rect, error) {
+	return c.DetectMultiScaleWithParams(img, NewDetectMultiScaleParams())
+}
+
+// DetectRegion restricts detection to a region of an image. Only the part of
+// the image which is in ROI, in Polygon and where Mask is not zero is
+// scanned. ROI of zero size means the whole image. Polygon is optional, its
+// points are coordinates of the image. Mask is optional, it is required to be
+// CvType8UC1 and of the same size as the image when it is not empty.
+type DetectRegion struct {
+	ROI     Rect
+	Polygon []Point
+	Mask    Mat
+}
+
+// toC converts the region to C structure. The returned value refers Go
+// memory, it must not be kept by C/C++ after a call.
+func (r *DetectRegion) toC() C.struct_DetectRegion {
+	cr := C.struct_DetectRegion{
+		roi: C.struct_Rect{
+			x:      C.int(r.ROI.X),
+			y:      C.int(r.ROI.Y),
+			width:  C.int(r.ROI.Width),
+			height: C.int(r.ROI.Height),
+		},
+		mask: r.Mask.p,
+	}
+	if len(r.Polygon) > 0 {
+		cPoints := make([]C.struct_Point, len(r.Polygon))
+		for i, p := range r.Polygon {
+			cPoints[i] = C.struct_Point{x: C.int(p.X), y: C.int(p.Y)}
+		}
+		cr.polygon = C.struct_Points{
+			points: (*C.Point)(&cPoints[0]),
+			length: C.int(len(cPoints)),
+		}
+	}
+	return cr
+}
+
+// DetectMultiScaleWithParams detects something with parameters, see
+// DetectMultiScale.
+func (c *CascadeClassifier) DetectMultiScaleWithParams(img MatVec3b,
+	params DetectMultiScaleParams) ([]Rect, error) {
+	return c.DetectMultiScaleInRegion(img, params, DetectRegion{})
+}
+
+// DetectMultiScaleInRegion detects something in the region of the image.
+// Returned rectangles are coordinates of the whole image.
+func (c *CascadeClassifier) DetectMultiScaleInRegion(img MatVec3b,
+	params DetectMultiScaleParams, region DetectRegion) ([]Rect, error) {
+	var cErr C.struct_Error
+	ret := C.CascadeClassifier_DetectMultiScale(c.p, img.p, params.toC(),
+		region.toC(), &cErr)
+	if err := toGoError(cErr); err != nil {
+		return nil, err
+	}
 	defer C.Rects_Delete(ret)
+	return toGoRects(ret), nil
+}
+
+// DetectMultiScale3 detects something with parameters as same as
+// DetectMultiScaleWithParams, and returns reject levels and level weights of
+// each rectangle in addition. A larger weight means more confident.
+func (c *CascadeClassifier) DetectMultiScale3(img MatVec3b,
+	params DetectMultiScaleParams) ([]Rect, []int, []float64, error) {
+	return c.DetectMultiScale3InRegion(img, params, DetectRegion{})
+}
+
+// DetectMultiScale3InRegion detects something in the region of the image as
+// same as DetectMultiScale3. Returned rectangles are coordinates of the
+// whole image.
+func (c *CascadeClassifier) DetectMultiScale3InRegion(img MatVec3b,
+	params DetectMultiScaleParams, region DetectRegion) ([]Rect, []int,
+	[]float64, error) {
+	var cErr C.struct_Error
+	ret := C.CascadeClassifier_DetectMultiScale3(c.p, img.p, params.toC(),
+		region.toC(), &cErr)
+	if err := toGoError(cErr); err != nil {
+		return nil, nil, nil, err
+	}
+	defer C.ScoredRects_Delete(ret)
+
+	rects := toGoRects(C.struct_Rects{rects: ret.rects, length: ret.length})
+	length := int(ret.length)
+	return rects, toGoInts(ret.levels, length),
+		toGoFloat64s(ret.weights, length), nil
+}
+
+// HOGDescriptor is a bind of `cv::HOGDescriptor`
+type HOGDescriptor struct {
+	p C.HOGDescriptor
+}
 
+// NewHOGDescriptor returns a new HOGDescriptor with default window size
+// (64x128). An SVM detector is required to be set before detection.
+func NewHOGDescriptor() HOGDescriptor {
+	return HOGDescriptor{p: C.HOGDescriptor_New()}
+}
+
+// Delete HOGDescriptor's pointer.
+func (h *HOGDescriptor) Delete() {
+	C.HOGDescriptor_Delete(h.p)
+	h.p = nil
+}
+
+// Load a descriptor file saved by `cv::HOGDescriptor::save`, which has the
+// window size and the SVM detector. Returns an error when the file cannot be
+// loaded.
+func (h *HOGDescriptor) Load(name string) error {
+	cName := C.CString(name)
+	defer C.free(unsafe.Pointer(cName))
+	var cErr C.struct_Error
+	ok := C.HOGDescriptor_Load(h.p, cName, &cErr) != 0
+	if err := toGoError(cErr); err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("cannot load the file '%v'", name)
+	}
+	return nil
+}
+
+// SetDefaultPeopleDetector sets OpenCV's default people detector, which is
+// trained with 64x128 windows.
+func (h *HOGDescriptor) SetDefaultPeopleDetector() error {
+	var cErr C.struct_Error
+	C.HOGDescriptor_SetDefaultPeopleDetector(h.p, &cErr)
+	return toGoError(cErr)
+}
+
+// SetDaimlerPeopleDetector sets OpenCV's Daimler people detector, the window
+// size is changed to 48x96.
+func (h *HOGDescriptor) SetDaimlerPeopleDetector() error {
+	var cErr C.struct_Error
+	C.HOGDescriptor_SetDaimlerPeopleDetector(h.p, &cErr)
+	return toGoError(cErr)
+}
+
+// HOGDetectParams is parameters of `cv::HOGDescriptor::detectMultiScale`.
+type HOGDetectParams struct {
+	HitThreshold         float64
+	WinStrideWidth       int
+	WinStrideHeight      int
+	PaddingWidth         int
+	PaddingHeight        int
+	Scale                float64
+	FinalThreshold       float64
+	UseMeanshiftGrouping bool
+}
+
+// NewHOGDetectParams returns parameters which are same as OpenCV's default
+// values.
+func NewHOGDetectParams() HOGDetectParams {
+	return HOGDetectParams{
+		WinStrideWidth:  8,
+		WinStrideHeight: 8,
+		Scale:           1.05,
+		FinalThreshold:  2.0,
+	}
+}
+
+func (p *HOGDetectParams) toC() C.struct_HOGDetectParams {
+	return C.struct_HOGDetectParams{
+		hitThreshold:         C.double(p.HitThreshold),
+		winStrideWidth:       C.int(p.WinStrideWidth),
+		winStrideHeight:      C.int(p.WinStrideHeight),
+		paddingWidth:         C.int(p.PaddingWidth),
+		paddingHeight:        C.int(p.PaddingHeight),
+		scale:                C.double(p.Scale),
+		finalThreshold:       C.double(p.FinalThreshold),
+		useMeanshiftGrouping: C.int(boolToInt(p.UseMeanshiftGrouping)),
+	}
+}
+
+// DetectMultiScale detects objects with the parameters, and returns
+// rectangles and weights of them. A larger weight means more confident.
+// `cv::HOGDescriptor::detectMultiScale` is a const method, so a descriptor can
+// be used by multiple goroutines concurrently.
+func (h *HOGDescriptor) DetectMultiScale(img MatVec3b,
+	params HOGDetectParams) ([]Rect, []float64, error) {
+	var cErr C.struct_Error
+	ret := C.HOGDescriptor_DetectMultiScale(h.p, img.p, params.toC(), &cErr)
+	if err := toGoError(cErr); err != nil {
+		return nil, nil, err
+	}
+	defer C.ScoredRects_Delete(ret)
+
+	rects := toGoRects(C.struct_Rects{rects: ret.rects, length: ret.length})
+	return rects, toGoFloat64s(ret.weights, int(ret.length)), nil
+}
+
+// toGoRects converts rects allocated by C/C++ to Go. ret is still required to
+// be deleted by the caller.
+func toGoRects(ret C.struct_Rects) []Rect {
 	cArray := ret.rects
 	length := int(ret.length)
 	hdr := reflect.SliceHeader{
@@ -272,8 +696,12 @@ func (c *CascadeClassifier) DetectMultiScale(img MatVec3b) []Rect {
 	return rects
 }
 
-// DrawRectsToImage draws rectangle information to target image.
-func DrawRectsToImage(img MatVec3b, rects []Rect) {
+// toCRects converts rects to C structure. The returned value refers Go
+// memory, it must not be kept by C/C++ after a call.
+func toCRects(rects []Rect) C.struct_Rects {
+	if len(rects) == 0 {
+		return C.struct_Rects{}
+	}
 	cRectArray := make([]C.struct_Rect, len(rects))
 	for i, r := range rects {
 		cRect := C.struct_Rect{
@@ -284,36 +712,109 @@ func DrawRectsToImage(img MatVec3b, rects []Rect) {
 		}
 		cRectArray[i] = cRect
 	}
-	cRects := C.struct_Rects{
+	return C.struct_Rects{
 		rects:  (*C.Rect)(&cRectArray[0]),
 		length: C.int(len(rects)),
 	}
-	C.DrawRectsToImage(img.p, cRects)
 }
 
-// LoadAlphaImage loads RGBA type image.
-func LoadAlphaImage(name string) MatVec4b {
+// DrawRectsToImage draws rectangle information to target image.
+func DrawRectsToImage(img MatVec3b, rects []Rect) error {
+	var cErr C.struct_Error
+	C.DrawRectsToImage(img.p, toCRects(rects), &cErr)
+	return toGoError(cErr)
+}
+
+// GroupRectangles clusters similar rectangles by `cv::groupRectangles` and
+// returns the average rectangle of each cluster and the number of rectangles
+// in it. Clusters which have groupThreshold or fewer rectangles are rejected.
+// eps is the relative difference of sides to merge rectangles, e.g. 0.2.
+func GroupRectangles(rects []Rect, groupThreshold int, eps float64) ([]Rect,
+	[]int, error) {
+	var cErr C.struct_Error
+	ret := C.Rects_Group(toCRects(rects), C.int(groupThreshold), C.double(eps),
+		&cErr)
+	if err := toGoError(cErr); err != nil {
+		return nil, nil, err
+	}
+	defer C.ScoredRects_Delete(ret)
+
+	rects = toGoRects(C.struct_Rects{rects: ret.rects, length: ret.length})
+	return rects, toGoInts(ret.levels, int(ret.length)), nil
+}
+
+// ForegroundRects returns bounding rectangles of foreground regions in a
+// CV_8UC1 mask, where pixels of 255 are foreground. Regions whose contour
+// area is less than minArea are ignored.
+func ForegroundRects(mask Mat, minArea float64) ([]Rect, error) {
+	var cErr C.struct_Error
+	ret := C.Mat_ForegroundRects(mask.p, C.double(minArea), &cErr)
+	if err := toGoError(cErr); err != nil {
+		return nil, err
+	}
+	defer C.Rects_Delete(ret)
+	return toGoRects(ret), nil
+}
+
+// ToBlurredGray returns a CV_8UC1 grayscale image of img smoothed by a
+// Gaussian filter of blurSize, which is required to be odd. blurSize of 0 or
+// 1 does not smooth the image. The returned Mat is required to be deleted
+// after using.
+func ToBlurredGray(img MatVec3b, blurSize int) (Mat, error) {
+	var cErr C.struct_Error
+	p := C.MatVec3b_ToBlurredGray(img.p, C.int(blurSize), &cErr)
+	if err := toGoError(cErr); err != nil {
+		return Mat{}, err
+	}
+	return Mat{p: p}, nil
+}
+
+// DiffMask returns a CV_8UC1 mask whose pixels are 255 where the absolute
+// difference of a and b is larger than threshold, and 0 elsewhere. The mask
+// is dilated dilate times to merge near regions. The returned Mat is required
+// to be deleted after using.
+func DiffMask(a Mat, b Mat, threshold float64, dilate int) (Mat, error) {
+	var cErr C.struct_Error
+	p := C.Mat_DiffMask(a.p, b.p, C.double(threshold), C.int(dilate), &cErr)
+	if err := toGoError(cErr); err != nil {
+		return Mat{}, err
+	}
+	return Mat{p: p}, nil
+}
+
+// LoadAlphaImage loads RGBA type image. When the file does not exist, returns
+// an empty image. Returns an error when the file cannot be read as RGBA
+// image.
+func LoadAlphaImage(name string) (MatVec4b, error) {
 	cName := C.CString(name)
 	defer C.free(unsafe.Pointer(cName))
-	return MatVec4b{p: C.LoadAlphaImg(cName)}
+	var cErr C.struct_Error
+	p := C.LoadAlphaImg(cName, &cErr)
+	if err := toGoError(cErr); err != nil {
+		return MatVec4b{}, err
+	}
+	return MatVec4b{p: p}, nil
 }
 
 // MountAlphaImage draws img on back leading to rects. img is required RGBA,
 // TODO should be check file type.
-func MountAlphaImage(img MatVec4b, back MatVec3b, rects []Rect) {
-	cRectArray := make([]C.struct_Rect, len(rects))
-	for i, r := range rects {
-		cRect := C.struct_Rect{
-			x:      C.int(r.X),
-			y:      C.int(r.Y),
-			width:  C.int(r.Width),
-			height: C.int(r.Height),
-		}
-		cRectArray[i] = cRect
-	}
-	cRects := C.struct_Rects{
-		rects:  (*C.Rect)(&cRectArray[0]),
-		length: C.int(len(rects)),
-	}
-	C.MountAlphaImage(img.p, back.p, cRects)
+func MountAlphaImage(img MatVec4b, back MatVec3b, rects []Rect) error {
+	var cErr C.struct_Error
+	C.MountAlphaImage(img.p, back.p, toCRects(rects), &cErr)
+	return toGoError(cErr)
+}
+
+// Version returns the version string of linked OpenCV, e.g. "3.4.1".
+func Version() string {
+	b := C.OpenCV_Version()
+	defer C.ByteArray_Release(b)
+	return string(toGoBytes(b))
+}
+
+// BuildInformation returns the build information of linked OpenCV, which
+// includes enabled modules and video I/O backends.
+func BuildInformation() string {
+	b := C.OpenCV_BuildInformation()
+	defer C.ByteArray_Release(b)
+	return string(toGoBytes(b))
 }
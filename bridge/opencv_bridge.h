@@ -4,13 +4,33 @@
 #include "util.h"
 
 #ifdef __cplusplus
-#include <opencv2/opencv.hpp>
+#include <opencv2/core.hpp>
+#include <opencv2/imgcodecs.hpp>
+#include <opencv2/imgproc.hpp>
+#include <opencv2/objdetect.hpp>
+#include <opencv2/videoio.hpp>
+
+// BRIDGE_TRY and BRIDGE_CATCH surround a body of bridge function, C++
+// exceptions must not be thrown over C functions called from Go. A caught
+// exception is set to `err` and the function returns a zero value after
+// BRIDGE_CATCH.
+#define BRIDGE_TRY try {
+#define BRIDGE_CATCH(err) \
+  } catch (const cv::Exception& e) { \
+    Error_Set(err, e.what()); \
+  } catch (const std::exception& e) { \
+    Error_Set(err, e.what()); \
+  } catch (...) { \
+    Error_Set(err, "unknown C++ exception"); \
+  }
+
 extern "C" {
 #endif
 
 typedef struct RawData {
   int width;
   int height;
+  int step;
   struct ByteArray data;
 } RawData;
 typedef struct Rect {
@@ -19,64 +39,163 @@ typedef struct Rect {
   int width;
   int height;
 } Rect;
+typedef struct Point {
+  int x;
+  int y;
+} Point;
+typedef struct Points {
+  Point* points;
+  int length;
+} Points;
 typedef struct Rects {
   Rect* rects;
   int length;
 } Rects;
+typedef struct ScoredRects {
+  Rect* rects;
+  int* levels;
+  double* weights;
+  int length;
+} ScoredRects;
+typedef struct DetectMultiScaleParams {
+  double scaleFactor;
+  int minNeighbors;
+  int flags;
+  int minWidth;
+  int minHeight;
+  int maxWidth;
+  int maxHeight;
+  int grayscale;
+  int equalize;
+  double claheClipLimit;
+  int claheTileSize;
+  double downscale;
+} DetectMultiScaleParams;
+typedef struct HOGDetectParams {
+  double hitThreshold;
+  int winStrideWidth;
+  int winStrideHeight;
+  int paddingWidth;
+  int paddingHeight;
+  double scale;
+  double finalThreshold;
+  int useMeanshiftGrouping;
+} HOGDetectParams;
 
 #ifdef __cplusplus
+typedef cv::Mat* Mat;
 typedef cv::Mat_<cv::Vec3b>* MatVec3b;
 typedef cv::Mat_<cv::Vec4b>* MatVec4b;
 typedef cv::VideoCapture* VideoCapture;
 typedef cv::VideoWriter* VideoWriter;
 typedef cv::CascadeClassifier* CascadeClassifier;
+typedef cv::HOGDescriptor* HOGDescriptor;
 #else
+typedef void* Mat;
 typedef void* MatVec3b;
 typedef void* MatVec4b;
 typedef void* VideoCapture;
 typedef void* VideoWriter;
 typedef void* CascadeClassifier;
+typedef void* HOGDescriptor;
 #endif
 
+// DetectRegion restricts detection to a region of an image. roi of zero size
+// means the whole image. polygon and mask are optional, mask is NULL or a
+// CV_8UC1 Mat of the same size as the image.
+typedef struct DetectRegion {
+  Rect roi;
+  struct Points polygon;
+  Mat mask;
+} DetectRegion;
+
+Mat Mat_New();
+Mat Mat_NewWithSize(int rows, int cols, int type, struct Error* err);
+void Mat_Delete(Mat m);
+int Mat_Rows(Mat m);
+int Mat_Cols(Mat m);
+int Mat_Type(Mat m);
+int Mat_Empty(Mat m);
+struct RawData Mat_ToRawData(Mat m);
+Mat RawData_ToMat(struct RawData r, int type, struct Error* err);
+
 MatVec3b MatVec3b_New();
-struct ByteArray MatVec3b_ToJpegData(MatVec3b m, int quality);
+struct ByteArray MatVec3b_ToJpegData(MatVec3b m, int quality,
+  struct Error* err);
 void MatVec3b_Delete(MatVec3b m);
-void MatVec3b_CopyTo(MatVec3b src, MatVec3b dst);
+void MatVec3b_CopyTo(MatVec3b src, MatVec3b dst, struct Error* err);
 int MatVec3b_Empty(MatVec3b m);
 struct RawData MatVec3b_ToRawData(MatVec3b m);
-MatVec3b RawData_ToMatVec3b(struct RawData r);
+MatVec3b RawData_ToMatVec3b(struct RawData r, struct Error* err);
+MatVec3b RawData_ViewMatVec3b(struct RawData r, struct Error* err);
+void MatVec3b_CopyFromRawData(MatVec3b m, struct RawData r,
+  struct Error* err);
 
 void MatVec4b_Delete(MatVec4b m);
 struct RawData MatVec4b_ToRawData(MatVec4b m);
-MatVec4b RawData_ToMatVec4b(struct RawData r);
+MatVec4b RawData_ToMatVec4b(struct RawData r, struct Error* err);
 
 VideoCapture VideoCapture_New();
 void VideoCapture_Delete(VideoCapture v);
-int VideoCapture_Open(VideoCapture v, const char* uri);
-int VideoCapture_OpenDevice(VideoCapture v, int device);
-void VideoCapture_Release(VideoCapture v);
-void VideoCapture_Set(VideoCapture v, int prop, int param);
+int VideoCapture_Open(VideoCapture v, const char* uri, struct Error* err);
+int VideoCapture_OpenDevice(VideoCapture v, int device,
+  struct Error* err);
+int VideoCapture_OpenWithAPI(VideoCapture v, const char* uri,
+  int apiPreference, struct Error* err);
+int VideoCapture_OpenDeviceWithAPI(VideoCapture v, int device,
+  int apiPreference, struct Error* err);
+void VideoCapture_Release(VideoCapture v, struct Error* err);
+void VideoCapture_Set(VideoCapture v, int prop, int param,
+  struct Error* err);
 int VideoCapture_IsOpened(VideoCapture v);
-int VideoCapture_Read(VideoCapture v, MatVec3b buf);
-void VideoCapture_Grab(VideoCapture v, int skip);
+int VideoCapture_Read(VideoCapture v, MatVec3b buf, struct Error* err);
+void VideoCapture_Grab(VideoCapture v, int skip, struct Error* err);
 
 VideoWriter VideoWriter_New();
 void VideoWriter_Delete(VideoWriter vw);
 void VideoWriter_Open(VideoWriter vw, const char* name, double fps, int width,
-  int height);
+  int height, struct Error* err);
 void VideoWriter_OpenWithMat(VideoWriter vw, const char* name, double fps,
-  MatVec3b img);
+  MatVec3b img, struct Error* err);
 int VideoWriter_IsOpened(VideoWriter vw);
-void VideoWriter_Write(VideoWriter vw, MatVec3b img);
+void VideoWriter_Write(VideoWriter vw, MatVec3b img, struct Error* err);
 
 CascadeClassifier CascadeClassifier_New();
 void CascadeClassifier_Delete(CascadeClassifier cs);
-int CascadeClassifier_Load(CascadeClassifier cs, const char* name);
-struct Rects CascadeClassifier_DetectMultiScale(CascadeClassifier cs, MatVec3b img);
+int CascadeClassifier_Load(CascadeClassifier cs, const char* name,
+  struct Error* err);
+struct Rects CascadeClassifier_DetectMultiScale(CascadeClassifier cs, MatVec3b img,
+  struct DetectMultiScaleParams params, struct DetectRegion region,
+  struct Error* err);
+struct ScoredRects CascadeClassifier_DetectMultiScale3(CascadeClassifier cs,
+  MatVec3b img, struct DetectMultiScaleParams params,
+  struct DetectRegion region, struct Error* err);
+
+HOGDescriptor HOGDescriptor_New();
+void HOGDescriptor_Delete(HOGDescriptor hog);
+int HOGDescriptor_Load(HOGDescriptor hog, const char* name, struct Error* err);
+void HOGDescriptor_SetDefaultPeopleDetector(HOGDescriptor hog,
+  struct Error* err);
+void HOGDescriptor_SetDaimlerPeopleDetector(HOGDescriptor hog,
+  struct Error* err);
+struct ScoredRects HOGDescriptor_DetectMultiScale(HOGDescriptor hog,
+  MatVec3b img, struct HOGDetectParams params, struct Error* err);
+
 void Rects_Delete(struct Rects rs);
-void DrawRectsToImage(MatVec3b img, struct Rects rects);
-MatVec4b LoadAlphaImg(const char* name);
-void MountAlphaImage(MatVec4b img, MatVec3b back, struct Rects rects);
+void ScoredRects_Delete(struct ScoredRects rs);
+void DrawRectsToImage(MatVec3b img, struct Rects rects, struct Error* err);
+struct ScoredRects Rects_Group(struct Rects rects, int groupThreshold,
+  double eps, struct Error* err);
+struct Rects Mat_ForegroundRects(Mat mask, double minArea, struct Error* err);
+Mat MatVec3b_ToBlurredGray(MatVec3b img, int blurSize, struct Error* err);
+Mat Mat_DiffMask(Mat a, Mat b, double threshold, int dilate,
+  struct Error* err);
+MatVec4b LoadAlphaImg(const char* name, struct Error* err);
+void MountAlphaImage(MatVec4b img, MatVec3b back, struct Rects rects,
+  struct Error* err);
+
+struct ByteArray OpenCV_Version();
+struct ByteArray OpenCV_BuildInformation();
 
 #ifdef __cplusplus
 }
@@ -0,0 +1,22 @@
+package bridge
+
+// Rect represents rectangle. X and Y is a start point of Width and Height.
+// Rect does not depend on cgo, it can be used without OpenCV.
+type Rect struct {
+	X      int
+	Y      int
+	Width  int
+	Height int
+}
+
+// Point represents a point of an image.
+type Point struct {
+	X int
+	Y int
+}
+
+// Point2f represents a point of an image in sub-pixel accuracy.
+type Point2f struct {
+	X float32
+	Y float32
+}
@@ -0,0 +1,9 @@
+package bridge
+
+// Tensor is an output blob of a layer. Data is in row-major order of Shape.
+// Tensor does not depend on cgo, outputs can be decoded without OpenCV.
+type Tensor struct {
+	Name  string
+	Shape []int
+	Data  []float32
+}
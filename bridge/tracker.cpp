@@ -0,0 +1,117 @@
+#include "tracker.h"
+
+#include <cstring>
+#include <string>
+
+// CSRT is available in OpenCV 3.4.1 or later.
+#if CV_VERSION_MAJOR > 3 || (CV_VERSION_MAJOR == 3 && \
+  (CV_VERSION_MINOR > 4 || (CV_VERSION_MINOR == 4 && CV_VERSION_REVISION >= 1)))
+#define BRIDGE_HAS_CSRT
+#endif
+
+// trackerNames are names of trackers which can be created in this build,
+// separated by commas.
+static const char* trackerNames =
+#if defined(BRIDGE_TRACKER_RECT_API) && !defined(HAVE_OPENCV_TRACKING)
+  "MIL";
+#elif defined(HAVE_OPENCV_TRACKING) && defined(BRIDGE_HAS_CSRT)
+  "KCF,CSRT,MIL";
+#elif defined(HAVE_OPENCV_TRACKING)
+  "KCF,MIL";
+#else
+  "";
+#endif
+
+#ifdef BRIDGE_HAS_TRACKER
+// createTracker returns a tracker of the name, or an empty pointer when the
+// tracker is not available.
+static cv::Ptr<cv::Tracker> createTracker(const std::string& name) {
+#if defined(BRIDGE_TRACKER_RECT_API) || \
+  CV_VERSION_MAJOR > 3 || (CV_VERSION_MAJOR == 3 && CV_VERSION_MINOR >= 3)
+  if (name == "MIL") {
+    return cv::TrackerMIL::create();
+  }
+#ifdef HAVE_OPENCV_TRACKING
+  if (name == "KCF") {
+    return cv::TrackerKCF::create();
+  }
+#ifdef BRIDGE_HAS_CSRT
+  if (name == "CSRT") {
+    return cv::TrackerCSRT::create();
+  }
+#endif
+#endif
+#else
+  // trackers are created by names before OpenCV 3.3
+  if (name == "MIL" || name == "KCF") {
+    return cv::Tracker::create(name);
+  }
+#endif
+  return cv::Ptr<cv::Tracker>();
+}
+#endif
+
+struct ByteArray Tracker_Available() {
+  return toByteArray(trackerNames, strlen(trackerNames));
+}
+
+Tracker Tracker_New(const char* name, struct Error* err) {
+  BRIDGE_TRY
+#ifdef BRIDGE_HAS_TRACKER
+    cv::Ptr<cv::Tracker> t = createTracker(name);
+    if (t.empty()) {
+      std::string message = std::string("'") + name +
+        "' tracker is not available, available trackers are: " + trackerNames;
+      Error_Set(err, message.c_str());
+      return NULL;
+    }
+    return new cv::Ptr<cv::Tracker>(t);
+#else
+    Error_Set(err, "tracker requires the tracking module of opencv_contrib");
+#endif
+  BRIDGE_CATCH(err)
+  return NULL;
+}
+
+void Tracker_Delete(Tracker t) {
+#ifdef BRIDGE_HAS_TRACKER
+  delete t;
+#endif
+}
+
+void Tracker_Init(Tracker t, MatVec3b img, struct Rect rect,
+    struct Error* err) {
+  BRIDGE_TRY
+#if defined(BRIDGE_TRACKER_RECT_API)
+    (*t)->init(*img, cv::Rect(rect.x, rect.y, rect.width, rect.height));
+#elif defined(BRIDGE_HAS_TRACKER)
+    if (!(*t)->init(*img,
+        cv::Rect2d(rect.x, rect.y, rect.width, rect.height))) {
+      Error_Set(err, "cannot initialize the tracker");
+    }
+#endif
+  BRIDGE_CATCH(err)
+}
+
+int Tracker_Update(Tracker t, MatVec3b img, struct Rect* rect,
+    struct Error* err) {
+  BRIDGE_TRY
+#if defined(BRIDGE_TRACKER_RECT_API)
+    cv::Rect box;
+    bool ok = (*t)->update(*img, box);
+#elif defined(BRIDGE_HAS_TRACKER)
+    cv::Rect2d box2d;
+    bool ok = (*t)->update(*img, box2d);
+    cv::Rect box(cvRound(box2d.x), cvRound(box2d.y), cvRound(box2d.width),
+      cvRound(box2d.height));
+#endif
+#ifdef BRIDGE_HAS_TRACKER
+    rect->x = box.x;
+    rect->y = box.y;
+    rect->width = box.width;
+    rect->height = box.height;
+    return ok;
+#endif
+  BRIDGE_CATCH(err)
+  return 0;
+}
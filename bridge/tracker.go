@@ -0,0 +1,85 @@
+package bridge
+
+/*
+#include <stdlib.h>
+#include "tracker.h"
+*/
+import "C"
+import (
+	"strings"
+	"unsafe"
+)
+
+// Tracker is a bind of `cv::Tracker`, which tracks a single object in frames.
+type Tracker struct {
+	p C.Tracker
+}
+
+// AvailableTrackers returns names of tracker algorithms which can be created
+// with the linked OpenCV, e.g. "KCF", "CSRT" and "MIL". KCF and CSRT require
+// the tracking module of opencv_contrib.
+func AvailableTrackers() []string {
+	b := C.Tracker_Available()
+	defer C.ByteArray_Release(b)
+	names := string(toGoBytes(b))
+	if names == "" {
+		return []string{}
+	}
+	return strings.Split(names, ",")
+}
+
+// NewTracker returns a new Tracker of the algorithm, which is one of
+// AvailableTrackers. The tracker is required to be initialized by Init before
+// Update.
+func NewTracker(algorithm string) (Tracker, error) {
+	cName := C.CString(algorithm)
+	defer C.free(unsafe.Pointer(cName))
+	var cErr C.struct_Error
+	p := C.Tracker_New(cName, &cErr)
+	if err := toGoError(cErr); err != nil {
+		return Tracker{}, err
+	}
+	return Tracker{p: p}, nil
+}
+
+// Delete Tracker's pointer.
+func (t *Tracker) Delete() {
+	C.Tracker_Delete(t.p)
+	t.p = nil
+}
+
+// Init initializes the tracker with the bounding rectangle of the object in
+// the image. A tracker cannot be initialized twice, create a new tracker to
+// track another rectangle.
+func (t *Tracker) Init(img MatVec3b, rect Rect) error {
+	var cErr C.struct_Error
+	C.Tracker_Init(t.p, img.p, toCRect(rect), &cErr)
+	return toGoError(cErr)
+}
+
+// Update finds the object in the next frame and returns its new bounding
+// rectangle. The returned flag is false when the object is lost, the
+// rectangle is meaningless in that case.
+func (t *Tracker) Update(img MatVec3b) (Rect, bool, error) {
+	var cErr C.struct_Error
+	var cRect C.struct_Rect
+	ok := C.Tracker_Update(t.p, img.p, &cRect, &cErr)
+	if err := toGoError(cErr); err != nil {
+		return Rect{}, false, err
+	}
+	return Rect{
+		X:      int(cRect.x),
+		Y:      int(cRect.y),
+		Width:  int(cRect.width),
+		Height: int(cRect.height),
+	}, ok != 0, nil
+}
+
+func toCRect(r Rect) C.struct_Rect {
+	return C.struct_Rect{
+		x:      C.int(r.X),
+		y:      C.int(r.Y),
+		width:  C.int(r.Width),
+		height: C.int(r.Height),
+	}
+}
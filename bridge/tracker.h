@@ -0,0 +1,42 @@
+#ifndef _OPENCV_BRIDGE_TRACKER_H_
+#define _OPENCV_BRIDGE_TRACKER_H_
+
+#include "opencv_bridge.h"
+
+#ifdef __cplusplus
+#include <opencv2/opencv_modules.hpp>
+#include <opencv2/video.hpp>
+// cv::Tracker is in the video module and uses cv::Rect since OpenCV 4.5.1,
+// MIL is built in. Trackers of older versions and KCF/CSRT of all versions
+// are in the tracking module of opencv_contrib.
+#if CV_VERSION_MAJOR > 4 || (CV_VERSION_MAJOR == 4 && \
+  (CV_VERSION_MINOR > 5 || (CV_VERSION_MINOR == 5 && CV_VERSION_REVISION >= 1)))
+#define BRIDGE_TRACKER_RECT_API
+#define BRIDGE_HAS_TRACKER
+#elif defined(HAVE_OPENCV_TRACKING)
+#define BRIDGE_HAS_TRACKER
+#endif
+#ifdef HAVE_OPENCV_TRACKING
+#include <opencv2/tracking.hpp>
+#endif
+extern "C" {
+#endif
+
+#if defined(__cplusplus) && defined(BRIDGE_HAS_TRACKER)
+typedef cv::Ptr<cv::Tracker>* Tracker;
+#else
+typedef void* Tracker;
+#endif
+
+struct ByteArray Tracker_Available();
+Tracker Tracker_New(const char* name, struct Error* err);
+void Tracker_Delete(Tracker t);
+void Tracker_Init(Tracker t, MatVec3b img, struct Rect rect, struct Error* err);
+int Tracker_Update(Tracker t, MatVec3b img, struct Rect* rect,
+  struct Error* err);
+
+#ifdef __cplusplus
+}
+#endif
+
+#endif //_OPENCV_BRIDGE_TRACKER_H_
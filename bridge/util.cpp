@@ -11,3 +11,16 @@ struct ByteArray toByteArray(const char* buf, int len) {
   memcpy(ret.data, buf, len);
   return ret;
 }
+
+void Error_Set(struct Error* err, const char* message) {
+  if (err == NULL) {
+    return;
+  }
+  int len = strlen(message);
+  err->message = new char[len + 1];
+  memcpy(err->message, message, len + 1);
+}
+
+void Error_Release(struct Error err) {
+  delete[] err.message;
+}
@@ -6,10 +6,18 @@ package bridge
 */
 import "C"
 import (
+	"errors"
+	"reflect"
 	"unsafe"
 )
 
+// toByteArray returns a view of Go byte slice to pass it to C/C++. Following
+// cgo pointer passing rules, C/C++ implementation must not keep the pointer
+// after the call returns, copy the data when it is needed later.
 func toByteArray(b []byte) C.struct_ByteArray {
+	if len(b) == 0 {
+		return C.struct_ByteArray{}
+	}
 	return C.struct_ByteArray{
 		data:   (*C.char)(unsafe.Pointer(&b[0])),
 		length: C.int(len(b)),
@@ -20,3 +28,122 @@ func toByteArray(b []byte) C.struct_ByteArray {
 func toGoBytes(b C.struct_ByteArray) []byte {
 	return C.GoBytes(unsafe.Pointer(b.data), b.length)
 }
+
+// copyFromByteArray copies binary data to dst and returns it. When the
+// capacity of dst is not enough, a new slice is allocated.
+func copyFromByteArray(dst []byte, b C.struct_ByteArray) []byte {
+	length := int(b.length)
+	if cap(dst) < length {
+		dst = make([]byte, length)
+	}
+	dst = dst[:length]
+	if length == 0 {
+		return dst
+	}
+	hdr := reflect.SliceHeader{
+		Data: uintptr(unsafe.Pointer(b.data)),
+		Len:  length,
+		Cap:  length,
+	}
+	copy(dst, *(*[]byte)(unsafe.Pointer(&hdr)))
+	return dst
+}
+
+// toGoError converts an error set by C/C++ implementation to Go error and
+// releases the C error. Returns nil when no error is set.
+func toGoError(e C.struct_Error) error {
+	if e.message == nil {
+		return nil
+	}
+	defer C.Error_Release(e)
+	return errors.New(C.GoString(e.message))
+}
+
+// CByteArray is a byte array allocated on C heap. Unlike Go byte slices, C/C++
+// objects like cv::Mat can refer to it after a cgo call returns, so it can be
+// used as a frame buffer shared between Go and C/C++ without copying. It is
+// NOT managed by Go GC, user must call Release after all objects referring to
+// it are deleted.
+type CByteArray struct {
+	b C.struct_ByteArray
+}
+
+// NewCByteArray copies Go byte slice to a new CByteArray.
+func NewCByteArray(b []byte) CByteArray {
+	if len(b) == 0 {
+		return CByteArray{}
+	}
+	return CByteArray{
+		b: C.toByteArray((*C.char)(unsafe.Pointer(&b[0])), C.int(len(b))),
+	}
+}
+
+// Len returns the length of the array.
+func (b *CByteArray) Len() int {
+	return int(b.b.length)
+}
+
+// Bytes returns a copy of the array as Go byte slice.
+func (b *CByteArray) Bytes() []byte {
+	if b.b.data == nil {
+		return []byte{}
+	}
+	return toGoBytes(b.b)
+}
+
+// Release the array.
+func (b *CByteArray) Release() {
+	if b.b.data == nil {
+		return
+	}
+	C.ByteArray_Release(b.b)
+	b.b = C.struct_ByteArray{}
+}
+
+// toGoInts converts an int array allocated by C/C++ to Go.
+func toGoInts(p *C.int, length int) []int {
+	hdr := reflect.SliceHeader{
+		Data: uintptr(unsafe.Pointer(p)),
+		Len:  length,
+		Cap:  length,
+	}
+	cArray := *(*[]C.int)(unsafe.Pointer(&hdr))
+
+	ret := make([]int, length)
+	for i, v := range cArray {
+		ret[i] = int(v)
+	}
+	return ret
+}
+
+// toGoFloat32s converts a float array allocated by C/C++ to Go.
+func toGoFloat32s(p *C.float, length int) []float32 {
+	hdr := reflect.SliceHeader{
+		Data: uintptr(unsafe.Pointer(p)),
+		Len:  length,
+		Cap:  length,
+	}
+	cArray := *(*[]C.float)(unsafe.Pointer(&hdr))
+
+	ret := make([]float32, length)
+	for i, v := range cArray {
+		ret[i] = float32(v)
+	}
+	return ret
+}
+
+// toGoFloat64s converts a double array allocated by C/C++ to Go.
+func toGoFloat64s(p *C.double, length int) []float64 {
+	hdr := reflect.SliceHeader{
+		Data: uintptr(unsafe.Pointer(p)),
+		Len:  length,
+		Cap:  length,
+	}
+	cArray := *(*[]C.double)(unsafe.Pointer(&hdr))
+
+	ret := make([]float64, length)
+	for i, v := range cArray {
+		ret[i] = float64(v)
+	}
+	return ret
+}
@@ -13,9 +13,14 @@ typedef struct ByteArray{
   char *data;
   int length;
 } ByteArray;
+typedef struct Error {
+  char* message;
+} Error;
 
 struct ByteArray toByteArray(const char* buf, int len);
 void ByteArray_Release(struct ByteArray buf);
+void Error_Set(struct Error* err, const char* message);
+void Error_Release(struct Error err);
 
 #ifdef __cplusplus
 }
@@ -0,0 +1,141 @@
+#include "video.h"
+
+BackgroundSubtractor BackgroundSubtractor_NewMOG2(int history,
+    double varThreshold, int detectShadows, struct Error* err) {
+  BRIDGE_TRY
+    return new cv::Ptr<cv::BackgroundSubtractor>(
+      cv::createBackgroundSubtractorMOG2(history, varThreshold,
+        detectShadows != 0));
+  BRIDGE_CATCH(err)
+  return NULL;
+}
+
+BackgroundSubtractor BackgroundSubtractor_NewKNN(int history,
+    double dist2Threshold, int detectShadows, struct Error* err) {
+  BRIDGE_TRY
+    return new cv::Ptr<cv::BackgroundSubtractor>(
+      cv::createBackgroundSubtractorKNN(history, dist2Threshold,
+        detectShadows != 0));
+  BRIDGE_CATCH(err)
+  return NULL;
+}
+
+void BackgroundSubtractor_Delete(BackgroundSubtractor b) {
+  delete b;
+}
+
+Mat BackgroundSubtractor_Apply(BackgroundSubtractor b, MatVec3b img,
+    double learningRate, struct Error* err) {
+  BRIDGE_TRY
+    cv::Mat mask;
+    (*b)->apply(*img, mask, learningRate);
+    return new cv::Mat(mask);
+  BRIDGE_CATCH(err)
+  return NULL;
+}
+
+Mat Mat_CalcOpticalFlowFarneback(Mat prev, Mat next,
+    struct FarnebackParams params, struct Error* err) {
+  BRIDGE_TRY
+    cv::Mat flow;
+    cv::calcOpticalFlowFarneback(*prev, *next, flow, params.pyrScale,
+      params.levels, params.winSize, params.iterations, params.polyN,
+      params.polySigma, 0);
+    return new cv::Mat(flow);
+  BRIDGE_CATCH(err)
+  return NULL;
+}
+
+struct Points2f Mat_GoodFeaturesToTrack(Mat img, int maxCorners,
+    double qualityLevel, double minDistance, struct Error* err) {
+  BRIDGE_TRY
+    std::vector<cv::Point2f> corners;
+    cv::goodFeaturesToTrack(*img, corners, maxCorners, qualityLevel,
+      minDistance);
+    int length = corners.size();
+    Points2f ret = {new Point2f[length], length};
+    for (int i = 0; i < length; ++i) {
+      Point2f p = {corners[i].x, corners[i].y};
+      ret.points[i] = p;
+    }
+    return ret;
+  BRIDGE_CATCH(err)
+  Points2f empty = {NULL, 0};
+  return empty;
+}
+
+struct FlowPoints Mat_CalcOpticalFlowPyrLK(Mat prev, Mat next,
+    struct Points2f prevPts, int winSize, int maxLevel, struct Error* err) {
+  BRIDGE_TRY
+    std::vector<cv::Point2f> prevs;
+    for (int i = 0; i < prevPts.length; ++i) {
+      prevs.push_back(cv::Point2f(prevPts.points[i].x, prevPts.points[i].y));
+    }
+    std::vector<cv::Point2f> nexts;
+    std::vector<unsigned char> status;
+    std::vector<float> errors;
+    if (!prevs.empty()) {
+      cv::calcOpticalFlowPyrLK(*prev, *next, prevs, nexts, status, errors,
+        cv::Size(winSize, winSize), maxLevel);
+    }
+    // only points found in the next frame are returned
+    int length = 0;
+    for (size_t i = 0; i < status.size(); ++i) {
+      if (status[i]) {
+        ++length;
+      }
+    }
+    FlowPoints ret = {new Point2f[length], new Point2f[length], length};
+    int j = 0;
+    for (size_t i = 0; i < status.size(); ++i) {
+      if (!status[i]) {
+        continue;
+      }
+      Point2f p = {prevs[i].x, prevs[i].y};
+      Point2f n = {nexts[i].x, nexts[i].y};
+      ret.prev[j] = p;
+      ret.next[j] = n;
+      ++j;
+    }
+    return ret;
+  BRIDGE_CATCH(err)
+  FlowPoints empty = {NULL, NULL, 0};
+  return empty;
+}
+
+void Points2f_Delete(struct Points2f ps) {
+  delete[] ps.points;
+}
+
+void FlowPoints_Delete(struct FlowPoints fs) {
+  delete[] fs.prev;
+  delete[] fs.next;
+}
+
+void MatVec3b_DrawFlow(MatVec3b img, Mat flow, int step, struct Error* err) {
+  BRIDGE_TRY
+    CV_Assert(flow->type() == CV_32FC2 && flow->size() == img->size());
+    for (int y = step / 2; y < img->rows; y += step) {
+      for (int x = step / 2; x < img->cols; x += step) {
+        const cv::Point2f& f = flow->at<cv::Point2f>(y, x);
+        cv::line(*img, cv::Point(x, y),
+          cv::Point(cvRound(x + f.x), cvRound(y + f.y)),
+          cv::Scalar(0, 200, 0), 1, cv::LINE_AA);
+        cv::circle(*img, cv::Point(x, y), 1, cv::Scalar(0, 200, 0), -1,
+          cv::LINE_AA);
+      }
+    }
+  BRIDGE_CATCH(err)
+}
+
+void MatVec3b_DrawFlowPoints(MatVec3b img, struct FlowPoints fs,
+    struct Error* err) {
+  BRIDGE_TRY
+    for (int i = 0; i < fs.length; ++i) {
+      cv::Point2f p(fs.prev[i].x, fs.prev[i].y);
+      cv::Point2f n(fs.next[i].x, fs.next[i].y);
+      cv::line(*img, p, n, cv::Scalar(0, 200, 0), 1, cv::LINE_AA);
+      cv::circle(*img, n, 2, cv::Scalar(0, 0, 200), -1, cv::LINE_AA);
+    }
+  BRIDGE_CATCH(err)
+}
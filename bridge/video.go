@@ -0,0 +1,207 @@
+package bridge
+
+/*
+#include "video.h"
+*/
+import "C"
+import (
+	"fmt"
+	"reflect"
+	"unsafe"
+)
+
+// BackgroundSubtractor is a bind of `cv::BackgroundSubtractor`, which is
+// created by `cv::createBackgroundSubtractorMOG2` or
+// `cv::createBackgroundSubtractorKNN`.
+type BackgroundSubtractor struct {
+	p C.BackgroundSubtractor
+}
+
+// NewBackgroundSubtractorMOG2 returns a new Gaussian mixture based
+// BackgroundSubtractor. varThreshold is a threshold of the squared
+// Mahalanobis distance of a pixel to be background. When detectShadows is
+// true, shadows are marked as 127 in foreground masks.
+func NewBackgroundSubtractorMOG2(history int, varThreshold float64,
+	detectShadows bool) (BackgroundSubtractor, error) {
+	var cErr C.struct_Error
+	p := C.BackgroundSubtractor_NewMOG2(C.int(history), C.double(varThreshold),
+		C.int(boolToInt(detectShadows)), &cErr)
+	if err := toGoError(cErr); err != nil {
+		return BackgroundSubtractor{}, err
+	}
+	return BackgroundSubtractor{p: p}, nil
+}
+
+// NewBackgroundSubtractorKNN returns a new K-nearest neighbours based
+// BackgroundSubtractor. dist2Threshold is a threshold of the squared distance
+// of a pixel to a sample to be near. detectShadows is same as
+// NewBackgroundSubtractorMOG2.
+func NewBackgroundSubtractorKNN(history int, dist2Threshold float64,
+	detectShadows bool) (BackgroundSubtractor, error) {
+	var cErr C.struct_Error
+	p := C.BackgroundSubtractor_NewKNN(C.int(history), C.double(dist2Threshold),
+		C.int(boolToInt(detectShadows)), &cErr)
+	if err := toGoError(cErr); err != nil {
+		return BackgroundSubtractor{}, err
+	}
+	return BackgroundSubtractor{p: p}, nil
+}
+
+// Delete BackgroundSubtractor's pointer.
+func (b *BackgroundSubtractor) Delete() {
+	C.BackgroundSubtractor_Delete(b.p)
+	b.p = nil
+}
+
+// Apply updates the background model with the image and returns a CV_8UC1
+// foreground mask, 255 is foreground, 127 is shadow and 0 is background.
+// learningRate is from 0 (the model is not updated) to 1 (the model is
+// reinitialized by the image), a negative value chooses it automatically.
+// The returned Mat is required to be deleted after using.
+func (b *BackgroundSubtractor) Apply(img MatVec3b, learningRate float64) (Mat,
+	error) {
+	var cErr C.struct_Error
+	p := C.BackgroundSubtractor_Apply(b.p, img.p, C.double(learningRate),
+		&cErr)
+	if err := toGoError(cErr); err != nil {
+		return Mat{}, err
+	}
+	return Mat{p: p}, nil
+}
+
+// FarnebackParams is parameters of `cv::calcOpticalFlowFarneback`.
+type FarnebackParams struct {
+	PyrScale   float64
+	Levels     int
+	WinSize    int
+	Iterations int
+	PolyN      int
+	PolySigma  float64
+}
+
+// NewFarnebackParams returns parameters which are commonly used, same as
+// OpenCV's sample.
+func NewFarnebackParams() FarnebackParams {
+	return FarnebackParams{
+		PyrScale:   0.5,
+		Levels:     3,
+		WinSize:    15,
+		Iterations: 3,
+		PolyN:      5,
+		PolySigma:  1.2,
+	}
+}
+
+func (p *FarnebackParams) toC() C.struct_FarnebackParams {
+	return C.struct_FarnebackParams{
+		pyrScale:   C.double(p.PyrScale),
+		levels:     C.int(p.Levels),
+		winSize:    C.int(p.WinSize),
+		iterations: C.int(p.Iterations),
+		polyN:      C.int(p.PolyN),
+		polySigma:  C.double(p.PolySigma),
+	}
+}
+
+// CalcOpticalFlowFarneback computes dense optical flow between two CV_8UC1
+// images of the same size. Returns a CV_32FC2 Mat whose elements are flow
+// vectors (dx, dy) of each pixel. The returned Mat is required to be deleted
+// after using.
+func CalcOpticalFlowFarneback(prev Mat, next Mat, params FarnebackParams) (
+	Mat, error) {
+	var cErr C.struct_Error
+	p := C.Mat_CalcOpticalFlowFarneback(prev.p, next.p, params.toC(), &cErr)
+	if err := toGoError(cErr); err != nil {
+		return Mat{}, err
+	}
+	return Mat{p: p}, nil
+}
+
+// GoodFeaturesToTrack returns strong corners of a CV_8UC1 image by
+// `cv::goodFeaturesToTrack`, which are suitable for sparse optical flow.
+func GoodFeaturesToTrack(img Mat, maxCorners int, qualityLevel float64,
+	minDistance float64) ([]Point2f, error) {
+	var cErr C.struct_Error
+	ret := C.Mat_GoodFeaturesToTrack(img.p, C.int(maxCorners),
+		C.double(qualityLevel), C.double(minDistance), &cErr)
+	if err := toGoError(cErr); err != nil {
+		return nil, err
+	}
+	defer C.Points2f_Delete(ret)
+	return toGoPoints2f(ret.points, int(ret.length)), nil
+}
+
+// CalcOpticalFlowPyrLK tracks points of prev to next by pyramidal
+// Lucas-Kanade method. Returns pairs of tracked points, points which are not
+// found in next are dropped.
+func CalcOpticalFlowPyrLK(prev Mat, next Mat, prevPts []Point2f, winSize int,
+	maxLevel int) ([]Point2f, []Point2f, error) {
+	var cErr C.struct_Error
+	ret := C.Mat_CalcOpticalFlowPyrLK(prev.p, next.p, toCPoints2f(prevPts),
+		C.int(winSize), C.int(maxLevel), &cErr)
+	if err := toGoError(cErr); err != nil {
+		return nil, nil, err
+	}
+	defer C.FlowPoints_Delete(ret)
+	length := int(ret.length)
+	return toGoPoints2f(ret.prev, length), toGoPoints2f(ret.next, length), nil
+}
+
+// DrawFlow draws flow vectors of a CV_32FC2 flow on the image at every step
+// pixels. The flow is required to have the same size as the image.
+func DrawFlow(img MatVec3b, flow Mat, step int) error {
+	var cErr C.struct_Error
+	C.MatVec3b_DrawFlow(img.p, flow.p, C.int(step), &cErr)
+	return toGoError(cErr)
+}
+
+// DrawFlowPoints draws lines from prev to next points on the image. prev and
+// next are required to have the same length.
+func DrawFlowPoints(img MatVec3b, prev []Point2f, next []Point2f) error {
+	if len(prev) != len(next) {
+		return fmt.Errorf("the numbers of points are different: %v, %v",
+			len(prev), len(next))
+	}
+	cPrev := toCPoints2f(prev)
+	cNext := toCPoints2f(next)
+	fs := C.struct_FlowPoints{
+		prev:   cPrev.points,
+		next:   cNext.points,
+		length: cPrev.length,
+	}
+	var cErr C.struct_Error
+	C.MatVec3b_DrawFlowPoints(img.p, fs, &cErr)
+	return toGoError(cErr)
+}
+
+// toCPoints2f converts points to C structure. The returned value refers Go
+// memory, it must not be kept by C/C++ after a call.
+func toCPoints2f(points []Point2f) C.struct_Points2f {
+	if len(points) == 0 {
+		return C.struct_Points2f{}
+	}
+	cPoints := make([]C.struct_Point2f, len(points))
+	for i, p := range points {
+		cPoints[i] = C.struct_Point2f{x: C.float(p.X), y: C.float(p.Y)}
+	}
+	return C.struct_Points2f{
+		points: (*C.Point2f)(&cPoints[0]),
+		length: C.int(len(points)),
+	}
+}
+
+// toGoPoints2f converts a point array allocated by C/C++ to Go.
+func toGoPoints2f(p *C.Point2f, length int) []Point2f {
+	hdr := reflect.SliceHeader{
+		Data: uintptr(unsafe.Pointer(p)),
+		Len:  length,
+		Cap:  length,
+	}
+	cArray := *(*[]C.Point2f)(unsafe.Pointer(&hdr))
+
+	ret := make([]Point2f, length)
+	for i, v := range cArray {
+		ret[i] = Point2f{X: float32(v.x), Y: float32(v.y)}
+	}
+	return ret
+}
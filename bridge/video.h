@@ -0,0 +1,64 @@
+#ifndef _OPENCV_BRIDGE_VIDEO_H_
+#define _OPENCV_BRIDGE_VIDEO_H_
+
+#include "opencv_bridge.h"
+
+#ifdef __cplusplus
+#include <opencv2/video.hpp>
+extern "C" {
+#endif
+
+typedef struct Point2f {
+  float x;
+  float y;
+} Point2f;
+typedef struct Points2f {
+  Point2f* points;
+  int length;
+} Points2f;
+// FlowPoints are pairs of points tracked from prev to next.
+typedef struct FlowPoints {
+  Point2f* prev;
+  Point2f* next;
+  int length;
+} FlowPoints;
+typedef struct FarnebackParams {
+  double pyrScale;
+  int levels;
+  int winSize;
+  int iterations;
+  int polyN;
+  double polySigma;
+} FarnebackParams;
+
+#ifdef __cplusplus
+typedef cv::Ptr<cv::BackgroundSubtractor>* BackgroundSubtractor;
+#else
+typedef void* BackgroundSubtractor;
+#endif
+
+BackgroundSubtractor BackgroundSubtractor_NewMOG2(int history,
+  double varThreshold, int detectShadows, struct Error* err);
+BackgroundSubtractor BackgroundSubtractor_NewKNN(int history,
+  double dist2Threshold, int detectShadows, struct Error* err);
+void BackgroundSubtractor_Delete(BackgroundSubtractor b);
+Mat BackgroundSubtractor_Apply(BackgroundSubtractor b, MatVec3b img,
+  double learningRate, struct Error* err);
+
+Mat Mat_CalcOpticalFlowFarneback(Mat prev, Mat next,
+  struct FarnebackParams params, struct Error* err);
+struct Points2f Mat_GoodFeaturesToTrack(Mat img, int maxCorners,
+  double qualityLevel, double minDistance, struct Error* err);
+struct FlowPoints Mat_CalcOpticalFlowPyrLK(Mat prev, Mat next,
+  struct Points2f prevPts, int winSize, int maxLevel, struct Error* err);
+void Points2f_Delete(struct Points2f ps);
+void FlowPoints_Delete(struct FlowPoints fs);
+void MatVec3b_DrawFlow(MatVec3b img, Mat flow, int step, struct Error* err);
+void MatVec3b_DrawFlowPoints(MatVec3b img, struct FlowPoints fs,
+  struct Error* err);
+
+#ifdef __cplusplus
+}
+#endif
+
+#endif //_OPENCV_BRIDGE_VIDEO_H_
@@ -1,3 +1,6 @@
+//go:build cgo
+// +build cgo
+
 package opencv
 
 import (
@@ -14,8 +17,6 @@ type FromDeviceCreator struct{}
 
 var (
 	deviceIDPath = data.MustCompilePath("device_id")
-	widthPath    = data.MustCompilePath("width")
-	heightPath   = data.MustCompilePath("height")
 	fpsPath      = data.MustCompilePath("fps")
 )
 
@@ -33,6 +34,9 @@ var (
 // height: Frame height, if set empty or "0" then will be ignore.
 //
 // fps: Frame per second, if set empty or "0" then will be ignore.
+//
+// backend: The backend of OpenCV video capture, one of "any", "ffmpeg",
+// "gstreamer", "v4l2" and "images". Default is "any".
 func (c *FromDeviceCreator) CreateSource(ctx *core.Context, ioParams *bql.IOParams,
 	params data.Map) (core.Source, error) {
 	cs, err := c.createCaptureFromDevice(ctx, ioParams, params)
@@ -90,11 +94,17 @@ func (c *FromDeviceCreator) createCaptureFromDevice(ctx *core.Context,
 		return nil, err
 	}
 
+	backend, err := getCaptureBackend(params)
+	if err != nil {
+		return nil, err
+	}
+
 	cs := &captureFromDevice{
 		deviceID: deviceID,
 		width:    width,
 		height:   height,
 		fps:      fps,
+		backend:  backend,
 	}
 	if format == "cvmat" {
 		cs.formatFunc = toRawMap
@@ -109,6 +119,7 @@ type captureFromDevice struct {
 	width      int64
 	height     int64
 	fps        int64
+	backend    int
 	formatFunc func(m *bridge.MatVec3b) data.Map
 }
 
@@ -130,19 +141,25 @@ func (c *captureFromDevice) GenerateStream(ctx *core.Context, w core.Writer) err
 	vcap := bridge.NewVideoCapture()
 	defer vcap.Delete()
 
-	if ok := vcap.OpenDevice(int(c.deviceID)); !ok {
-		return fmt.Errorf("error opening device: %v", c.deviceID)
+	if err := vcap.OpenDeviceWithAPI(int(c.deviceID), c.backend); err != nil {
+		return fmt.Errorf("error opening device: %v: %v", c.deviceID, err)
 	}
 
 	// OpenCV video capture configuration
 	if c.width > 0 {
-		vcap.Set(bridge.CvCapPropFrameWidth, int(c.width))
+		if err := vcap.Set(bridge.CvCapPropFrameWidth, int(c.width)); err != nil {
+			return err
+		}
 	}
 	if c.height > 0 {
-		vcap.Set(bridge.CvCapPropFrameHeight, int(c.height))
+		if err := vcap.Set(bridge.CvCapPropFrameHeight, int(c.height)); err != nil {
+			return err
+		}
 	}
 	if c.fps > 0 {
-		vcap.Set(bridge.CvCapPropFps, int(c.fps))
+		if err := vcap.Set(bridge.CvCapPropFps, int(c.fps)); err != nil {
+			return err
+		}
 	}
 
 	// streaming, capture from vcap
@@ -150,7 +167,11 @@ func (c *captureFromDevice) GenerateStream(ctx *core.Context, w core.Writer) err
 	defer buf.Delete()
 	ctx.Log().Infof("start reading camera device: %v", c.deviceID)
 	for {
-		if ok := vcap.Read(buf); !ok {
+		ok, err := vcap.Read(buf)
+		if err != nil {
+			return err
+		}
+		if !ok {
 			return fmt.Errorf("cannot read a new file (device no: %d)", c.deviceID)
 		}
 		if buf.Empty() {
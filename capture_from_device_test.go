@@ -1,8 +1,12 @@
+//go:build cgo
+// +build cgo
+
 package opencv
 
 import (
 	"fmt"
 	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/opencv.v0/bridge"
 	"gopkg.in/sensorbee/sensorbee.v0/bql"
 	"gopkg.in/sensorbee/sensorbee.v0/core"
 	"gopkg.in/sensorbee/sensorbee.v0/data"
@@ -42,6 +46,7 @@ func TestGetDeviceSourceCreator(t *testing.T) {
 				"width":     data.Int(500),
 				"height":    data.Int(600),
 				"fps":       data.Int(25),
+				"backend":   data.String("v4l2"),
 			}
 			Convey("Then creator should initialize capture source", func() {
 				s, err := sc.createCaptureFromDevice(ctx, ioParams, params)
@@ -52,6 +57,7 @@ func TestGetDeviceSourceCreator(t *testing.T) {
 				So(capture.width, ShouldEqual, 500)
 				So(capture.height, ShouldEqual, 600)
 				So(capture.fps, ShouldEqual, 25)
+				So(capture.backend, ShouldEqual, bridge.CvCapV4L2)
 			})
 		})
 
@@ -81,6 +87,7 @@ func TestGetDeviceSourceCreator(t *testing.T) {
 				So(capture.width, ShouldEqual, 0)
 				So(capture.height, ShouldEqual, 0)
 				So(capture.fps, ShouldEqual, 0)
+				So(capture.backend, ShouldEqual, bridge.CvCapAny)
 			})
 		})
 
@@ -100,10 +107,11 @@ func TestGetDeviceSourceCreator(t *testing.T) {
 				"device_id": data.Int(0),
 			}
 			testMap := data.Map{
-				"format": data.False,
-				"width":  data.String("a"),
-				"height": data.String("b"),
-				"fps":    data.String("@"),
+				"format":  data.False,
+				"width":   data.String("a"),
+				"height":  data.String("b"),
+				"fps":     data.String("@"),
+				"backend": data.Int(1),
 			}
 			for k, v := range testMap {
 				v := v
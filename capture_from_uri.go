@@ -1,3 +1,6 @@
+//go:build cgo
+// +build cgo
+
 package opencv
 
 import (
@@ -6,6 +9,7 @@ import (
 	"gopkg.in/sensorbee/sensorbee.v0/bql"
 	"gopkg.in/sensorbee/sensorbee.v0/core"
 	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"strings"
 	"time"
 )
 
@@ -14,21 +18,54 @@ type FromURICreator struct{}
 
 var (
 	uriPath            = data.MustCompilePath("uri")
-	formatPath         = data.MustCompilePath("format")
 	frameSkipPath      = data.MustCompilePath("frame_skip")
 	nextFrameErrorPath = data.MustCompilePath("next_frame_error")
 	rewindPath         = data.MustCompilePath("rewind")
+	backendPath        = data.MustCompilePath("backend")
 )
 
+// captureBackends are names of "backend" parameter and OpenCV's API
+// preferences.
+var captureBackends = map[string]int{
+	"any":       bridge.CvCapAny,
+	"ffmpeg":    bridge.CvCapFFmpeg,
+	"gstreamer": bridge.CvCapGStreamer,
+	"v4l2":      bridge.CvCapV4L2,
+	"images":    bridge.CvCapImages,
+}
+
+// getCaptureBackend returns an API preference of "backend" parameter, default
+// is "any".
+func getCaptureBackend(params data.Map) (int, error) {
+	b, err := params.Get(backendPath)
+	if err != nil {
+		return bridge.CvCapAny, nil
+	}
+	name, err := data.AsString(b)
+	if err != nil {
+		return 0, err
+	}
+	api, ok := captureBackends[strings.ToLower(name)]
+	if !ok {
+		return 0, fmt.Errorf("'%v' backend is not supported", name)
+	}
+	return api, nil
+}
+
 // CreateSource creates a frame generator using OpenCV video capture.
 // URI can be set HTTP address or file path.
 //
 // WITH parameters.
 //
-// uri: [required] A capture data's URI (e.g. /data/test.avi).
+// uri: [required] A capture data's URI (e.g. /data/test.avi). When backend is
+// "gstreamer", the URI is a GStreamer pipeline which ends with appsink.
 //
 // format: Output format style, default is "cvmat".
 //
+// backend: The backend of OpenCV video capture, one of "any", "ffmpeg",
+// "gstreamer", "v4l2" and "images". Default is "any", OpenCV selects a
+// backend which can open the URI.
+//
 // frame_skip: The number of frame skip, if set empty or "0" then read all
 // frames. FPS is depended on the URI's file (or device).
 //
@@ -96,10 +133,16 @@ func (c *FromURICreator) createCaptureFromURI(ctx *core.Context,
 		return nil, err
 	}
 
+	backend, err := getCaptureBackend(params)
+	if err != nil {
+		return nil, err
+	}
+
 	cs := &captureFromURI{
 		uri:        uriStr,
 		frameSkip:  frameSkip,
 		endErrFlag: endErr,
+		backend:    backend,
 	}
 	if format == "cvmat" {
 		cs.foramtFunc = toRawMap
@@ -113,6 +156,7 @@ type captureFromURI struct {
 	uri        string
 	frameSkip  int64
 	endErrFlag bool
+	backend    int
 	foramtFunc func(m *bridge.MatVec3b) data.Map
 }
 
@@ -142,8 +186,9 @@ type captureFromURI struct {
 func (c *captureFromURI) GenerateStream(ctx *core.Context, w core.Writer) error {
 	vcap := bridge.NewVideoCapture()
 	defer vcap.Delete()
-	if ok := vcap.Open(c.uri); !ok {
-		return fmt.Errorf("error opening video stream or file: %v", c.uri)
+	if err := vcap.OpenWithAPI(c.uri, c.backend); err != nil {
+		return fmt.Errorf("error opening video stream or file: %v: %v", c.uri,
+			err)
 	}
 
 	buf := bridge.NewMatVec3b()
@@ -153,7 +198,11 @@ func (c *captureFromURI) GenerateStream(ctx *core.Context, w core.Writer) error
 	ctx.Log().Infof("start reading video stream of file: %v", c.uri)
 	for {
 		cnt++
-		if ok := vcap.Read(buf); !ok {
+		ok, err := vcap.Read(buf)
+		if err != nil {
+			return err
+		}
+		if !ok {
 			ctx.Log().Infof("total read frames count is %d", cnt-1)
 			if c.endErrFlag {
 				return fmt.Errorf("cannot reed a new frame")
@@ -161,7 +210,9 @@ func (c *captureFromURI) GenerateStream(ctx *core.Context, w core.Writer) error
 			break
 		}
 		if c.frameSkip > 0 {
-			vcap.Grab(int(c.frameSkip))
+			if err := vcap.Grab(int(c.frameSkip)); err != nil {
+				return err
+			}
 		}
 
 		now := time.Now()
@@ -1,8 +1,12 @@
+//go:build cgo
+// +build cgo
+
 package opencv
 
 import (
 	"fmt"
 	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/opencv.v0/bridge"
 	"gopkg.in/sensorbee/sensorbee.v0/bql"
 	"gopkg.in/sensorbee/sensorbee.v0/core"
 	"gopkg.in/sensorbee/sensorbee.v0/data"
@@ -65,6 +69,7 @@ func TestGetURISourceCreator(t *testing.T) {
 				"format":           data.String("cvmat"),
 				"frame_skip":       data.Int(5),
 				"next_frame_error": data.False,
+				"backend":          data.String("GStreamer"),
 			}
 			Convey("Then creator should initialize capture source", func() {
 				s, err := sc.createCaptureFromURI(ctx, ioParams, params)
@@ -74,6 +79,7 @@ func TestGetURISourceCreator(t *testing.T) {
 				So(capture.uri, ShouldEqual, "/data/file.avi")
 				So(capture.frameSkip, ShouldEqual, 5)
 				So(capture.endErrFlag, ShouldBeFalse)
+				So(capture.backend, ShouldEqual, bridge.CvCapGStreamer)
 			})
 		})
 
@@ -101,6 +107,7 @@ func TestGetURISourceCreator(t *testing.T) {
 				So(capture.uri, ShouldEqual, "/data/file.avi")
 				So(capture.frameSkip, ShouldEqual, 0)
 				So(capture.endErrFlag, ShouldBeTrue)
+				So(capture.backend, ShouldEqual, bridge.CvCapAny)
 			})
 		})
 
@@ -123,6 +130,7 @@ func TestGetURISourceCreator(t *testing.T) {
 				"format":           data.True,
 				"frame_skip":       data.String("@"),
 				"next_frame_error": data.String("True"),
+				"backend":          data.String("directshow"),
 			}
 			for k, v := range testMap {
 				v := v
@@ -1,3 +1,6 @@
+//go:build cgo
+// +build cgo
+
 package opencv
 
 import (
@@ -5,18 +8,103 @@ import (
 	"gopkg.in/sensorbee/opencv.v0/bridge"
 	"gopkg.in/sensorbee/sensorbee.v0/core"
 	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"strings"
 )
 
 var (
-	configFilePath = data.MustCompilePath("file")
-	xPath          = data.MustCompilePath("x")
-	yPath          = data.MustCompilePath("y")
+	configFilePath   = data.MustCompilePath("file")
+	scaleFactorPath  = data.MustCompilePath("scale_factor")
+	minNeighborsPath = data.MustCompilePath("min_neighbors")
+	flagsPath        = data.MustCompilePath("flags")
+	minSizePath      = data.MustCompilePath("min_size")
+	maxSizePath      = data.MustCompilePath("max_size")
+	rejectLevelsPath = data.MustCompilePath("output_reject_levels")
+	grayscalePath    = data.MustCompilePath("grayscale")
+	equalizePath     = data.MustCompilePath("equalize")
+	clipLimitPath    = data.MustCompilePath("clahe_clip_limit")
+	tileSizePath     = data.MustCompilePath("clahe_tile_size")
+	downscalePath    = data.MustCompilePath("downscale")
+	parallelismPath  = data.MustCompilePath("parallelism")
+	roiPath          = data.MustCompilePath("roi")
+	maskPath         = data.MustCompilePath("mask")
+	outerPath        = data.MustCompilePath("outer")
+	innerPath        = data.MustCompilePath("inner")
 )
 
+// equalizeMethods are names of "equalize" parameter.
+var equalizeMethods = map[string]int{
+	"none":  bridge.EqualizeNone,
+	"hist":  bridge.EqualizeHist,
+	"clahe": bridge.EqualizeCLAHE,
+}
+
+// detectMultiScaleParamKeys are keys of a parameter map of DetectMultiScale.
+var detectMultiScaleParamKeys = map[string]bool{
+	"scale_factor":  true,
+	"min_neighbors": true,
+	"flags":         true,
+	"min_size":      true,
+	"max_size":      true,
+
+	"output_reject_levels": true,
+	"roi":                  true,
+	"mask":                 true,
+}
+
 // NewCascadeClassifier returns cascadeClassifier state.
 //
 // file: cascade configuration file path for detection.
 // e.g. "haarcascade_frontalface_default.xml".
+//
+// The following parameters are defaults of DetectMultiScale, they can be
+// overwritten by a parameter map of each call.
+//
+// scale_factor: How much the image size is reduced at each image scale,
+// required to be greater than 1.0. Default is 1.1, a larger value makes
+// detection faster and less accurate.
+//
+// min_neighbors: How many neighbors each candidate rectangle should have to
+// retain it. Default is 3.
+//
+// flags: Flags of old format cascade, e.g. 2 (CV_HAAR_SCALE_IMAGE). Default
+// is 0.
+//
+// min_size: Minimum object size as a map which has "width" and "height", e.g.
+// {"width": 30, "height": 30}. Objects smaller than that are ignored. Default
+// is no limit.
+//
+// max_size: Maximum object size as same as min_size. Default is no limit.
+//
+// output_reject_levels: If set `true` then each detected rectangle has "level"
+// and "weight", which are results of OpenCV's reject levels variant of
+// detectMultiScale (detectMultiScale3). A larger weight means more confident.
+// Default is false.
+//
+// The following parameters control preprocessing of an image before
+// detection. They cannot be overwritten by each call. Detected rectangles are
+// always in coordinates of the original image.
+//
+// grayscale: If set `true` then the image is converted to grayscale. Default
+// is false.
+//
+// equalize: Histogram equalization of the grayscale image, one of "none",
+// "hist" (cv::equalizeHist) and "clahe" (cv::CLAHE). Except "none", the image
+// is converted to grayscale regardless of grayscale parameter. Default is
+// "none".
+//
+// clahe_clip_limit: Threshold for contrast limiting of CLAHE. Default is 2.0.
+//
+// clahe_tile_size: The number of tiles in each row and column of CLAHE.
+// Default is 8.
+//
+// downscale: The image is shrunk by the factor before detection, e.g. 2.0
+// detects on the half size image. It is required to be 1.0 or larger. min_size
+// and max_size are still sizes on the original image. Default is 1.0.
+//
+// parallelism: The number of classifier instances loaded from the file. Each
+// call of DetectMultiScale checks out an instance, so the state can be used
+// by this number of calls concurrently, other calls wait for an instance to
+// be returned. Default is 1.
 func NewCascadeClassifier(ctx *core.Context, params data.Map) (core.SharedState,
 	error) {
 	var filePath string
@@ -26,22 +114,210 @@ func NewCascadeClassifier(ctx *core.Context, params data.Map) (core.SharedState,
 		return nil, err
 	}
 
-	cc := bridge.NewCascadeClassifier()
-	if !cc.Load(filePath) {
-		return nil, fmt.Errorf("cannot load the file '%v'", filePath)
+	detectParams, err := parseDetectMultiScaleParams(params,
+		detectMultiScaleParams{
+			DetectMultiScaleParams: bridge.NewDetectMultiScaleParams(),
+		})
+	if err != nil {
+		return nil, err
+	}
+	if detectParams.DetectMultiScaleParams, err = parsePreprocessParams(params,
+		detectParams.DetectMultiScaleParams); err != nil {
+		return nil, err
 	}
 
-	return &cascadeClassifier{
-		classifier: cc,
-	}, nil
+	parallelism := int64(1)
+	if p, err := params.Get(parallelismPath); err == nil {
+		if parallelism, err = data.AsInt(p); err != nil {
+			return nil, err
+		}
+		if parallelism < 1 {
+			return nil, fmt.Errorf("parallelism must be positive: %v",
+				parallelism)
+		}
+	}
+
+	c := &cascadeClassifier{
+		classifiers: make([]bridge.CascadeClassifier, parallelism),
+		params:      detectParams,
+	}
+	for i := range c.classifiers {
+		cc := bridge.NewCascadeClassifier()
+		if err := cc.Load(filePath); err != nil {
+			cc.Delete()
+			for j := 0; j < i; j++ {
+				c.classifiers[j].Delete()
+			}
+			return nil, err
+		}
+		c.classifiers[i] = cc
+	}
+	c.pool = newInstancePool(len(c.classifiers), func(i int) {
+		c.classifiers[i].Delete()
+	})
+	return c, nil
 }
 
+// cascadeClassifier has a pool of classifier instances, `cv::
+// CascadeClassifier` is not guaranteed to be thread-safe. An instance is
+// checked out from the pool by each detection.
 type cascadeClassifier struct {
-	classifier bridge.CascadeClassifier
+	classifiers []bridge.CascadeClassifier
+	pool        *instancePool
+	params      detectMultiScaleParams
+}
+
+// detectMultiScaleParams is parameters of DetectMultiScale.
+type detectMultiScaleParams struct {
+	bridge.DetectMultiScaleParams
+	outputRejectLevels bool
+}
+
+// parseDetectMultiScaleParams returns base overwritten by parameters in the
+// map. Keys which are not parameters are ignored.
+func parseDetectMultiScaleParams(params data.Map,
+	base detectMultiScaleParams) (detectMultiScaleParams, error) {
+	p := base
+	if v, err := params.Get(scaleFactorPath); err == nil {
+		f, err := data.ToFloat(v)
+		if err != nil {
+			return p, err
+		}
+		if f <= 1.0 {
+			return p, fmt.Errorf("scale_factor must be greater than 1.0: %v", f)
+		}
+		p.ScaleFactor = f
+	}
+	if v, err := params.Get(minNeighborsPath); err == nil {
+		n, err := data.AsInt(v)
+		if err != nil {
+			return p, err
+		}
+		if n < 0 {
+			return p, fmt.Errorf("min_neighbors must not be negative: %v", n)
+		}
+		p.MinNeighbors = int(n)
+	}
+	if v, err := params.Get(flagsPath); err == nil {
+		f, err := data.AsInt(v)
+		if err != nil {
+			return p, err
+		}
+		if f < 0 {
+			return p, fmt.Errorf("flags must not be negative: %v", f)
+		}
+		p.Flags = int(f)
+	}
+	if v, err := params.Get(minSizePath); err == nil {
+		w, h, err := parseSize(v)
+		if err != nil {
+			return p, fmt.Errorf("invalid min_size: %v", err)
+		}
+		p.MinWidth, p.MinHeight = w, h
+	}
+	if v, err := params.Get(maxSizePath); err == nil {
+		w, h, err := parseSize(v)
+		if err != nil {
+			return p, fmt.Errorf("invalid max_size: %v", err)
+		}
+		p.MaxWidth, p.MaxHeight = w, h
+	}
+	if v, err := params.Get(rejectLevelsPath); err == nil {
+		if p.outputRejectLevels, err = data.AsBool(v); err != nil {
+			return p, err
+		}
+	}
+	if p.MaxWidth > 0 && p.MaxWidth < p.MinWidth ||
+		p.MaxHeight > 0 && p.MaxHeight < p.MinHeight {
+		return p, fmt.Errorf("max_size must not be smaller than min_size")
+	}
+	return p, nil
+}
+
+// parsePreprocessParams returns base overwritten by preprocessing parameters
+// in the map.
+func parsePreprocessParams(params data.Map, base bridge.DetectMultiScaleParams) (
+	bridge.DetectMultiScaleParams, error) {
+	p := base
+	if v, err := params.Get(grayscalePath); err == nil {
+		if p.Grayscale, err = data.AsBool(v); err != nil {
+			return p, err
+		}
+	}
+	if v, err := params.Get(equalizePath); err == nil {
+		name, err := data.AsString(v)
+		if err != nil {
+			return p, err
+		}
+		method, ok := equalizeMethods[strings.ToLower(name)]
+		if !ok {
+			return p, fmt.Errorf("'%v' equalization is not supported", name)
+		}
+		p.Equalize = method
+	}
+	if v, err := params.Get(clipLimitPath); err == nil {
+		l, err := data.ToFloat(v)
+		if err != nil {
+			return p, err
+		}
+		if l <= 0 {
+			return p, fmt.Errorf("clahe_clip_limit must be positive: %v", l)
+		}
+		p.CLAHEClipLimit = l
+	}
+	if v, err := params.Get(tileSizePath); err == nil {
+		s, err := data.AsInt(v)
+		if err != nil {
+			return p, err
+		}
+		if s <= 0 {
+			return p, fmt.Errorf("clahe_tile_size must be positive: %v", s)
+		}
+		p.CLAHETileSize = int(s)
+	}
+	if v, err := params.Get(downscalePath); err == nil {
+		f, err := data.ToFloat(v)
+		if err != nil {
+			return p, err
+		}
+		if f < 1.0 {
+			return p, fmt.Errorf("downscale must be 1.0 or larger: %v", f)
+		}
+		p.Downscale = f
+	}
+	return p, nil
+}
+
+// parseSize returns width and height of a size map such as
+// {"width": 30, "height": 30}.
+func parseSize(v data.Value) (int, int, error) {
+	m, err := data.AsMap(v)
+	if err != nil {
+		return 0, 0, err
+	}
+	var width int64
+	if wv, err := m.Get(widthPath); err != nil {
+		return 0, 0, err
+	} else if width, err = data.ToInt(wv); err != nil {
+		return 0, 0, err
+	}
+	var height int64
+	if hv, err := m.Get(heightPath); err != nil {
+		return 0, 0, err
+	} else if height, err = data.ToInt(hv); err != nil {
+		return 0, 0, err
+	}
+	if width < 0 || height < 0 {
+		return 0, 0, fmt.Errorf("size must not be negative: width=%v, height=%v",
+			width, height)
+	}
+	return int(width), int(height), nil
 }
 
+// Terminate deletes all instances. Instances used by running detections are
+// deleted when the detections finish, and following detections fail.
 func (c *cascadeClassifier) Terminate(ctx *core.Context) error {
-	c.classifier.Delete()
+	c.pool.terminate()
 	return nil
 }
 
@@ -64,32 +340,291 @@ func lookupCascadeClassifier(ctx *core.Context, name string) (*cascadeClassifier
 // classifierName: cascadeClassifier state name.
 //
 // img: target image as RawData map structure.
-func DetectMultiScale(ctx *core.Context, classifierName string, img data.Map) (
-	data.Array, error) {
+//
+// params: optional parameter map, which has same keys as parameters of
+// NewCascadeClassifier, e.g. {"scale_factor": 1.2, "min_size": {"width": 64,
+// "height": 64}}. Values which are not in the map are the state's defaults.
+//
+// The parameter map can also restrict detection to regions of the image by
+// the following keys. Detected rectangles are still coordinates of the whole
+// image.
+//
+// roi: An array of regions. A region is a rectangle map which has "x", "y",
+// "width" and "height", or a polygon which is an array of point maps which
+// have "x" and "y", e.g. [{"x": 0, "y": 0, "width": 100, "height": 100},
+// [{"x": 200, "y": 0}, {"x": 300, "y": 100}, {"x": 200, "y": 100}]].
+// Detection runs on each region, so an object in overlapped regions can be
+// detected twice.
+//
+// mask: A "cvmat1b" RawData map of the same size as the image, pixels of zero
+// value are not scanned. The mask is applied to each region of roi.
+//
+// Returns an array of rectangles, which have "x", "y", "width" and "height".
+// When output_reject_levels is true, they also have "level" and "weight".
+func DetectMultiScale(ctx *core.Context, classifierName string, img data.Map,
+	params ...data.Map) (data.Array, error) {
+	if len(params) > 1 {
+		return nil, fmt.Errorf("too many parameter maps: %v", len(params))
+	}
+	classifier, err := lookupCascadeClassifier(ctx, classifierName)
+	if err != nil {
+		return nil, err
+	}
+	var paramMap data.Map
+	if len(params) == 1 {
+		paramMap = params[0]
+	}
+
 	raw, err := ConvertMapToRawData(img)
 	if err != nil {
 		return nil, err
 	}
-	mat, err := raw.ToMatVec3b()
+	mat, err := defaultMatVec3bPool.get(&raw)
 	if err != nil {
 		return nil, err
 	}
-	defer mat.Delete()
+	defer defaultMatVec3bPool.put(mat)
 
-	classifier, err := lookupCascadeClassifier(ctx, classifierName)
+	return classifier.detectWithParamMap(mat, &raw, paramMap)
+}
+
+// parseParamMap returns the state's parameters overwritten by a parameter map
+// of DetectMultiScale. Returns an error when the map has unknown keys.
+func (c *cascadeClassifier) parseParamMap(params data.Map) (
+	detectMultiScaleParams, error) {
+	for k := range params {
+		if !detectMultiScaleParamKeys[k] {
+			return c.params, fmt.Errorf(
+				"'%v' is not a parameter of detectMultiScale", k)
+		}
+	}
+	return parseDetectMultiScaleParams(params, c.params)
+}
+
+// detectWithParamMap detects objects in the image with a parameter map of
+// DetectMultiScale, which can be nil. raw is the RawData of mat.
+func (c *cascadeClassifier) detectWithParamMap(mat bridge.MatVec3b,
+	raw *RawData, params data.Map) (data.Array, error) {
+	if params == nil {
+		return c.detect(mat, c.params, bridge.DetectRegion{})
+	}
+	detectParams, err := c.parseParamMap(params)
+	if err != nil {
+		return nil, err
+	}
+	regions, err := parseDetectRegions(params)
+	if err != nil {
+		return nil, err
+	}
+	if m, err := params.Get(maskPath); err == nil {
+		mask, err := convertToMask(m, raw)
+		if err != nil {
+			return nil, err
+		}
+		defer mask.Delete()
+		if len(regions) == 0 {
+			regions = []bridge.DetectRegion{{}}
+		}
+		for i := range regions {
+			regions[i].Mask = mask
+		}
+	}
+	if len(regions) == 0 {
+		return c.detect(mat, detectParams, bridge.DetectRegion{})
+	}
+	ret := data.Array{}
+	for _, r := range regions {
+		rects, err := c.detect(mat, detectParams, r)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, rects...)
+	}
+	return ret, nil
+}
+
+// parseDetectRegions returns regions of "roi" parameter, returns nil when the
+// parameter is not set.
+func parseDetectRegions(params data.Map) ([]bridge.DetectRegion, error) {
+	v, err := params.Get(roiPath)
+	if err != nil {
+		return nil, nil
+	}
+	roi, err := data.AsArray(v)
+	if err != nil {
+		return nil, err
+	}
+	regions := make([]bridge.DetectRegion, len(roi))
+	for i, r := range roi {
+		if polygon, err := data.AsArray(r); err == nil {
+			if regions[i].Polygon, err = convertToBridgePolygon(polygon); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if regions[i].ROI, err = convertToBridgeRect(r); err != nil {
+			return nil, err
+		}
+		if regions[i].ROI.Width <= 0 || regions[i].ROI.Height <= 0 {
+			return nil, fmt.Errorf("roi must have positive size: %v", r)
+		}
+	}
+	return regions, nil
+}
+
+// convertToMask returns a mask Mat of "mask" parameter, which is required to
+// be "cvmat1b" of the same size as the image. The returned Mat is required to
+// delete after using.
+func convertToMask(v data.Value, img *RawData) (bridge.Mat, error) {
+	m, err := data.AsMap(v)
+	if err != nil {
+		return bridge.Mat{}, err
+	}
+	raw, err := ConvertMapToRawData(m)
+	if err != nil {
+		return bridge.Mat{}, err
+	}
+	if raw.Format != TypeCVMAT1b {
+		return bridge.Mat{}, fmt.Errorf("mask must be '%v': %v", TypeCVMAT1b,
+			raw.Format)
+	}
+	if raw.Width != img.Width || raw.Height != img.Height {
+		return bridge.Mat{}, fmt.Errorf(
+			"mask size %vx%v does not match with the image size %vx%v",
+			raw.Width, raw.Height, img.Width, img.Height)
+	}
+	return raw.ToMat()
+}
+
+// detect detects objects in the region of the image by a classifier instance
+// checked out from the pool.
+func (c *cascadeClassifier) detect(mat bridge.MatVec3b,
+	params detectMultiScaleParams, region bridge.DetectRegion) (data.Array,
+	error) {
+	i, err := c.pool.get()
+	if err != nil {
+		return nil, err
+	}
+	defer c.pool.put(i)
+	cc := c.classifiers[i]
+
+	if params.outputRejectLevels {
+		rects, levels, weights, err := cc.DetectMultiScale3InRegion(mat,
+			params.DetectMultiScaleParams, region)
+		if err != nil {
+			return nil, err
+		}
+		ret := make(data.Array, len(rects))
+		for i, r := range rects {
+			rect := convertFromBridgeRect(r)
+			rect["level"] = data.Int(levels[i])
+			rect["weight"] = data.Float(weights[i])
+			ret[i] = rect
+		}
+		return ret, nil
+	}
+
+	rects, err := cc.DetectMultiScaleInRegion(mat,
+		params.DetectMultiScaleParams, region)
 	if err != nil {
 		return nil, err
 	}
-	rects := classifier.classifier.DetectMultiScale(mat)
 	ret := make(data.Array, len(rects))
 	for i, r := range rects {
-		rect := data.Map{
-			"x":      data.Int(r.X),
-			"y":      data.Int(r.Y),
-			"width":  data.Int(r.Width),
-			"height": data.Int(r.Height),
+		ret[i] = convertFromBridgeRect(r)
+	}
+	return ret, nil
+}
+
+// DetectNested detects objects by the outer classifier, and detects objects
+// inside each of them by the inner classifier, e.g. eyes in faces.
+//
+// outerName: cascadeClassifier state name of outer objects.
+//
+// innerName: cascadeClassifier state name of inner objects.
+//
+// img: target image as RawData map structure.
+//
+// params: optional parameter map, which can have "outer" and "inner".
+// "outer" is a parameter map of DetectMultiScale for outer objects. "inner"
+// is also a parameter map for inner objects, except "roi" and "mask" which are
+// decided by outer objects. e.g. {"inner": {"min_neighbors": 5}}.
+//
+// Returns an array of maps, which have "rect" and "children". "rect" is a
+// rectangle of an outer object, and "children" is an array of rectangles of
+// inner objects in it. Rectangles are coordinates of the whole image.
+func DetectNested(ctx *core.Context, outerName string, innerName string,
+	img data.Map, params ...data.Map) (data.Array, error) {
+	if len(params) > 1 {
+		return nil, fmt.Errorf("too many parameter maps: %v", len(params))
+	}
+	outer, err := lookupCascadeClassifier(ctx, outerName)
+	if err != nil {
+		return nil, err
+	}
+	inner, err := lookupCascadeClassifier(ctx, innerName)
+	if err != nil {
+		return nil, err
+	}
+	var outerParams, innerParamMap data.Map
+	if len(params) == 1 {
+		for k := range params[0] {
+			if k != "outer" && k != "inner" {
+				return nil, fmt.Errorf("'%v' is not a parameter of nested detection",
+					k)
+			}
+		}
+		if v, err := params[0].Get(outerPath); err == nil {
+			if outerParams, err = data.AsMap(v); err != nil {
+				return nil, err
+			}
+		}
+		if v, err := params[0].Get(innerPath); err == nil {
+			if innerParamMap, err = data.AsMap(v); err != nil {
+				return nil, err
+			}
+		}
+	}
+	for _, k := range []string{"roi", "mask"} {
+		if _, ok := innerParamMap[k]; ok {
+			return nil, fmt.Errorf("'%v' cannot be set to inner parameters", k)
+		}
+	}
+	innerParams, err := inner.parseParamMap(innerParamMap)
+	if err != nil {
+		return nil, err
+	}
+
+	raw, err := ConvertMapToRawData(img)
+	if err != nil {
+		return nil, err
+	}
+	mat, err := defaultMatVec3bPool.get(&raw)
+	if err != nil {
+		return nil, err
+	}
+	defer defaultMatVec3bPool.put(mat)
+
+	outerRects, err := outer.detectWithParamMap(mat, &raw, outerParams)
+	if err != nil {
+		return nil, err
+	}
+	ret := make(data.Array, len(outerRects))
+	for i, o := range outerRects {
+		r, err := convertToBridgeRect(o)
+		if err != nil {
+			return nil, err
+		}
+		children, err := inner.detect(mat, innerParams, bridge.DetectRegion{
+			ROI: r,
+		})
+		if err != nil {
+			return nil, err
+		}
+		ret[i] = data.Map{
+			"rect":     o,
+			"children": children,
 		}
-		ret[i] = rect
 	}
 	return ret, nil
 }
@@ -104,64 +639,24 @@ func DrawRectsToImage(img data.Map, rects data.Array) (data.Map, error) {
 	if err != nil {
 		return nil, err
 	}
-	mat, err := raw.ToMatVec3b()
+	mat, err := defaultMatVec3bPool.get(&raw)
 	if err != nil {
 		return nil, err
 	}
-	defer mat.Delete()
+	defer defaultMatVec3bPool.put(mat)
 
 	brRects, err := convertToBridgeRects(rects)
 	if err != nil {
 		return nil, err
 	}
 
-	bridge.DrawRectsToImage(mat, brRects)
+	if err := bridge.DrawRectsToImage(mat, brRects); err != nil {
+		return nil, err
+	}
 	retRaw := ToRawData(mat)
 	return retRaw.ConvertToDataMap(), nil
 }
 
-func convertToBridgeRects(rects data.Array) ([]bridge.Rect, error) {
-	brRects := make([]bridge.Rect, len(rects))
-	for i, r := range rects {
-		rmap, err := data.AsMap(r)
-		if err != nil {
-			return nil, err
-		}
-		var x int64
-		if xv, err := rmap.Get(xPath); err != nil {
-			return nil, err
-		} else if x, err = data.ToInt(xv); err != nil {
-			return nil, err
-		}
-		var y int64
-		if yv, err := rmap.Get(yPath); err != nil {
-			return nil, err
-		} else if y, err = data.ToInt(yv); err != nil {
-			return nil, err
-		}
-		var width int64
-		if wv, err := rmap.Get(widthPath); err != nil {
-			return nil, err
-		} else if width, err = data.ToInt(wv); err != nil {
-			return nil, err
-		}
-		var height int64
-		if hv, err := rmap.Get(heightPath); err != nil {
-			return nil, err
-		} else if height, err = data.ToInt(hv); err != nil {
-			return nil, err
-		}
-		rect := bridge.Rect{
-			X:      int(x),
-			Y:      int(y),
-			Width:  int(width),
-			Height: int(height),
-		}
-		brRects[i] = rect
-	}
-	return brRects, nil
-}
-
 // NewSharedImage returns shared image file to reduce I/O cost.
 func NewSharedImage(ctx *core.Context, params data.Map) (core.SharedState, error) {
 	var filePath string
@@ -170,7 +665,10 @@ func NewSharedImage(ctx *core.Context, params data.Map) (core.SharedState, error
 	} else if filePath, err = data.AsString(fp); err != nil {
 		return nil, err
 	}
-	mat := bridge.LoadAlphaImage(filePath)
+	mat, err := bridge.LoadAlphaImage(filePath)
+	if err != nil {
+		return nil, err
+	}
 	return &sharedImage{
 		img: mat,
 	}, nil
@@ -213,18 +711,20 @@ func MountAlphaImage(ctx *core.Context, imgName string, back data.Map,
 	if err != nil {
 		return nil, err
 	}
-	mat, err := raw.ToMatVec3b()
+	mat, err := defaultMatVec3bPool.get(&raw)
 	if err != nil {
 		return nil, err
 	}
-	defer mat.Delete()
+	defer defaultMatVec3bPool.put(mat)
 
 	brRects, err := convertToBridgeRects(rects)
 	if err != nil {
 		return nil, err
 	}
 
-	bridge.MountAlphaImage(img.img, mat, brRects)
+	if err := bridge.MountAlphaImage(img.img, mat, brRects); err != nil {
+		return nil, err
+	}
 	retRaw := ToRawData(mat)
 	return retRaw.ConvertToDataMap(), nil
 }
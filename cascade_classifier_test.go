@@ -1,35 +1,28 @@
+//go:build cgo
+// +build cgo
+
 package opencv
 
 import (
 	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/opencv.v0/bridge"
 	"gopkg.in/sensorbee/sensorbee.v0/core"
 	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"image"
+	"image/color"
+	"image/png"
 	"io/ioutil"
 	"os"
+	"runtime"
 	"testing"
 )
 
-func TestNewCascadeClassifier(t *testing.T) {
-	Convey("Given a SensorBee's core.Context", t, func() {
-		ctx := &core.Context{}
-		Convey("When create state with empty map", func() {
-			params := data.Map{}
-			_, err := NewCascadeClassifier(ctx, params)
-			Convey("Then should return an error", func() {
-				So(err, ShouldNotBeNil)
-			})
-		})
-		Convey("When create state with not exist file name", func() {
-			params := data.Map{
-				"file": data.String("not_exist_file"),
-			}
-			_, err := NewCascadeClassifier(ctx, params)
-			Convey("Then should return an error", func() {
-				So(err, ShouldNotBeNil)
-			})
-		})
-		Convey("When create state with file name", func() {
-			xml := `<?xml version="1.0"?>
+// cascadeFileEnv is an environment variable to set a cascade file used by
+// benchmarks, e.g. "haarcascade_frontalface_default.xml" in OpenCV's data.
+const cascadeFileEnv = "OPENCV_CASCADE_FILE"
+
+// emptyCascadeXML is a cascade file which has no stage.
+const emptyCascadeXML = `<?xml version="1.0"?>
 <opencv_storage>
 <cascade>
   <stageType>BOOST</stageType>
@@ -55,7 +48,29 @@ func TestNewCascadeClassifier(t *testing.T) {
 </cascade>
 </opencv_storage>
 `
-			err := ioutil.WriteFile("_test_for_face_detect.xml", []byte(xml), 0644)
+
+func TestNewCascadeClassifier(t *testing.T) {
+	Convey("Given a SensorBee's core.Context", t, func() {
+		ctx := &core.Context{}
+		Convey("When create state with empty map", func() {
+			params := data.Map{}
+			_, err := NewCascadeClassifier(ctx, params)
+			Convey("Then should return an error", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+		Convey("When create state with not exist file name", func() {
+			params := data.Map{
+				"file": data.String("not_exist_file"),
+			}
+			_, err := NewCascadeClassifier(ctx, params)
+			Convey("Then should return an error", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+		Convey("When create state with file name", func() {
+			err := ioutil.WriteFile("_test_for_face_detect.xml", []byte(emptyCascadeXML),
+				0644)
 			So(err, ShouldBeNil)
 			Reset(func() {
 				os.Remove("_test_for_face_detect.xml")
@@ -71,7 +86,368 @@ func TestNewCascadeClassifier(t *testing.T) {
 			Convey("Then state should be created", func() {
 				cc, ok := st.(*cascadeClassifier)
 				So(ok, ShouldBeTrue)
-				So(cc.classifier, ShouldNotBeNil)
+				So(len(cc.classifiers), ShouldEqual, 1)
+			})
+			Convey("And detect after the state is terminated", func() {
+				ctx := core.NewContext(nil)
+				So(ctx.SharedStates.Add("terminated_cc", "opencv_cascade_classifier",
+					st), ShouldBeNil)
+				So(st.Terminate(ctx), ShouldBeNil)
+				_, err := DetectMultiScale(ctx, "terminated_cc",
+					squareCVMAT(32, 32, 8, 8, 8))
+				Convey("Then it should return an error instead of blocking", func() {
+					So(err, ShouldNotBeNil)
+				})
+			})
+			Convey("And create state with parallelism", func() {
+				params := data.Map{
+					"file":        data.String("_test_for_face_detect.xml"),
+					"parallelism": data.Int(3),
+				}
+				st, err := NewCascadeClassifier(ctx, params)
+				So(err, ShouldBeNil)
+				Reset(func() {
+					st.Terminate(ctx)
+				})
+				Convey("Then state should have the classifier instances", func() {
+					cc, ok := st.(*cascadeClassifier)
+					So(ok, ShouldBeTrue)
+					So(len(cc.classifiers), ShouldEqual, 3)
+				})
+			})
+			Convey("And create state with invalid parallelism", func() {
+				for _, p := range []data.Value{data.Int(0), data.String("a")} {
+					params := data.Map{
+						"file":        data.String("_test_for_face_detect.xml"),
+						"parallelism": p,
+					}
+					_, err := NewCascadeClassifier(ctx, params)
+					So(err, ShouldNotBeNil)
+				}
+			})
+		})
+	})
+}
+
+func TestParseDetectMultiScaleParams(t *testing.T) {
+	Convey("Given OpenCV's default detectMultiScale parameters", t, func() {
+		base := detectMultiScaleParams{
+			DetectMultiScaleParams: bridge.NewDetectMultiScaleParams(),
+		}
+		Convey("When parse an empty map", func() {
+			p, err := parseDetectMultiScaleParams(data.Map{}, base)
+			Convey("Then it should return the defaults", func() {
+				So(err, ShouldBeNil)
+				So(p, ShouldResemble, base)
+			})
+		})
+
+		Convey("When parse a map which has all parameters", func() {
+			p, err := parseDetectMultiScaleParams(data.Map{
+				"file":          data.String("ignored.xml"),
+				"scale_factor":  data.Float(1.2),
+				"min_neighbors": data.Int(5),
+				"flags":         data.Int(2),
+				"min_size": data.Map{
+					"width":  data.Int(30),
+					"height": data.Int(40),
+				},
+				"max_size": data.Map{
+					"width":  data.Int(300),
+					"height": data.Int(400),
+				},
+				"output_reject_levels": data.True,
+			}, base)
+			Convey("Then it should return the parameters", func() {
+				So(err, ShouldBeNil)
+				So(p.outputRejectLevels, ShouldBeTrue)
+				expected := bridge.NewDetectMultiScaleParams()
+				expected.ScaleFactor = 1.2
+				expected.MinNeighbors = 5
+				expected.Flags = 2
+				expected.MinWidth = 30
+				expected.MinHeight = 40
+				expected.MaxWidth = 300
+				expected.MaxHeight = 400
+				So(p.DetectMultiScaleParams, ShouldResemble, expected)
+			})
+		})
+
+		Convey("When parse invalid parameters", func() {
+			cases := map[string]data.Map{
+				"scale_factor 1.0": {"scale_factor": data.Float(1.0)},
+				"string scale_factor": {
+					"scale_factor": data.String("a"),
+				},
+				"negative min_neighbors": {"min_neighbors": data.Int(-1)},
+				"negative flags":         {"flags": data.Int(-1)},
+				"string output_reject_levels": {
+					"output_reject_levels": data.String("true"),
+				},
+				"min_size without height": {
+					"min_size": data.Map{"width": data.Int(1)},
+				},
+				"negative max_size": {
+					"max_size": data.Map{
+						"width":  data.Int(-1),
+						"height": data.Int(10),
+					},
+				},
+				"max_size smaller than min_size": {
+					"min_size": data.Map{
+						"width":  data.Int(100),
+						"height": data.Int(100),
+					},
+					"max_size": data.Map{
+						"width":  data.Int(50),
+						"height": data.Int(200),
+					},
+				},
+			}
+			for name, params := range cases {
+				params := params
+				Convey("Then it should return an error with "+name, func() {
+					_, err := parseDetectMultiScaleParams(params, base)
+					So(err, ShouldNotBeNil)
+				})
+			}
+		})
+	})
+}
+
+func TestParsePreprocessParams(t *testing.T) {
+	Convey("Given parameters without preprocessing", t, func() {
+		base := bridge.NewDetectMultiScaleParams()
+		Convey("When parse a map which has all preprocessing parameters", func() {
+			p, err := parsePreprocessParams(data.Map{
+				"scale_factor":     data.Float(1.2),
+				"grayscale":        data.True,
+				"equalize":         data.String("CLAHE"),
+				"clahe_clip_limit": data.Float(4.0),
+				"clahe_tile_size":  data.Int(4),
+				"downscale":        data.Float(2.0),
+			}, base)
+			Convey("Then it should return the parameters", func() {
+				So(err, ShouldBeNil)
+				expected := bridge.NewDetectMultiScaleParams()
+				expected.Grayscale = true
+				expected.Equalize = bridge.EqualizeCLAHE
+				expected.CLAHEClipLimit = 4.0
+				expected.CLAHETileSize = 4
+				expected.Downscale = 2.0
+				So(p, ShouldResemble, expected)
+			})
+		})
+
+		Convey("When parse invalid parameters", func() {
+			cases := map[string]data.Map{
+				"string grayscale":   {"grayscale": data.String("yes")},
+				"unknown equalize":   {"equalize": data.String("gamma")},
+				"zero clip limit":    {"clahe_clip_limit": data.Float(0)},
+				"zero tile size":     {"clahe_tile_size": data.Int(0)},
+				"downscale 0.5":      {"downscale": data.Float(0.5)},
+				"string downscale":   {"downscale": data.String("2")},
+				"float tile size":    {"clahe_tile_size": data.Float(1.5)},
+				"integer equalize":   {"equalize": data.Int(1)},
+				"negative downscale": {"downscale": data.Float(-2)},
+			}
+			for name, params := range cases {
+				params := params
+				Convey("Then it should return an error with "+name, func() {
+					_, err := parsePreprocessParams(params, base)
+					So(err, ShouldNotBeNil)
+				})
+			}
+		})
+	})
+}
+
+func TestParseDetectRegions(t *testing.T) {
+	Convey("Given a parameter map with roi", t, func() {
+		params := data.Map{
+			"roi": data.Array{
+				data.Map{
+					"x":      data.Int(10),
+					"y":      data.Int(20),
+					"width":  data.Int(30),
+					"height": data.Int(40),
+				},
+				data.Array{
+					data.Map{"x": data.Int(0), "y": data.Int(0)},
+					data.Map{"x": data.Int(50), "y": data.Int(0)},
+					data.Map{"x": data.Int(0), "y": data.Int(50)},
+				},
+			},
+		}
+		Convey("When parse regions", func() {
+			regions, err := parseDetectRegions(params)
+			Convey("Then it should return a rectangle and a polygon", func() {
+				So(err, ShouldBeNil)
+				So(len(regions), ShouldEqual, 2)
+				So(regions[0].ROI, ShouldResemble, bridge.Rect{
+					X: 10, Y: 20, Width: 30, Height: 40})
+				So(regions[0].Polygon, ShouldBeEmpty)
+				So(regions[1].ROI, ShouldResemble, bridge.Rect{})
+				So(regions[1].Polygon, ShouldResemble, []bridge.Point{
+					{X: 0, Y: 0}, {X: 50, Y: 0}, {X: 0, Y: 50}})
+			})
+		})
+
+		Convey("When roi is not set", func() {
+			regions, err := parseDetectRegions(data.Map{})
+			Convey("Then it should return no region", func() {
+				So(err, ShouldBeNil)
+				So(regions, ShouldBeNil)
+			})
+		})
+
+		Convey("When roi has invalid regions", func() {
+			cases := map[string]data.Value{
+				"not an array": data.Map{},
+				"empty rect": data.Array{data.Map{
+					"x":      data.Int(0),
+					"y":      data.Int(0),
+					"width":  data.Int(0),
+					"height": data.Int(10),
+				}},
+				"line": data.Array{data.Array{
+					data.Map{"x": data.Int(0), "y": data.Int(0)},
+					data.Map{"x": data.Int(1), "y": data.Int(1)},
+				}},
+				"string": data.Array{data.String("door")},
+			}
+			for name, roi := range cases {
+				roi := roi
+				Convey("Then it should return an error with "+name, func() {
+					_, err := parseDetectRegions(data.Map{"roi": roi})
+					So(err, ShouldNotBeNil)
+				})
+			}
+		})
+	})
+}
+
+func TestConvertToMask(t *testing.T) {
+	Convey("Given a 4x2 image", t, func() {
+		img := RawData{Format: TypeCVMAT, Width: 4, Height: 2,
+			Data: make([]byte, 4*2*3)}
+		Convey("When convert a cvmat1b mask of the same size", func() {
+			mask, err := convertToMask(data.Map{
+				"format": data.String("cvmat1b"),
+				"width":  data.Int(4),
+				"height": data.Int(2),
+				"image":  data.Blob([]byte{0, 0, 255, 255, 0, 0, 255, 255}),
+			}, &img)
+			So(err, ShouldBeNil)
+			defer mask.Delete()
+			Convey("Then it should be a CV_8UC1 Mat", func() {
+				So(mask.Type(), ShouldEqual, bridge.CvType8UC1)
+				So(mask.Rows(), ShouldEqual, 2)
+				So(mask.Cols(), ShouldEqual, 4)
+			})
+		})
+
+		Convey("When convert a mask of a different size", func() {
+			_, err := convertToMask(data.Map{
+				"format": data.String("cvmat1b"),
+				"width":  data.Int(2),
+				"height": data.Int(2),
+				"image":  data.Blob(make([]byte, 4)),
+			}, &img)
+			Convey("Then it should return an error", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+
+		Convey("When convert a color mask", func() {
+			_, err := convertToMask(data.Map{
+				"format": data.String("cvmat"),
+				"width":  data.Int(4),
+				"height": data.Int(2),
+				"image":  data.Blob(make([]byte, 4*2*3)),
+			}, &img)
+			Convey("Then it should return an error", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
+
+func TestDetectMultiScaleParams(t *testing.T) {
+	Convey("Given a context without cascade classifier", t, func() {
+		ctx := core.NewContext(nil)
+		img := data.Map{
+			"format": data.String("cvmat"),
+			"width":  data.Int(1),
+			"height": data.Int(1),
+			"image":  data.Blob([]byte{0, 0, 0}),
+		}
+		Convey("When detect with two parameter maps", func() {
+			_, err := DetectMultiScale(ctx, "cc", img, data.Map{}, data.Map{})
+			Convey("Then it should return an error", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
+
+func TestDetectNested(t *testing.T) {
+	Convey("Given outer and inner cascade classifier states", t, func() {
+		f, err := ioutil.TempFile("", "opencv_cascade")
+		So(err, ShouldBeNil)
+		_, err = f.WriteString(emptyCascadeXML)
+		So(err, ShouldBeNil)
+		So(f.Close(), ShouldBeNil)
+		Reset(func() {
+			os.Remove(f.Name())
+		})
+
+		ctx := core.NewContext(nil)
+		for _, name := range []string{"face", "eye"} {
+			st, err := NewCascadeClassifier(ctx, data.Map{
+				"file": data.String(f.Name()),
+			})
+			So(err, ShouldBeNil)
+			So(ctx.SharedStates.Add(name, "opencv_cascade_classifier", st),
+				ShouldBeNil)
+			Reset(func() {
+				st.Terminate(ctx)
+			})
+		}
+		img := data.Map{
+			"format": data.String("cvmat"),
+			"width":  data.Int(1),
+			"height": data.Int(1),
+			"image":  data.Blob([]byte{0, 0, 0}),
+		}
+
+		Convey("When detect with invalid parameters", func() {
+			cases := map[string]data.Map{
+				"unknown key":     {"eyes": data.Map{}},
+				"outer not a map": {"outer": data.Int(1)},
+				"inner roi": {"inner": data.Map{
+					"roi": data.Array{},
+				}},
+				"inner unknown key": {"inner": data.Map{
+					"scale": data.Float(1.2),
+				}},
+				"invalid inner scale_factor": {"inner": data.Map{
+					"scale_factor": data.Float(0.5),
+				}},
+			}
+			for name, params := range cases {
+				params := params
+				Convey("Then it should return an error with "+name, func() {
+					_, err := DetectNested(ctx, "face", "eye", img, params)
+					So(err, ShouldNotBeNil)
+				})
+			}
+		})
+
+		Convey("When detect with a not exist state", func() {
+			_, err := DetectNested(ctx, "face", "smile", img)
+			Convey("Then it should return an error", func() {
+				So(err, ShouldNotBeNil)
 			})
 		})
 	})
@@ -102,5 +478,172 @@ func TestNewSharedImage(t *testing.T) {
 				So(cc.img, ShouldNotBeNil)
 			})
 		})
+		Convey("When create state with an image file which has no alpha channel", func() {
+			f, err := ioutil.TempFile("", "opencv_shared_image")
+			So(err, ShouldBeNil)
+			Reset(func() {
+				os.Remove(f.Name())
+			})
+			// 1x1 RGB image cannot be converted to cv::Mat_<cv::Vec4b>, OpenCV
+			// raises an assertion error.
+			img := image.NewRGBA(image.Rect(0, 0, 1, 1))
+			img.Set(0, 0, color.RGBA{R: 1, G: 2, B: 3, A: 255})
+			So(png.Encode(f, img), ShouldBeNil)
+			So(f.Close(), ShouldBeNil)
+
+			params := data.Map{
+				"file": data.String(f.Name()),
+			}
+			_, err = NewSharedImage(ctx, params)
+			Convey("Then should return an error", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
+
+func TestMountAlphaImage(t *testing.T) {
+	Convey("Given a shared image state of a not exist file", t, func() {
+		ctx := core.NewContext(nil)
+		st, err := NewSharedImage(ctx, data.Map{
+			"file": data.String("not_exist.png"),
+		})
+		So(err, ShouldBeNil)
+		So(ctx.SharedStates.Add("img", "opencv_shared_image", st), ShouldBeNil)
+		Reset(func() {
+			st.Terminate(ctx)
+		})
+
+		back := data.Map{
+			"format": data.String("cvmat"),
+			"width":  data.Int(10),
+			"height": data.Int(10),
+			"image":  data.Blob(make([]byte, 10*10*3)),
+		}
+		rects := data.Array{
+			data.Map{
+				"x":      data.Int(2),
+				"y":      data.Int(2),
+				"width":  data.Int(5),
+				"height": data.Int(5),
+			},
+		}
+		Convey("When mount the empty image", func() {
+			_, err := MountAlphaImage(ctx, "img", back, rects)
+			Convey("Then it should return an error raised by OpenCV", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
 	})
 }
+
+func TestDrawRectsToImage(t *testing.T) {
+	Convey("Given a 10x10 black image", t, func() {
+		org := make([]byte, 10*10*3)
+		img := data.Map{
+			"format": data.String("cvmat"),
+			"width":  data.Int(10),
+			"height": data.Int(10),
+			"image":  data.Blob(append([]byte{}, org...)),
+		}
+		rects := data.Array{
+			data.Map{
+				"x":      data.Int(2),
+				"y":      data.Int(2),
+				"width":  data.Int(5),
+				"height": data.Int(5),
+			},
+		}
+		Convey("When draw rects to the image", func() {
+			ret, err := DrawRectsToImage(img, rects)
+			So(err, ShouldBeNil)
+			Convey("Then the returned image should have the rects", func() {
+				b, err := data.ToBlob(ret["image"])
+				So(err, ShouldBeNil)
+				So(b, ShouldNotResemble, org)
+			})
+			Convey("Then the source image should not be modified", func() {
+				b, err := data.ToBlob(img["image"])
+				So(err, ShouldBeNil)
+				So(b, ShouldResemble, org)
+			})
+		})
+
+		Convey("When the image size does not match with the data", func() {
+			img["width"] = data.Int(11)
+			Convey("Then it should return an error", func() {
+				_, err := DrawRectsToImage(img, rects)
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
+
+func BenchmarkDetectMultiScale(b *testing.B) {
+	ctx := newBenchmarkCascadeContext(b, 1)
+	raw := newBenchmarkFrame(640, 480)
+	img := raw.ConvertToDataMap()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := DetectMultiScale(ctx, "cc", img); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkDetectMultiScaleParallel(b *testing.B) {
+	ctx := newBenchmarkCascadeContext(b, runtime.GOMAXPROCS(0))
+	raw := newBenchmarkFrame(640, 480)
+	img := raw.ConvertToDataMap()
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if _, err := DetectMultiScale(ctx, "cc", img); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+// newBenchmarkCascadeContext returns a context which has "cc" cascade
+// classifier state, the benchmark is skipped when the cascade file is not set.
+func newBenchmarkCascadeContext(b *testing.B, parallelism int) *core.Context {
+	file := os.Getenv(cascadeFileEnv)
+	if file == "" {
+		b.Skipf("%v is not set", cascadeFileEnv)
+	}
+	ctx := core.NewContext(nil)
+	st, err := NewCascadeClassifier(ctx, data.Map{
+		"file":        data.String(file),
+		"parallelism": data.Int(parallelism),
+	})
+	if err != nil {
+		b.Fatal(err)
+	}
+	if err := ctx.SharedStates.Add("cc", "opencv_cascade_classifier", st); err != nil {
+		b.Fatal(err)
+	}
+	return ctx
+}
+
+func BenchmarkDrawRectsToImage(b *testing.B) {
+	raw := newBenchmarkFrame(1920, 1080)
+	img := raw.ConvertToDataMap()
+	rects := data.Array{
+		data.Map{
+			"x":      data.Int(100),
+			"y":      data.Int(100),
+			"width":  data.Int(200),
+			"height": data.Int(200),
+		},
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := DrawRectsToImage(img, rects); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,239 @@
+package opencv
+
+import (
+	"fmt"
+	"gopkg.in/sensorbee/opencv.v0/bridge"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"math"
+	"sort"
+)
+
+// Layouts of detection outputs of networks.
+const (
+	// layoutSSD is an output of SSD models such as MobileNet-SSD, which has
+	// shape [1, 1, N, 7]. Each row is [image_id, class_id, confidence, left,
+	// top, right, bottom], coordinates are normalized to 0-1.
+	layoutSSD = "ssd"
+	// layoutYOLO is an output of YOLO region layers of OpenCV, which has
+	// shape [N, 5+C]. Each row is [center_x, center_y, width, height,
+	// objectness, class scores...], coordinates are normalized to 0-1 and
+	// class scores are already multiplied by objectness.
+	layoutYOLO = "yolo"
+)
+
+// detection is an object detected by a network.
+type detection struct {
+	classID    int
+	confidence float64
+	rect       bridge.Rect
+}
+
+// toMap converts the detection to a rectangle map which also has "class_id"
+// and "confidence".
+func (d *detection) toMap() data.Map {
+	m := convertFromBridgeRect(d.rect)
+	m["class_id"] = data.Int(d.classID)
+	m["confidence"] = data.Float(d.confidence)
+	return m
+}
+
+// inputRegion is the region of an image which is in the input blob of a
+// network, coordinates normalized to 0-1 by the network are relative to it.
+type inputRegion struct {
+	x      float64
+	y      float64
+	width  float64
+	height float64
+	// imageWidth and imageHeight are the size of the whole image, which
+	// detections are clamped to.
+	imageWidth  int
+	imageHeight int
+}
+
+// newInputRegion returns the region of an image of the size in an input
+// blob of the blob size. Zero blob size is the size of the image. When crop
+// is true, the image is resized keeping the aspect ratio to cover the blob
+// and cropped at the center as same as `cv::dnn::blobFromImage`, otherwise
+// the whole image is resized to the blob.
+func newInputRegion(width, height, blobWidth, blobHeight int,
+	crop bool) inputRegion {
+	r := inputRegion{
+		width:       float64(width),
+		height:      float64(height),
+		imageWidth:  width,
+		imageHeight: height,
+	}
+	if !crop || blobWidth == 0 || blobHeight == 0 || width == 0 ||
+		height == 0 {
+		return r
+	}
+	f := math.Max(float64(blobWidth)/float64(width),
+		float64(blobHeight)/float64(height))
+	r.width = float64(blobWidth) / f
+	r.height = float64(blobHeight) / f
+	r.x = (float64(width) - r.width) / 2
+	r.y = (float64(height) - r.height) / 2
+	return r
+}
+
+// toImage maps normalized coordinates to coordinates of the image.
+func (r *inputRegion) toImage(nx, ny float64) (float64, float64) {
+	return r.x + nx*r.width, r.y + ny*r.height
+}
+
+// clamp returns the part of the rectangle inside the image.
+func (r *inputRegion) clamp(rect bridge.Rect) bridge.Rect {
+	return clampRect(rect, r.imageWidth, r.imageHeight)
+}
+
+// decodeDetections decodes output tensors of the layout to detections in the
+// image of the input region. Detections less confident than the threshold
+// are dropped.
+func decodeDetections(layout string, tensors []bridge.Tensor,
+	region inputRegion, threshold float64) ([]detection, error) {
+	var decode func(bridge.Tensor, inputRegion, float64) ([]detection, error)
+	switch layout {
+	case layoutSSD:
+		decode = decodeSSD
+	case layoutYOLO:
+		decode = decodeYOLO
+	default:
+		return nil, fmt.Errorf("'%v' layout is not supported", layout)
+	}
+	ret := []detection{}
+	for _, t := range tensors {
+		dets, err := decode(t, region, threshold)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, dets...)
+	}
+	return ret, nil
+}
+
+// tensorRows returns the number of rows of a tensor which has `cols` values
+// in the last dimension.
+func tensorRows(t bridge.Tensor, cols int) (int, error) {
+	if len(t.Shape) == 0 || len(t.Data)%cols != 0 {
+		return 0, fmt.Errorf("tensor '%v' of shape %v cannot be decoded",
+			t.Name, t.Shape)
+	}
+	return len(t.Data) / cols, nil
+}
+
+// decodeSSD decodes a tensor of layoutSSD.
+func decodeSSD(t bridge.Tensor, region inputRegion, threshold float64) (
+	[]detection, error) {
+	if len(t.Shape) == 0 || t.Shape[len(t.Shape)-1] != 7 {
+		return nil, fmt.Errorf("ssd output must have 7 values in a row: %v",
+			t.Shape)
+	}
+	rows, err := tensorRows(t, 7)
+	if err != nil {
+		return nil, err
+	}
+	ret := []detection{}
+	for i := 0; i < rows; i++ {
+		row := t.Data[i*7 : (i+1)*7]
+		confidence := float64(row[2])
+		if confidence < threshold {
+			continue
+		}
+		x1, y1 := region.toImage(float64(row[3]), float64(row[4]))
+		x2, y2 := region.toImage(float64(row[5]), float64(row[6]))
+		left, top := roundInt(x1), roundInt(y1)
+		right, bottom := roundInt(x2), roundInt(y2)
+		ret = append(ret, detection{
+			classID:    int(row[1]),
+			confidence: confidence,
+			rect: region.clamp(bridge.Rect{
+				X:      left,
+				Y:      top,
+				Width:  right - left,
+				Height: bottom - top,
+			}),
+		})
+	}
+	return ret, nil
+}
+
+// decodeYOLO decodes a tensor of layoutYOLO. The class of each row is the
+// class of the highest score.
+func decodeYOLO(t bridge.Tensor, region inputRegion, threshold float64) (
+	[]detection, error) {
+	if len(t.Shape) == 0 || t.Shape[len(t.Shape)-1] < 6 {
+		return nil, fmt.Errorf(
+			"yolo output must have 6 or more values in a row: %v", t.Shape)
+	}
+	cols := t.Shape[len(t.Shape)-1]
+	rows, err := tensorRows(t, cols)
+	if err != nil {
+		return nil, err
+	}
+	ret := []detection{}
+	for i := 0; i < rows; i++ {
+		row := t.Data[i*cols : (i+1)*cols]
+		classID := 0
+		for c := 1; c < cols-5; c++ {
+			if row[5+c] > row[5+classID] {
+				classID = c
+			}
+		}
+		confidence := float64(row[5+classID])
+		if confidence < threshold {
+			continue
+		}
+		cx, cy := region.toImage(float64(row[0]), float64(row[1]))
+		w := float64(row[2]) * region.width
+		h := float64(row[3]) * region.height
+		ret = append(ret, detection{
+			classID:    classID,
+			confidence: confidence,
+			rect: region.clamp(bridge.Rect{
+				X:      roundInt(cx - w/2),
+				Y:      roundInt(cy - h/2),
+				Width:  roundInt(w),
+				Height: roundInt(h),
+			}),
+		})
+	}
+	return ret, nil
+}
+
+// roundInt rounds a coordinate to the nearest integer.
+func roundInt(f float64) int {
+	return int(math.Floor(f + 0.5))
+}
+
+// suppressDetections drops detections which overlap with a more confident
+// detection of the same class by IoU larger than the threshold, by
+// suppressRects of each class. Returned detections are sorted in descending
+// order of confidence.
+func suppressDetections(dets []detection, threshold float64) []detection {
+	classes := map[int][]int{}
+	for i, d := range dets {
+		classes[d.classID] = append(classes[d.classID], i)
+	}
+	kept := []int{}
+	for _, indices := range classes {
+		rects := make([]bridge.Rect, len(indices))
+		scores := make([]float64, len(indices))
+		for j, i := range indices {
+			rects[j] = dets[i].rect
+			scores[j] = dets[i].confidence
+		}
+		for _, j := range suppressRects(rects, scores, threshold) {
+			kept = append(kept, indices[j])
+		}
+	}
+	// detections of the same confidence keep the given order
+	sort.Ints(kept)
+	sort.SliceStable(kept, func(i, j int) bool {
+		return dets[kept[i]].confidence > dets[kept[j]].confidence
+	})
+	ret := make([]detection, len(kept))
+	for i, k := range kept {
+		ret[i] = dets[k]
+	}
+	return ret
+}
@@ -0,0 +1,146 @@
+package opencv
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/opencv.v0/bridge"
+	"testing"
+)
+
+func TestDecodeSSD(t *testing.T) {
+	Convey("Given an SSD output tensor", t, func() {
+		tensor := bridge.Tensor{
+			Name:  "detection_out",
+			Shape: []int{1, 1, 3, 7},
+			Data: []float32{
+				0, 15, 0.9, 0.1, 0.2, 0.5, 0.6,
+				0, 7, 0.3, 0.0, 0.0, 0.5, 0.5,
+				0, 2, 0.8, -0.1, 0.5, 0.4, 1.2,
+			},
+		}
+		region := newInputRegion(200, 100, 0, 0, false)
+		Convey("When decode it with a threshold", func() {
+			dets, err := decodeSSD(tensor, region, 0.5)
+			Convey("Then it should return confident detections in the image", func() {
+				So(err, ShouldBeNil)
+				So(dets, ShouldResemble, []detection{
+					{classID: 15, confidence: float64(float32(0.9)),
+						rect: bridge.Rect{X: 20, Y: 20, Width: 80, Height: 40}},
+					{classID: 2, confidence: float64(float32(0.8)),
+						rect: bridge.Rect{X: 0, Y: 50, Width: 80, Height: 50}},
+				})
+			})
+		})
+		Convey("When the tensor has an invalid shape", func() {
+			tensor.Shape = []int{1, 1, 3, 6}
+			_, err := decodeSSD(tensor, region, 0.5)
+			Convey("Then it should return an error", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
+
+func TestDecodeYOLO(t *testing.T) {
+	Convey("Given a YOLO output tensor which has 2 classes", t, func() {
+		tensor := bridge.Tensor{
+			Name:  "yolo_82",
+			Shape: []int{2, 7},
+			Data: []float32{
+				0.5, 0.5, 0.5, 0.2, 0.9, 0.1, 0.75,
+				0.5, 0.5, 0.1, 0.1, 0.2, 0.2, 0.1,
+			},
+		}
+		region := newInputRegion(100, 100, 0, 0, false)
+		Convey("When decode it with a threshold", func() {
+			dets, err := decodeYOLO(tensor, region, 0.5)
+			Convey("Then it should return the class of the highest score", func() {
+				So(err, ShouldBeNil)
+				So(dets, ShouldResemble, []detection{
+					{classID: 1, confidence: 0.75,
+						rect: bridge.Rect{X: 25, Y: 40, Width: 50, Height: 20}},
+				})
+			})
+		})
+		Convey("When the tensor has no class score", func() {
+			tensor.Shape = []int{2, 5}
+			_, err := decodeYOLO(tensor, region, 0.5)
+			Convey("Then it should return an error", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+		Convey("When decode it by an unsupported layout", func() {
+			_, err := decodeDetections("rcnn", []bridge.Tensor{tensor}, region,
+				0.5)
+			Convey("Then it should return an error", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
+
+func TestDecodeDetectionsCropped(t *testing.T) {
+	Convey("Given a non-square image cropped to a square input blob", t, func() {
+		// the 400x200 image is resized to 200x100 and the center 100x100 is
+		// cropped, so the network sees the region from x=100 to x=300.
+		region := newInputRegion(400, 200, 100, 100, true)
+		Convey("When decode an SSD output", func() {
+			dets, err := decodeDetections(layoutSSD, []bridge.Tensor{{
+				Name:  "detection_out",
+				Shape: []int{1, 1, 1, 7},
+				Data:  []float32{0, 1, 0.9, 0.25, 0.25, 0.75, 0.75},
+			}}, region, 0.5)
+			Convey("Then rects should be mapped through the cropped region", func() {
+				So(err, ShouldBeNil)
+				So(dets, ShouldHaveLength, 1)
+				So(dets[0].rect, ShouldResemble,
+					bridge.Rect{X: 150, Y: 50, Width: 100, Height: 100})
+			})
+		})
+		Convey("When decode a YOLO output", func() {
+			dets, err := decodeDetections(layoutYOLO, []bridge.Tensor{{
+				Name:  "yolo_82",
+				Shape: []int{1, 6},
+				Data:  []float32{0.5, 0.5, 0.5, 0.25, 0.9, 0.9},
+			}}, region, 0.5)
+			Convey("Then rects should be mapped through the cropped region", func() {
+				So(err, ShouldBeNil)
+				So(dets, ShouldHaveLength, 1)
+				So(dets[0].rect, ShouldResemble,
+					bridge.Rect{X: 150, Y: 75, Width: 100, Height: 50})
+			})
+		})
+	})
+
+	Convey("Given an image which is not cropped", t, func() {
+		Convey("When compute the input region", func() {
+			region := newInputRegion(400, 200, 100, 100, false)
+			Convey("Then it should be the whole image", func() {
+				So(region, ShouldResemble, inputRegion{width: 400, height: 200,
+					imageWidth: 400, imageHeight: 200})
+			})
+		})
+	})
+}
+
+func TestSuppressDetections(t *testing.T) {
+	Convey("Given overlapped detections", t, func() {
+		dets := []detection{
+			{classID: 0, confidence: 0.6, rect: bridge.Rect{X: 0, Y: 0, Width: 10, Height: 10}},
+			{classID: 0, confidence: 0.9, rect: bridge.Rect{X: 1, Y: 0, Width: 10, Height: 10}},
+			{classID: 1, confidence: 0.7, rect: bridge.Rect{X: 0, Y: 0, Width: 10, Height: 10}},
+			{classID: 0, confidence: 0.8, rect: bridge.Rect{X: 50, Y: 50, Width: 10, Height: 10}},
+		}
+		Convey("When suppress them", func() {
+			ret := suppressDetections(dets, 0.4)
+			Convey("Then it should keep the most confident one of each class", func() {
+				So(ret, ShouldResemble, []detection{dets[1], dets[3], dets[2]})
+			})
+		})
+		Convey("When suppress them with threshold 1", func() {
+			ret := suppressDetections(dets, 1)
+			Convey("Then it should keep all of them", func() {
+				So(len(ret), ShouldEqual, len(dets))
+			})
+		})
+	})
+}
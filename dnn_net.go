@@ -0,0 +1,392 @@
+//go:build cgo
+// +build cgo
+
+package opencv
+
+import (
+	"fmt"
+	"gopkg.in/sensorbee/opencv.v0/bridge"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"strings"
+)
+
+var (
+	modelPath               = data.MustCompilePath("model")
+	modelConfigPath         = data.MustCompilePath("config")
+	frameworkPath           = data.MustCompilePath("framework")
+	inputSizePath           = data.MustCompilePath("input_size")
+	meanPath                = data.MustCompilePath("mean")
+	swapRBPath              = data.MustCompilePath("swap_rb")
+	cropPath                = data.MustCompilePath("crop")
+	layoutPath              = data.MustCompilePath("layout")
+	confidenceThresholdPath = data.MustCompilePath("confidence_threshold")
+	nmsThresholdPath        = data.MustCompilePath("nms_threshold")
+)
+
+// dnnDetectParamKeys are keys of a parameter map of DNNDetect.
+var dnnDetectParamKeys = map[string]bool{
+	"layout":               true,
+	"confidence_threshold": true,
+	"nms_threshold":        true,
+}
+
+// NewDNNNet returns dnnNet state, which has a network loaded by OpenCV's dnn
+// module. It requires OpenCV 3.4 or later.
+//
+// model: A model file path, e.g. "model.onnx", "model.caffemodel", "model.pb"
+// or "yolov3.weights". The framework is detected from the file extension.
+//
+// config: A network description file path, which is required by some
+// frameworks, e.g. "deploy.prototxt" of Caffe and "yolov3.cfg" of Darknet.
+// Default is empty.
+//
+// framework: An explicit framework name, e.g. "onnx", "caffe", "tensorflow"
+// or "darknet". Default is empty.
+//
+// The following parameters make an input blob from an image.
+//
+// input_size: The size of the input blob as a map which has "width" and
+// "height", the image is resized to it. Default is the size of each image.
+//
+// mean: Mean values subtracted from each channel, a number or an array of
+// numbers in order of the image channels, e.g. [104, 117, 123]. Default is 0.
+//
+// scale: A multiplier of values after subtracting mean, e.g. 0.00392
+// (1/255). Default is 1.0.
+//
+// swap_rb: If set `true` then the first and the last channels are swapped,
+// i.e. the blob is RGB. Default is false.
+//
+// crop: If set `true` then the image is resized keeping the aspect ratio and
+// cropped at the center. Rectangles of DNNDetect are mapped back to the whole
+// image. Default is false.
+//
+// The following parameters are defaults of DNNDetect, they can be
+// overwritten by a parameter map of each call.
+//
+// layout: Layout of the network outputs, "ssd" or "yolo". "ssd" is an output
+// of [1, 1, N, 7] such as MobileNet-SSD, and "yolo" is an output of Darknet
+// YOLO region layers which has [N, 5 + the number of classes]. Default is
+// "ssd".
+//
+// confidence_threshold: Detections less confident than it are dropped.
+// Default is 0.5.
+//
+// nms_threshold: Detections of the same class overlapped with a more
+// confident one by IoU larger than it are dropped. 1 disables suppression.
+// Default is 0.4.
+//
+// parallelism: The number of network instances loaded from the files. Each
+// call checks out an instance as same as the cascade classifier state.
+// Default is 1.
+func NewDNNNet(ctx *core.Context, params data.Map) (core.SharedState,
+	error) {
+	var model string
+	if v, err := params.Get(modelPath); err != nil {
+		return nil, err
+	} else if model, err = data.AsString(v); err != nil {
+		return nil, err
+	}
+	config := ""
+	if v, err := params.Get(modelConfigPath); err == nil {
+		if config, err = data.AsString(v); err != nil {
+			return nil, err
+		}
+	}
+	framework := ""
+	if v, err := params.Get(frameworkPath); err == nil {
+		if framework, err = data.AsString(v); err != nil {
+			return nil, err
+		}
+	}
+
+	blobParams, err := parseBlobParams(params)
+	if err != nil {
+		return nil, err
+	}
+	detectParams, err := parseDNNDetectParams(params, dnnDetectParams{
+		layout:              layoutSSD,
+		confidenceThreshold: 0.5,
+		nmsThreshold:        0.4,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	parallelism := int64(1)
+	if p, err := params.Get(parallelismPath); err == nil {
+		if parallelism, err = data.AsInt(p); err != nil {
+			return nil, err
+		}
+		if parallelism < 1 {
+			return nil, fmt.Errorf("parallelism must be positive: %v",
+				parallelism)
+		}
+	}
+
+	n := &dnnNet{
+		nets:         make([]bridge.Net, parallelism),
+		blobParams:   blobParams,
+		detectParams: detectParams,
+	}
+	for i := range n.nets {
+		net, err := bridge.ReadNet(model, config, framework)
+		if err != nil {
+			for j := 0; j < i; j++ {
+				n.nets[j].Delete()
+			}
+			return nil, err
+		}
+		n.nets[i] = net
+	}
+	n.pool = newInstancePool(len(n.nets), func(i int) {
+		n.nets[i].Delete()
+	})
+	return n, nil
+}
+
+// dnnNet has a pool of network instances, `cv::dnn::Net` is not thread-safe.
+type dnnNet struct {
+	nets         []bridge.Net
+	pool         *instancePool
+	blobParams   bridge.BlobParams
+	detectParams dnnDetectParams
+}
+
+// dnnDetectParams is parameters of DNNDetect.
+type dnnDetectParams struct {
+	layout              string
+	confidenceThreshold float64
+	nmsThreshold        float64
+}
+
+// parseBlobParams returns parameters to make an input blob.
+func parseBlobParams(params data.Map) (bridge.BlobParams, error) {
+	p := bridge.NewBlobParams()
+	if v, err := params.Get(inputSizePath); err == nil {
+		w, h, err := parseSize(v)
+		if err != nil {
+			return p, fmt.Errorf("invalid input_size: %v", err)
+		}
+		if w == 0 || h == 0 {
+			return p, fmt.Errorf("input_size must have positive size: %v", v)
+		}
+		p.Width, p.Height = w, h
+	}
+	if v, err := params.Get(meanPath); err == nil {
+		if arr, err := data.AsArray(v); err == nil {
+			if len(arr) == 0 || len(arr) > len(p.Mean) {
+				return p, fmt.Errorf("mean must have 1 to %v values: %v",
+					len(p.Mean), len(arr))
+			}
+			for i, m := range arr {
+				if p.Mean[i], err = data.ToFloat(m); err != nil {
+					return p, err
+				}
+			}
+		} else {
+			m, err := data.ToFloat(v)
+			if err != nil {
+				return p, err
+			}
+			for i := range p.Mean {
+				p.Mean[i] = m
+			}
+		}
+	}
+	if v, err := params.Get(scalePath); err == nil {
+		if p.Scale, err = data.ToFloat(v); err != nil {
+			return p, err
+		}
+		if p.Scale == 0 {
+			return p, fmt.Errorf("scale must not be zero")
+		}
+	}
+	if v, err := params.Get(swapRBPath); err == nil {
+		if p.SwapRB, err = data.AsBool(v); err != nil {
+			return p, err
+		}
+	}
+	if v, err := params.Get(cropPath); err == nil {
+		if p.Crop, err = data.AsBool(v); err != nil {
+			return p, err
+		}
+	}
+	return p, nil
+}
+
+// parseDNNDetectParams returns base overwritten by parameters in the map.
+// Keys which are not parameters are ignored.
+func parseDNNDetectParams(params data.Map, base dnnDetectParams) (
+	dnnDetectParams, error) {
+	p := base
+	if v, err := params.Get(layoutPath); err == nil {
+		layout, err := data.AsString(v)
+		if err != nil {
+			return p, err
+		}
+		switch l := strings.ToLower(layout); l {
+		case layoutSSD, layoutYOLO:
+			p.layout = l
+		default:
+			return p, fmt.Errorf("'%v' layout is not supported", layout)
+		}
+	}
+	if v, err := params.Get(confidenceThresholdPath); err == nil {
+		if p.confidenceThreshold, err = data.ToFloat(v); err != nil {
+			return p, err
+		}
+	}
+	if v, err := params.Get(nmsThresholdPath); err == nil {
+		t, err := data.ToFloat(v)
+		if err != nil {
+			return p, err
+		}
+		if t < 0 || t > 1 {
+			return p, fmt.Errorf("nms_threshold must be from 0 to 1: %v", t)
+		}
+		p.nmsThreshold = t
+	}
+	return p, nil
+}
+
+// Terminate deletes all instances. Instances used by running calls are
+// deleted when the calls finish, and following calls fail.
+func (n *dnnNet) Terminate(ctx *core.Context) error {
+	n.pool.terminate()
+	return nil
+}
+
+func lookupDNNNet(ctx *core.Context, name string) (*dnnNet, error) {
+	st, err := ctx.SharedStates.Get(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if s, ok := st.(*dnnNet); ok {
+		return s, nil
+	}
+	return nil, fmt.Errorf("state '%v' cannot be converted to dnn_net.state",
+		name)
+}
+
+// forward runs the network on the image by an instance checked out from the
+// pool. Returns the output tensors and the region of the image in the input
+// blob, which is cropped when crop is true.
+func (n *dnnNet) forward(img data.Map) ([]bridge.Tensor, inputRegion, error) {
+	raw, err := ConvertMapToRawData(img)
+	if err != nil {
+		return nil, inputRegion{}, err
+	}
+	mat, err := defaultMatVec3bPool.get(&raw)
+	if err != nil {
+		return nil, inputRegion{}, err
+	}
+	defer defaultMatVec3bPool.put(mat)
+
+	i, err := n.pool.get()
+	if err != nil {
+		return nil, inputRegion{}, err
+	}
+	defer n.pool.put(i)
+	tensors, err := n.nets[i].Forward(mat, n.blobParams)
+	if err != nil {
+		return nil, inputRegion{}, err
+	}
+	return tensors, newInputRegion(raw.Width, raw.Height, n.blobParams.Width,
+		n.blobParams.Height, n.blobParams.Crop), nil
+}
+
+// DNNForward runs the network on the image and returns raw outputs.
+//
+// netName: dnnNet state name.
+//
+// img: target image as RawData map structure.
+//
+// Returns an array of output tensors of the network. A tensor is a map which
+// has "name" of the output layer, "shape" as an array of integers and "data"
+// as a flat array of floats in row-major order of the shape.
+func DNNForward(ctx *core.Context, netName string, img data.Map) (data.Array,
+	error) {
+	n, err := lookupDNNNet(ctx, netName)
+	if err != nil {
+		return nil, err
+	}
+	tensors, _, err := n.forward(img)
+	if err != nil {
+		return nil, err
+	}
+	ret := make(data.Array, len(tensors))
+	for i, t := range tensors {
+		shape := make(data.Array, len(t.Shape))
+		for j, s := range t.Shape {
+			shape[j] = data.Int(s)
+		}
+		values := make(data.Array, len(t.Data))
+		for j, v := range t.Data {
+			values[j] = data.Float(v)
+		}
+		ret[i] = data.Map{
+			"name":  data.String(t.Name),
+			"shape": shape,
+			"data":  values,
+		}
+	}
+	return ret, nil
+}
+
+// DNNDetect runs the network on the image and decodes detections from the
+// outputs.
+//
+// netName: dnnNet state name.
+//
+// img: target image as RawData map structure.
+//
+// params: optional parameter map, which has "layout", "confidence_threshold"
+// and "nms_threshold" as same as NewDNNNet, e.g. {"confidence_threshold":
+// 0.7}.
+//
+// Returns an array of rectangles in descending order of confidence, which
+// have "x", "y", "width", "height", "class_id" and "confidence". Rectangles
+// are coordinates of the image, also when crop is true, and can be drawn by
+// DrawRectsToImage.
+func DNNDetect(ctx *core.Context, netName string, img data.Map,
+	params ...data.Map) (data.Array, error) {
+	if len(params) > 1 {
+		return nil, fmt.Errorf("too many parameter maps: %v", len(params))
+	}
+	n, err := lookupDNNNet(ctx, netName)
+	if err != nil {
+		return nil, err
+	}
+	detectParams := n.detectParams
+	if len(params) == 1 {
+		for k := range params[0] {
+			if !dnnDetectParamKeys[k] {
+				return nil, fmt.Errorf(
+					"'%v' is not a parameter of dnn detection", k)
+			}
+		}
+		if detectParams, err = parseDNNDetectParams(params[0],
+			n.detectParams); err != nil {
+			return nil, err
+		}
+	}
+
+	tensors, region, err := n.forward(img)
+	if err != nil {
+		return nil, err
+	}
+	dets, err := decodeDetections(detectParams.layout, tensors, region,
+		detectParams.confidenceThreshold)
+	if err != nil {
+		return nil, err
+	}
+	dets = suppressDetections(dets, detectParams.nmsThreshold)
+	ret := make(data.Array, len(dets))
+	for i := range dets {
+		ret[i] = dets[i].toMap()
+	}
+	return ret, nil
+}
@@ -0,0 +1,182 @@
+//go:build cgo
+// +build cgo
+
+package opencv
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/opencv.v0/bridge"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"testing"
+)
+
+// reluModelFile is an ONNX model which has only a Relu node of an input
+// "data" shaped [1, 3, 2, 2].
+const reluModelFile = "testdata/relu.onnx"
+
+func TestNewDNNNet(t *testing.T) {
+	Convey("Given a SensorBee's core.Context", t, func() {
+		ctx := &core.Context{}
+		Convey("When create state with invalid parameters", func() {
+			cases := map[string]data.Map{
+				"empty map":      {},
+				"not exist file": {"model": data.String("not_exist_file.onnx")},
+				"unsupported layout": {
+					"model":  data.String(reluModelFile),
+					"layout": data.String("rcnn"),
+				},
+				"zero parallelism": {
+					"model":       data.String(reluModelFile),
+					"parallelism": data.Int(0),
+				},
+			}
+			for name, params := range cases {
+				Convey("Then it should return an error: "+name, func() {
+					_, err := NewDNNNet(ctx, params)
+					So(err, ShouldNotBeNil)
+				})
+			}
+		})
+		Convey("When create state with the model file", func() {
+			st, err := NewDNNNet(ctx, data.Map{
+				"model":       data.String(reluModelFile),
+				"parallelism": data.Int(2),
+			})
+			So(err, ShouldBeNil)
+			Reset(func() {
+				st.Terminate(ctx)
+			})
+			Convey("Then state should have the network instances", func() {
+				n, ok := st.(*dnnNet)
+				So(ok, ShouldBeTrue)
+				So(len(n.nets), ShouldEqual, 2)
+				So(n.detectParams, ShouldResemble, dnnDetectParams{
+					layout:              layoutSSD,
+					confidenceThreshold: 0.5,
+					nmsThreshold:        0.4,
+				})
+			})
+			Convey("And run the network after the state is terminated", func() {
+				ctx := core.NewContext(nil)
+				So(ctx.SharedStates.Add("terminated_net", "opencv_dnn_net", st),
+					ShouldBeNil)
+				So(st.Terminate(ctx), ShouldBeNil)
+				_, err := DNNForward(ctx, "terminated_net", data.Map{
+					"format": data.String("cvmat"),
+					"width":  data.Int(1),
+					"height": data.Int(1),
+					"image":  data.Blob([]byte{0, 0, 0}),
+				})
+				Convey("Then it should return an error instead of blocking", func() {
+					So(err, ShouldNotBeNil)
+				})
+			})
+		})
+	})
+}
+
+func TestParseBlobParams(t *testing.T) {
+	Convey("Given a parameter map of an input blob", t, func() {
+		params := data.Map{
+			"input_size": data.Map{"width": data.Int(300), "height": data.Int(300)},
+			"mean":       data.Array{data.Int(104), data.Int(117), data.Int(123)},
+			"scale":      data.Float(0.5),
+			"swap_rb":    data.True,
+		}
+		Convey("When parse it", func() {
+			p, err := parseBlobParams(params)
+			Convey("Then it should have the values", func() {
+				So(err, ShouldBeNil)
+				So(p, ShouldResemble, bridge.BlobParams{
+					Width:  300,
+					Height: 300,
+					Scale:  0.5,
+					Mean:   [3]float64{104, 117, 123},
+					SwapRB: true,
+				})
+			})
+		})
+		Convey("When mean is a number", func() {
+			params["mean"] = data.Float(127.5)
+			p, err := parseBlobParams(params)
+			Convey("Then it should be applied to all channels", func() {
+				So(err, ShouldBeNil)
+				So(p.Mean, ShouldResemble, [3]float64{127.5, 127.5, 127.5})
+			})
+		})
+		Convey("When the map has invalid values", func() {
+			cases := map[string]data.Value{
+				"input_size": data.Map{"width": data.Int(0), "height": data.Int(300)},
+				"mean":       data.Array{data.Int(1), data.Int(2), data.Int(3), data.Int(4)},
+				"scale":      data.Int(0),
+				"swap_rb":    data.Int(1),
+			}
+			for key, v := range cases {
+				Convey("Then it should return an error: "+key, func() {
+					params[key] = v
+					_, err := parseBlobParams(params)
+					So(err, ShouldNotBeNil)
+				})
+			}
+		})
+	})
+}
+
+func TestDNNForward(t *testing.T) {
+	Convey("Given a dnn net state of the relu model", t, func() {
+		ctx := core.NewContext(nil)
+		st, err := NewDNNNet(ctx, data.Map{
+			"model": data.String(reluModelFile),
+			"mean":  data.Array{data.Int(0), data.Int(0), data.Int(255)},
+			"scale": data.Float(0.01),
+		})
+		So(err, ShouldBeNil)
+		So(ctx.SharedStates.Add("net", "opencv_dnn_net", st), ShouldBeNil)
+		Reset(func() {
+			st.Terminate(ctx)
+		})
+		img := data.Map{
+			"format": data.String("cvmat"),
+			"width":  data.Int(2),
+			"height": data.Int(2),
+			"image":  data.Blob([]byte{100, 100, 100, 100, 100, 100, 100, 100, 100, 100, 100, 100}),
+		}
+
+		Convey("When forward the image", func() {
+			tensors, err := DNNForward(ctx, "net", img)
+			Convey("Then it should return the output of relu", func() {
+				So(err, ShouldBeNil)
+				So(len(tensors), ShouldEqual, 1)
+				tensor, err := data.AsMap(tensors[0])
+				So(err, ShouldBeNil)
+				So(tensor["shape"], ShouldResemble, data.Array{
+					data.Int(1), data.Int(3), data.Int(2), data.Int(2)})
+				values, err := data.AsArray(tensor["data"])
+				So(err, ShouldBeNil)
+				So(len(values), ShouldEqual, 12)
+				for i, v := range values {
+					f, err := data.AsFloat(v)
+					So(err, ShouldBeNil)
+					if i < 8 {
+						So(f, ShouldAlmostEqual, 1.0, 1e-6)
+					} else {
+						So(f, ShouldEqual, 0)
+					}
+				}
+			})
+		})
+		Convey("When detect by ssd layout", func() {
+			_, err := DNNDetect(ctx, "net", img)
+			Convey("Then it should return an error because of the output shape", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+		Convey("When detect with an unknown parameter", func() {
+			_, err := DNNDetect(ctx, "net", img, data.Map{"mean": data.Int(0)})
+			Convey("Then it should return an error", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
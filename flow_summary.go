@@ -0,0 +1,80 @@
+package opencv
+
+import (
+	"gopkg.in/sensorbee/opencv.v0/bridge"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"math"
+)
+
+// flowSummary is a summary of optical flow vectors.
+type flowSummary struct {
+	count         int
+	meanX         float64
+	meanY         float64
+	meanMagnitude float64
+	// histogram is the ratio of vectors in each magnitude bin.
+	histogram []float64
+}
+
+// summarizeFlow summarizes flow vectors, which are interleaved dx and dy
+// like data of a CV_32FC2 Mat. The histogram has bins of the same width from
+// 0 to maxMagnitude, vectors larger than maxMagnitude are in the last bin.
+func summarizeFlow(vectors []float32, bins int, maxMagnitude float64) flowSummary {
+	s := flowSummary{
+		count:     len(vectors) / 2,
+		histogram: make([]float64, bins),
+	}
+	if s.count == 0 {
+		return s
+	}
+	for i := 0; i < s.count; i++ {
+		dx, dy := float64(vectors[2*i]), float64(vectors[2*i+1])
+		m := math.Hypot(dx, dy)
+		s.meanX += dx
+		s.meanY += dy
+		s.meanMagnitude += m
+		b := int(m / maxMagnitude * float64(bins))
+		if b >= bins {
+			b = bins - 1
+		}
+		s.histogram[b]++
+	}
+	n := float64(s.count)
+	s.meanX /= n
+	s.meanY /= n
+	s.meanMagnitude /= n
+	for i := range s.histogram {
+		s.histogram[i] /= n
+	}
+	return s
+}
+
+// flowVectors returns interleaved vectors from prev to next points.
+func flowVectors(prev, next []bridge.Point2f) []float32 {
+	vectors := make([]float32, 2*len(prev))
+	for i := range prev {
+		vectors[2*i] = next[i].X - prev[i].X
+		vectors[2*i+1] = next[i].Y - prev[i].Y
+	}
+	return vectors
+}
+
+// toMap converts the summary to a map which has "count", "mean", "angle",
+// "magnitude" and "histogram". "angle" is the direction of the mean vector
+// in degrees, 0 is right and 90 is down.
+func (s *flowSummary) toMap() data.Map {
+	histogram := make(data.Array, len(s.histogram))
+	for i, h := range s.histogram {
+		histogram[i] = data.Float(h)
+	}
+	return data.Map{
+		"count": data.Int(s.count),
+		"mean": data.Map{
+			"x": data.Float(s.meanX),
+			"y": data.Float(s.meanY),
+		},
+		"angle":     data.Float(math.Atan2(s.meanY, s.meanX) * 180 / math.Pi),
+		"magnitude": data.Float(s.meanMagnitude),
+		"histogram": histogram,
+	}
+}
@@ -0,0 +1,45 @@
+package opencv
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/opencv.v0/bridge"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"testing"
+)
+
+func TestSummarizeFlow(t *testing.T) {
+	Convey("Given tracked point pairs", t, func() {
+		prev := []bridge.Point2f{{X: 0, Y: 0}, {X: 10, Y: 10}, {X: 5, Y: 5}}
+		next := []bridge.Point2f{{X: 3, Y: 4}, {X: 10, Y: 10}, {X: 5, Y: 35}}
+		Convey("When summarize their vectors", func() {
+			s := summarizeFlow(flowVectors(prev, next), 4, 20)
+			Convey("Then it should have the mean and the histogram", func() {
+				So(s.count, ShouldEqual, 3)
+				So(s.meanX, ShouldAlmostEqual, 1)
+				So(s.meanY, ShouldAlmostEqual, 34.0/3)
+				So(s.meanMagnitude, ShouldAlmostEqual, 35.0/3)
+				So(s.histogram, ShouldResemble, []float64{
+					1.0 / 3, 1.0 / 3, 0, 1.0 / 3})
+			})
+			Convey("Then it should be converted to a map", func() {
+				m := s.toMap()
+				So(m["count"], ShouldEqual, data.Int(3))
+				So(m["histogram"], ShouldHaveLength, 4)
+				angle, err := data.AsFloat(m["angle"])
+				So(err, ShouldBeNil)
+				So(angle, ShouldBeBetween, 84, 86)
+			})
+		})
+	})
+
+	Convey("Given no vector", t, func() {
+		Convey("When summarize them", func() {
+			s := summarizeFlow(nil, 4, 20)
+			Convey("Then it should be zero", func() {
+				So(s.count, ShouldEqual, 0)
+				So(s.histogram, ShouldResemble, []float64{0, 0, 0, 0})
+				So(s.toMap()["angle"], ShouldEqual, data.Float(0))
+			})
+		})
+	})
+}
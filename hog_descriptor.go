@@ -0,0 +1,251 @@
+//go:build cgo
+// +build cgo
+
+package opencv
+
+import (
+	"fmt"
+	"gopkg.in/sensorbee/opencv.v0/bridge"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"strings"
+)
+
+var (
+	detectorPath       = data.MustCompilePath("detector")
+	hitThresholdPath   = data.MustCompilePath("hit_threshold")
+	winStridePath      = data.MustCompilePath("win_stride")
+	paddingPath        = data.MustCompilePath("padding")
+	scalePath          = data.MustCompilePath("scale")
+	finalThresholdPath = data.MustCompilePath("final_threshold")
+	meanshiftPath      = data.MustCompilePath("use_meanshift_grouping")
+)
+
+// hogDetectParamKeys are keys of a parameter map of HOGDetect.
+var hogDetectParamKeys = map[string]bool{
+	"hit_threshold":          true,
+	"win_stride":             true,
+	"padding":                true,
+	"scale":                  true,
+	"final_threshold":        true,
+	"use_meanshift_grouping": true,
+}
+
+// NewHOGDescriptor returns hogDescriptor state.
+//
+// detector: SVM detector of the descriptor, "default" (OpenCV's default
+// people detector, 64x128 window) or "daimler" (Daimler people detector, 48x96
+// window). Default is "default".
+//
+// file: A descriptor file saved by `cv::HOGDescriptor::save`, which has a
+// custom SVM detector and the window size. When the file is set, detector
+// parameter cannot be set.
+//
+// The following parameters are defaults of HOGDetect, they can be overwritten
+// by a parameter map of each call.
+//
+// hit_threshold: Threshold of the distance between features and the SVM
+// classifying plane. Default is 0.
+//
+// win_stride: Window stride as a map which has "width" and "height", it must
+// be a multiple of the block stride. Default is {"width": 8, "height": 8}.
+//
+// padding: Padding around the image as same as win_stride. Default is
+// {"width": 0, "height": 0}.
+//
+// scale: Coefficient of the detection window increase, required to be greater
+// than 1.0. Default is 1.05.
+//
+// final_threshold: Threshold of grouping detected rectangles, 0 disables
+// grouping. Default is 2.0.
+//
+// use_meanshift_grouping: If set `true` then detected rectangles are grouped
+// by mean-shift instead of groupRectangles. Default is false.
+func NewHOGDescriptor(ctx *core.Context, params data.Map) (core.SharedState,
+	error) {
+	detectParams, err := parseHOGDetectParams(params,
+		bridge.NewHOGDetectParams())
+	if err != nil {
+		return nil, err
+	}
+
+	hog := bridge.NewHOGDescriptor()
+	if err := setupHOGDescriptor(&hog, params); err != nil {
+		hog.Delete()
+		return nil, err
+	}
+	return &hogDescriptor{
+		hog:    hog,
+		params: detectParams,
+	}, nil
+}
+
+// setupHOGDescriptor sets the SVM detector by "file" or "detector" parameter.
+func setupHOGDescriptor(hog *bridge.HOGDescriptor, params data.Map) error {
+	if fp, err := params.Get(configFilePath); err == nil {
+		if _, err := params.Get(detectorPath); err == nil {
+			return fmt.Errorf("file and detector cannot be set at once")
+		}
+		filePath, err := data.AsString(fp)
+		if err != nil {
+			return err
+		}
+		return hog.Load(filePath)
+	}
+
+	detector := "default"
+	if d, err := params.Get(detectorPath); err == nil {
+		if detector, err = data.AsString(d); err != nil {
+			return err
+		}
+	}
+	switch strings.ToLower(detector) {
+	case "default":
+		return hog.SetDefaultPeopleDetector()
+	case "daimler":
+		return hog.SetDaimlerPeopleDetector()
+	default:
+		return fmt.Errorf("'%v' detector is not supported", detector)
+	}
+}
+
+// hogDescriptor has a descriptor with an SVM detector. Detection of the
+// descriptor is thread-safe, so the descriptor is shared by all calls.
+type hogDescriptor struct {
+	hog    bridge.HOGDescriptor
+	params bridge.HOGDetectParams
+}
+
+// parseHOGDetectParams returns base overwritten by parameters in the map.
+// Keys which are not parameters are ignored.
+func parseHOGDetectParams(params data.Map, base bridge.HOGDetectParams) (
+	bridge.HOGDetectParams, error) {
+	p := base
+	if v, err := params.Get(hitThresholdPath); err == nil {
+		if p.HitThreshold, err = data.ToFloat(v); err != nil {
+			return p, err
+		}
+	}
+	if v, err := params.Get(winStridePath); err == nil {
+		w, h, err := parseSize(v)
+		if err != nil {
+			return p, fmt.Errorf("invalid win_stride: %v", err)
+		}
+		if w == 0 || h == 0 {
+			return p, fmt.Errorf("win_stride must have positive size: %v", v)
+		}
+		p.WinStrideWidth, p.WinStrideHeight = w, h
+	}
+	if v, err := params.Get(paddingPath); err == nil {
+		w, h, err := parseSize(v)
+		if err != nil {
+			return p, fmt.Errorf("invalid padding: %v", err)
+		}
+		p.PaddingWidth, p.PaddingHeight = w, h
+	}
+	if v, err := params.Get(scalePath); err == nil {
+		f, err := data.ToFloat(v)
+		if err != nil {
+			return p, err
+		}
+		if f <= 1.0 {
+			return p, fmt.Errorf("scale must be greater than 1.0: %v", f)
+		}
+		p.Scale = f
+	}
+	if v, err := params.Get(finalThresholdPath); err == nil {
+		f, err := data.ToFloat(v)
+		if err != nil {
+			return p, err
+		}
+		if f < 0 {
+			return p, fmt.Errorf("final_threshold must not be negative: %v", f)
+		}
+		p.FinalThreshold = f
+	}
+	if v, err := params.Get(meanshiftPath); err == nil {
+		if p.UseMeanshiftGrouping, err = data.AsBool(v); err != nil {
+			return p, err
+		}
+	}
+	return p, nil
+}
+
+// Terminate the descriptor.
+func (h *hogDescriptor) Terminate(ctx *core.Context) error {
+	h.hog.Delete()
+	return nil
+}
+
+func lookupHOGDescriptor(ctx *core.Context, name string) (*hogDescriptor,
+	error) {
+	st, err := ctx.SharedStates.Get(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if s, ok := st.(*hogDescriptor); ok {
+		return s, nil
+	}
+	return nil, fmt.Errorf("state '%v' cannot be converted to hog_descriptor.state",
+		name)
+}
+
+// HOGDetect detects objects by HOG descriptor, e.g. people.
+//
+// descriptorName: hogDescriptor state name.
+//
+// img: target image as RawData map structure.
+//
+// params: optional parameter map, which has same keys as detection parameters
+// of NewHOGDescriptor, e.g. {"hit_threshold": 0.5}. Values which are not in
+// the map are the state's defaults.
+//
+// Returns an array of rectangles, which have "x", "y", "width", "height" and
+// "weight". A larger weight means more confident. The array can be drawn by
+// DrawRectsToImage as same as results of DetectMultiScale.
+func HOGDetect(ctx *core.Context, descriptorName string, img data.Map,
+	params ...data.Map) (data.Array, error) {
+	if len(params) > 1 {
+		return nil, fmt.Errorf("too many parameter maps: %v", len(params))
+	}
+	hog, err := lookupHOGDescriptor(ctx, descriptorName)
+	if err != nil {
+		return nil, err
+	}
+	detectParams := hog.params
+	if len(params) == 1 {
+		for k := range params[0] {
+			if !hogDetectParamKeys[k] {
+				return nil, fmt.Errorf(
+					"'%v' is not a parameter of HOG detection", k)
+			}
+		}
+		if detectParams, err = parseHOGDetectParams(params[0],
+			hog.params); err != nil {
+			return nil, err
+		}
+	}
+
+	raw, err := ConvertMapToRawData(img)
+	if err != nil {
+		return nil, err
+	}
+	mat, err := defaultMatVec3bPool.get(&raw)
+	if err != nil {
+		return nil, err
+	}
+	defer defaultMatVec3bPool.put(mat)
+
+	rects, weights, err := hog.hog.DetectMultiScale(mat, detectParams)
+	if err != nil {
+		return nil, err
+	}
+	ret := make(data.Array, len(rects))
+	for i, r := range rects {
+		rect := convertFromBridgeRect(r)
+		rect["weight"] = data.Float(weights[i])
+		ret[i] = rect
+	}
+	return ret, nil
+}
@@ -0,0 +1,153 @@
+//go:build cgo
+// +build cgo
+
+package opencv
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/opencv.v0/bridge"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"testing"
+)
+
+func TestNewHOGDescriptor(t *testing.T) {
+	Convey("Given a SensorBee's core.Context", t, func() {
+		ctx := &core.Context{}
+		Convey("When create state with empty map", func() {
+			st, err := NewHOGDescriptor(ctx, data.Map{})
+			So(err, ShouldBeNil)
+			Reset(func() {
+				st.Terminate(ctx)
+			})
+			Convey("Then state should have default parameters", func() {
+				hog, ok := st.(*hogDescriptor)
+				So(ok, ShouldBeTrue)
+				So(hog.params, ShouldResemble, bridge.NewHOGDetectParams())
+			})
+		})
+		Convey("When create state with daimler detector", func() {
+			st, err := NewHOGDescriptor(ctx, data.Map{
+				"detector": data.String("daimler"),
+			})
+			Convey("Then state should be created", func() {
+				So(err, ShouldBeNil)
+				So(st.Terminate(ctx), ShouldBeNil)
+			})
+		})
+		Convey("When create state with invalid parameters", func() {
+			cases := map[string]data.Map{
+				"unsupported detector": {"detector": data.String("cat")},
+				"not exist file":       {"file": data.String("not_exist_file")},
+				"file and detector": {
+					"file":     data.String("not_exist_file"),
+					"detector": data.String("default"),
+				},
+				"zero scale":      {"scale": data.Float(1.0)},
+				"zero win_stride": {"win_stride": data.Map{"width": data.Int(0), "height": data.Int(8)}},
+			}
+			for name, params := range cases {
+				Convey("Then it should return an error: "+name, func() {
+					_, err := NewHOGDescriptor(ctx, params)
+					So(err, ShouldNotBeNil)
+				})
+			}
+		})
+	})
+}
+
+func TestParseHOGDetectParams(t *testing.T) {
+	Convey("Given default HOG detection parameters", t, func() {
+		base := bridge.NewHOGDetectParams()
+		Convey("When parse a map which has all parameters", func() {
+			p, err := parseHOGDetectParams(data.Map{
+				"hit_threshold": data.Float(0.5),
+				"win_stride": data.Map{
+					"width": data.Int(4), "height": data.Int(4),
+				},
+				"padding": data.Map{
+					"width": data.Int(16), "height": data.Int(16),
+				},
+				"scale":                  data.Float(1.2),
+				"final_threshold":        data.Int(0),
+				"use_meanshift_grouping": data.True,
+			}, base)
+			Convey("Then it should overwrite all parameters", func() {
+				So(err, ShouldBeNil)
+				So(p, ShouldResemble, bridge.HOGDetectParams{
+					HitThreshold:         0.5,
+					WinStrideWidth:       4,
+					WinStrideHeight:      4,
+					PaddingWidth:         16,
+					PaddingHeight:        16,
+					Scale:                1.2,
+					FinalThreshold:       0,
+					UseMeanshiftGrouping: true,
+				})
+			})
+		})
+		Convey("When parse a map which has invalid values", func() {
+			cases := map[string]data.Map{
+				"hit_threshold":          {"hit_threshold": data.String("a")},
+				"padding":                {"padding": data.Int(8)},
+				"negative padding":       {"padding": data.Map{"width": data.Int(-1), "height": data.Int(0)}},
+				"final_threshold":        {"final_threshold": data.Float(-1)},
+				"use_meanshift_grouping": {"use_meanshift_grouping": data.Int(1)},
+			}
+			for name, params := range cases {
+				Convey("Then it should return an error: "+name, func() {
+					_, err := parseHOGDetectParams(params, base)
+					So(err, ShouldNotBeNil)
+				})
+			}
+		})
+	})
+}
+
+func TestHOGDetect(t *testing.T) {
+	Convey("Given a HOG descriptor state", t, func() {
+		ctx := core.NewContext(nil)
+		st, err := NewHOGDescriptor(ctx, data.Map{})
+		So(err, ShouldBeNil)
+		So(ctx.SharedStates.Add("hog", "opencv_hog_descriptor", st), ShouldBeNil)
+		Reset(func() {
+			st.Terminate(ctx)
+		})
+		img := data.Map{
+			"format": data.String("cvmat"),
+			"width":  data.Int(1),
+			"height": data.Int(1),
+			"image":  data.Blob([]byte{0, 0, 0}),
+		}
+
+		Convey("When detect in an image smaller than the window", func() {
+			rects, err := HOGDetect(ctx, "hog", img, data.Map{
+				"hit_threshold": data.Float(0.5),
+			})
+			Convey("Then it should return no rectangle", func() {
+				So(err, ShouldBeNil)
+				So(rects, ShouldBeEmpty)
+			})
+		})
+		Convey("When detect with an unknown parameter", func() {
+			_, err := HOGDetect(ctx, "hog", img, data.Map{
+				"scale_factor": data.Float(1.1),
+			})
+			Convey("Then it should return an error", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+		Convey("When detect with two parameter maps", func() {
+			_, err := HOGDetect(ctx, "hog", img, data.Map{}, data.Map{})
+			Convey("Then it should return an error", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+		Convey("When detect with a cascade classifier name", func() {
+			_, err := HOGDetect(ctx, "cc", img)
+			Convey("Then it should return an error", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
@@ -0,0 +1,94 @@
+package opencv
+
+import (
+	"math"
+)
+
+// hungarian solves the assignment problem of the cost matrix by the
+// Hungarian method in O(n^2 m). All rows are required to have the same
+// length. It returns the column assigned to each row with the minimum total
+// cost, a row is assigned -1 when there are fewer columns than rows.
+func hungarian(cost [][]float64) []int {
+	n := len(cost)
+	if n == 0 {
+		return []int{}
+	}
+	m := len(cost[0])
+	if n > m {
+		// each column is assigned to a row in the transposed matrix
+		t := make([][]float64, m)
+		for j := range t {
+			t[j] = make([]float64, n)
+			for i := range cost {
+				t[j][i] = cost[i][j]
+			}
+		}
+		ret := make([]int, n)
+		for i := range ret {
+			ret[i] = -1
+		}
+		for j, i := range hungarian(t) {
+			ret[i] = j
+		}
+		return ret
+	}
+
+	// u and v are potentials of rows and columns, p is the row assigned to
+	// each column, and way is the previous column of each column in the
+	// augmenting path. Indices are 1-origin, and column 0 is a dummy.
+	u := make([]float64, n+1)
+	v := make([]float64, m+1)
+	p := make([]int, m+1)
+	way := make([]int, m+1)
+	for i := 1; i <= n; i++ {
+		p[0] = i
+		j0 := 0
+		minv := make([]float64, m+1)
+		for j := range minv {
+			minv[j] = math.Inf(1)
+		}
+		used := make([]bool, m+1)
+		for p[j0] != 0 {
+			used[j0] = true
+			i0, delta, j1 := p[j0], math.Inf(1), 0
+			for j := 1; j <= m; j++ {
+				if used[j] {
+					continue
+				}
+				if c := cost[i0-1][j-1] - u[i0] - v[j]; c < minv[j] {
+					minv[j] = c
+					way[j] = j0
+				}
+				if minv[j] < delta {
+					delta = minv[j]
+					j1 = j
+				}
+			}
+			for j := 0; j <= m; j++ {
+				if used[j] {
+					u[p[j]] += delta
+					v[j] -= delta
+				} else {
+					minv[j] -= delta
+				}
+			}
+			j0 = j1
+		}
+		for j0 != 0 {
+			j1 := way[j0]
+			p[j0] = p[j1]
+			j0 = j1
+		}
+	}
+
+	ret := make([]int, n)
+	for i := range ret {
+		ret[i] = -1
+	}
+	for j := 1; j <= m; j++ {
+		if p[j] != 0 {
+			ret[p[j]-1] = j - 1
+		}
+	}
+	return ret
+}
@@ -0,0 +1,58 @@
+package opencv
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestHungarian(t *testing.T) {
+	Convey("Given a square cost matrix", t, func() {
+		cost := [][]float64{
+			{4, 1, 3},
+			{2, 0, 5},
+			{3, 2, 2},
+		}
+		Convey("When solve the assignment", func() {
+			a := hungarian(cost)
+			Convey("Then it should have the minimum total cost", func() {
+				So(a, ShouldResemble, []int{1, 0, 2})
+			})
+		})
+	})
+
+	Convey("Given a cost matrix which has more columns than rows", t, func() {
+		cost := [][]float64{
+			{9, 1, 9, 9},
+			{1, 2, 9, 9},
+		}
+		Convey("When solve the assignment", func() {
+			a := hungarian(cost)
+			Convey("Then it should assign each row", func() {
+				So(a, ShouldResemble, []int{1, 0})
+			})
+		})
+	})
+
+	Convey("Given a cost matrix which has more rows than columns", t, func() {
+		cost := [][]float64{
+			{5, 9},
+			{1, 9},
+			{9, 1},
+		}
+		Convey("When solve the assignment", func() {
+			a := hungarian(cost)
+			Convey("Then it should leave a row unassigned", func() {
+				So(a, ShouldResemble, []int{-1, 0, 1})
+			})
+		})
+	})
+
+	Convey("Given an empty cost matrix", t, func() {
+		Convey("When solve the assignment", func() {
+			Convey("Then it should return an empty assignment", func() {
+				So(hungarian(nil), ShouldBeEmpty)
+				So(hungarian([][]float64{{}, {}}), ShouldResemble, []int{-1, -1})
+			})
+		})
+	})
+}
@@ -0,0 +1,41 @@
+package opencv
+
+// idleKeys remembers the last frame of each key of a per-key state to find
+// keys which are not given any more, e.g. of a removed camera. Frames are
+// counted by calls of all keys, so maxAge is required to be larger than the
+// number of keys given in turn. It is not thread-safe and is used under the
+// lock of the state.
+type idleKeys struct {
+	maxAge     int
+	frame      int64
+	lastFrames map[string]int64
+}
+
+func newIdleKeys(maxAge int) *idleKeys {
+	return &idleKeys{
+		maxAge:     maxAge,
+		lastFrames: map[string]int64{},
+	}
+}
+
+// touch counts a frame of the key, and returns keys which are not given for
+// more than maxAge frames. The returned keys are forgotten, and the caller is
+// required to release their resources.
+func (k *idleKeys) touch(key string) []string {
+	k.frame++
+	k.lastFrames[key] = k.frame
+	var idle []string
+	for key, last := range k.lastFrames {
+		if k.frame-last > int64(k.maxAge) {
+			idle = append(idle, key)
+			delete(k.lastFrames, key)
+		}
+	}
+	return idle
+}
+
+// forget forgets the key, e.g. when its resources are released by the
+// caller.
+func (k *idleKeys) forget(key string) {
+	delete(k.lastFrames, key)
+}
@@ -0,0 +1,37 @@
+package opencv
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestIdleKeys(t *testing.T) {
+	Convey("Given idle keys whose max age is 2", t, func() {
+		k := newIdleKeys(2)
+		So(k.touch("a"), ShouldBeEmpty)
+		So(k.touch("b"), ShouldBeEmpty)
+
+		Convey("When keys are given within the max age", func() {
+			So(k.touch("a"), ShouldBeEmpty)
+			So(k.touch("b"), ShouldBeEmpty)
+			Convey("Then they should not be idle", func() {
+				So(k.touch("a"), ShouldBeEmpty)
+			})
+		})
+		Convey("When a key is not given for more than the max age", func() {
+			So(k.touch("b"), ShouldBeEmpty)
+			idle := k.touch("b")
+			Convey("Then it should be returned once", func() {
+				So(idle, ShouldResemble, []string{"a"})
+				So(k.touch("b"), ShouldBeEmpty)
+			})
+		})
+		Convey("When a key is forgotten", func() {
+			k.forget("a")
+			So(k.touch("b"), ShouldBeEmpty)
+			Convey("Then it should not be returned", func() {
+				So(k.touch("b"), ShouldBeEmpty)
+			})
+		})
+	})
+}
@@ -0,0 +1,89 @@
+package opencv
+
+import (
+	"errors"
+	"sync"
+)
+
+// errStateTerminated is returned by calls to a terminated state.
+var errStateTerminated = errors.New("state is terminated")
+
+// instancePool checks out instances of a state, e.g. classifiers which are
+// not thread-safe, to concurrent calls. Instances are identified by indices
+// of a slice the state has, so the pool can be shared by states of any
+// instance type.
+//
+// A call waits for an instance to be returned when all instances are checked
+// out. Once the pool is terminated, waiting and following calls fail with
+// errStateTerminated instead of blocking, and instances still checked out are
+// deleted when they are returned.
+type instancePool struct {
+	m          sync.Mutex
+	free       chan int
+	done       chan struct{}
+	terminated bool
+	deleteFunc func(i int)
+}
+
+// newInstancePool returns a pool of size instances, all of them are free.
+// deleteFunc deletes the instance of the index.
+func newInstancePool(size int, deleteFunc func(i int)) *instancePool {
+	p := &instancePool{
+		free:       make(chan int, size),
+		done:       make(chan struct{}),
+		deleteFunc: deleteFunc,
+	}
+	for i := 0; i < size; i++ {
+		p.free <- i
+	}
+	return p
+}
+
+// get checks out an instance and returns its index. The instance is required
+// to be returned by put after using.
+func (p *instancePool) get() (int, error) {
+	select {
+	case i := <-p.free:
+		p.m.Lock()
+		defer p.m.Unlock()
+		if p.terminated {
+			p.deleteFunc(i)
+			return 0, errStateTerminated
+		}
+		return i, nil
+	case <-p.done:
+		return 0, errStateTerminated
+	}
+}
+
+// put returns the instance to the pool, it is deleted when the pool is
+// terminated.
+func (p *instancePool) put(i int) {
+	p.m.Lock()
+	defer p.m.Unlock()
+	if p.terminated {
+		p.deleteFunc(i)
+		return
+	}
+	p.free <- i
+}
+
+// terminate deletes free instances and makes calls fail. It does not wait
+// for instances checked out.
+func (p *instancePool) terminate() {
+	p.m.Lock()
+	defer p.m.Unlock()
+	if p.terminated {
+		return
+	}
+	p.terminated = true
+	close(p.done)
+	for {
+		select {
+		case i := <-p.free:
+			p.deleteFunc(i)
+		default:
+			return
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package opencv
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestInstancePool(t *testing.T) {
+	Convey("Given a pool of 2 instances", t, func() {
+		var m sync.Mutex
+		deleted := []int{}
+		p := newInstancePool(2, func(i int) {
+			m.Lock()
+			defer m.Unlock()
+			deleted = append(deleted, i)
+		})
+
+		Convey("When check out all instances", func() {
+			i0, err := p.get()
+			So(err, ShouldBeNil)
+			i1, err := p.get()
+			So(err, ShouldBeNil)
+			Convey("Then they should be different", func() {
+				So(i0, ShouldNotEqual, i1)
+			})
+
+			Convey("And when a call waits for an instance", func() {
+				ch := make(chan int)
+				go func() {
+					i, _ := p.get()
+					ch <- i
+				}()
+				p.put(i1)
+				Convey("Then it should get the returned instance", func() {
+					So(<-ch, ShouldEqual, i1)
+				})
+			})
+
+			Convey("And when terminate the pool during a waiting call", func() {
+				ch := make(chan error)
+				go func() {
+					_, err := p.get()
+					ch <- err
+				}()
+				time.Sleep(10 * time.Millisecond)
+				p.terminate()
+				Convey("Then the call should fail instead of blocking", func() {
+					So(<-ch, ShouldEqual, errStateTerminated)
+				})
+				Convey("Then instances should be deleted when returned", func() {
+					So(deleted, ShouldBeEmpty)
+					p.put(i0)
+					p.put(i1)
+					So(deleted, ShouldResemble, []int{i0, i1})
+				})
+			})
+		})
+
+		Convey("When terminate the pool", func() {
+			p.terminate()
+			p.terminate()
+			Convey("Then free instances should be deleted once", func() {
+				So(deleted, ShouldHaveLength, 2)
+			})
+			Convey("Then following calls should fail", func() {
+				_, err := p.get()
+				So(err, ShouldEqual, errStateTerminated)
+			})
+		})
+	})
+}
@@ -0,0 +1,347 @@
+package opencv
+
+import (
+	"fmt"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	linesPath   = data.MustCompilePath("lines")
+	anchorPath  = data.MustCompilePath("anchor")
+	namePath    = data.MustCompilePath("name")
+	fromPath    = data.MustCompilePath("from")
+	toPath      = data.MustCompilePath("to")
+	trackIDPath = data.MustCompilePath("track_id")
+)
+
+// NewLineCounter returns lineCounter state, which counts tracked objects
+// crossing virtual line segments, e.g. for footfall counting.
+//
+// lines: An array of line segments, each of them is a map which has "name",
+// "from" and "to". "from" and "to" are maps which have "x" and "y". Crossing
+// from the left side to the right side of the direction from "from" to "to"
+// is "in", and the opposite is "out". For example, "in" of a line from left
+// to right is moving down in images. Names are required to be unique.
+//
+// anchor: The point of a rectangle which is regarded as the position of the
+// object, "center" or "bottom" (the center of the bottom edge, i.e. the feet
+// of a person). Default is "center".
+//
+// max_age: The number of frames after which the position of a track which is
+// not given is forgotten. Default is 30.
+func NewLineCounter(ctx *core.Context, params data.Map) (core.SharedState,
+	error) {
+	v, err := params.Get(linesPath)
+	if err != nil {
+		return nil, fmt.Errorf("lines parameter is missing")
+	}
+	a, err := data.AsArray(v)
+	if err != nil {
+		return nil, err
+	}
+	if len(a) == 0 {
+		return nil, fmt.Errorf("lines requires 1 line at least")
+	}
+	c := &lineCounter{
+		lines:  make([]countingLine, len(a)),
+		anchor: "center",
+		maxAge: 30,
+		tracks: map[int64]*crossingTrack{},
+	}
+	names := map[string]bool{}
+	for i, l := range a {
+		line, err := convertToCountingLine(l)
+		if err != nil {
+			return nil, err
+		}
+		if names[line.name] {
+			return nil, fmt.Errorf("line name '%v' is duplicated", line.name)
+		}
+		names[line.name] = true
+		c.lines[i] = line
+	}
+
+	if v, err := params.Get(anchorPath); err == nil {
+		if c.anchor, err = data.AsString(v); err != nil {
+			return nil, err
+		}
+		c.anchor = strings.ToLower(c.anchor)
+		if c.anchor != "center" && c.anchor != "bottom" {
+			return nil, fmt.Errorf("'%v' anchor is not supported", c.anchor)
+		}
+	}
+	if v, err := params.Get(maxAgePath); err == nil {
+		n, err := data.AsInt(v)
+		if err != nil {
+			return nil, err
+		}
+		if n < 1 {
+			return nil, fmt.Errorf("max_age must be positive: %v", n)
+		}
+		c.maxAge = int(n)
+	}
+	return c, nil
+}
+
+// countingLine is a line segment and its counts.
+type countingLine struct {
+	name    string
+	x1, y1  float64
+	x2, y2  float64
+	in, out int64
+}
+
+func convertToCountingLine(v data.Value) (countingLine, error) {
+	m, err := data.AsMap(v)
+	if err != nil {
+		return countingLine{}, err
+	}
+	l := countingLine{}
+	if nv, err := m.Get(namePath); err != nil {
+		return countingLine{}, fmt.Errorf("line requires name: %v", m)
+	} else if l.name, err = data.AsString(nv); err != nil {
+		return countingLine{}, err
+	}
+	if l.x1, l.y1, err = convertToPoint(m, fromPath); err != nil {
+		return countingLine{}, fmt.Errorf("line '%v' requires from: %v",
+			l.name, err)
+	}
+	if l.x2, l.y2, err = convertToPoint(m, toPath); err != nil {
+		return countingLine{}, fmt.Errorf("line '%v' requires to: %v", l.name,
+			err)
+	}
+	if l.x1 == l.x2 && l.y1 == l.y2 {
+		return countingLine{}, fmt.Errorf("line '%v' has the same from and to",
+			l.name)
+	}
+	return l, nil
+}
+
+// convertToPoint returns "x" and "y" of the map at the path.
+func convertToPoint(m data.Map, path data.Path) (float64, float64, error) {
+	v, err := m.Get(path)
+	if err != nil {
+		return 0, 0, err
+	}
+	p, err := data.AsMap(v)
+	if err != nil {
+		return 0, 0, err
+	}
+	var x float64
+	if xv, err := p.Get(xPath); err != nil {
+		return 0, 0, err
+	} else if x, err = data.ToFloat(xv); err != nil {
+		return 0, 0, err
+	}
+	var y float64
+	if yv, err := p.Get(yPath); err != nil {
+		return 0, 0, err
+	} else if y, err = data.ToFloat(yv); err != nil {
+		return 0, 0, err
+	}
+	return x, y, nil
+}
+
+// side returns which side of the line the point is, positive is the right
+// side of the direction from (x1, y1) to (x2, y2) in image coordinates,
+// negative is the left side and 0 is on the line.
+func (l *countingLine) side(x, y float64) float64 {
+	return cross(l.x2-l.x1, l.y2-l.y1, x-l.x1, y-l.y1)
+}
+
+// crosses returns true when the segment from (x1, y1) to (x2, y2) crosses
+// the line segment, the endpoints are required to be on different sides of
+// the line.
+func (l *countingLine) crosses(x1, y1, x2, y2 float64) bool {
+	s1 := cross(x2-x1, y2-y1, l.x1-x1, l.y1-y1)
+	s2 := cross(x2-x1, y2-y1, l.x2-x1, l.y2-y1)
+	return (s1 <= 0 && s2 >= 0) || (s1 >= 0 && s2 <= 0)
+}
+
+func cross(ax, ay, bx, by float64) float64 {
+	return ax*by - ay*bx
+}
+
+// lineCounter has positions of tracks and counts of lines. Frames are
+// required to be counted in order, so calls are serialized by the mutex.
+type lineCounter struct {
+	anchor string
+	maxAge int
+
+	m      sync.Mutex
+	lines  []countingLine
+	tracks map[int64]*crossingTrack
+	frame  int64
+}
+
+// crossingTrack is the last position of a track on a side of each line.
+type crossingTrack struct {
+	// points are interleaved x and y of each line, and sides are the sides of
+	// them. A side is 0 until the track is off the line.
+	points    []float64
+	sides     []float64
+	lastFrame int64
+}
+
+// Terminate discards all tracks.
+func (c *lineCounter) Terminate(ctx *core.Context) error {
+	c.m.Lock()
+	defer c.m.Unlock()
+	c.tracks = map[int64]*crossingTrack{}
+	return nil
+}
+
+func lookupLineCounter(ctx *core.Context, name string) (*lineCounter, error) {
+	st, err := ctx.SharedStates.Get(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if s, ok := st.(*lineCounter); ok {
+		return s, nil
+	}
+	return nil, fmt.Errorf("state '%v' cannot be converted to line_counter.state",
+		name)
+}
+
+// CountCrossings updates positions of tracked objects and counts objects
+// crossing lines.
+//
+// counterName: lineCounter state name.
+//
+// rects: an array of rectangle maps which have "track_id", e.g. "rects" of
+// TrackObjects. Rectangles whose "track_id" is null are ignored.
+//
+// t: the time of the frame, e.g. `ts()`, which is set to events.
+//
+// Returns a map which has "events" and "counts". "events" is an array of
+// maps which have "line", "direction" ("in" or "out"), "track_id" and
+// "time". "counts" is a map from line names to maps which have cumulative
+// "in" and "out" counts.
+func CountCrossings(ctx *core.Context, counterName string, rects data.Array,
+	t time.Time) (data.Map, error) {
+	c, err := lookupLineCounter(ctx, counterName)
+	if err != nil {
+		return nil, err
+	}
+	type position struct {
+		id   int64
+		x, y float64
+	}
+	positions := make([]position, 0, len(rects))
+	for _, r := range rects {
+		m, err := data.AsMap(r)
+		if err != nil {
+			return nil, err
+		}
+		v, err := m.Get(trackIDPath)
+		if err != nil {
+			return nil, fmt.Errorf("rect requires track_id: %v", m)
+		}
+		if v.Type() == data.TypeNull {
+			continue
+		}
+		id, err := data.AsInt(v)
+		if err != nil {
+			return nil, err
+		}
+		rect, err := convertToBridgeRect(m)
+		if err != nil {
+			return nil, err
+		}
+		x, y := rectCenter(rect)
+		if c.anchor == "bottom" {
+			y = float64(rect.Y + rect.Height)
+		}
+		positions = append(positions, position{id, x, y})
+	}
+
+	c.m.Lock()
+	defer c.m.Unlock()
+	c.frame++
+	events := data.Array{}
+	for _, p := range positions {
+		tr, ok := c.tracks[p.id]
+		if !ok {
+			tr = &crossingTrack{
+				points: make([]float64, 2*len(c.lines)),
+				sides:  make([]float64, len(c.lines)),
+			}
+			c.tracks[p.id] = tr
+		}
+		tr.lastFrame = c.frame
+		for i := range c.lines {
+			l := &c.lines[i]
+			s := l.side(p.x, p.y)
+			if s == 0 {
+				continue
+			}
+			px, py := tr.points[2*i], tr.points[2*i+1]
+			if tr.sides[i] != 0 && (s > 0) != (tr.sides[i] > 0) &&
+				l.crosses(px, py, p.x, p.y) {
+				direction := "in"
+				if s > 0 {
+					l.in++
+				} else {
+					direction = "out"
+					l.out++
+				}
+				events = append(events, data.Map{
+					"line":      data.String(l.name),
+					"direction": data.String(direction),
+					"track_id":  data.Int(p.id),
+					"time":      data.Timestamp(t),
+				})
+			}
+			tr.points[2*i], tr.points[2*i+1] = p.x, p.y
+			tr.sides[i] = s
+		}
+	}
+	for id, tr := range c.tracks {
+		if c.frame-tr.lastFrame > int64(c.maxAge) {
+			delete(c.tracks, id)
+		}
+	}
+	return data.Map{
+		"events": events,
+		"counts": c.counts(),
+	}, nil
+}
+
+// ResetLineCounter resets counts of all lines to 0. Positions of tracks are
+// kept.
+//
+// counterName: lineCounter state name.
+//
+// Returns counts before reset as same as "counts" of CountCrossings.
+func ResetLineCounter(ctx *core.Context, counterName string) (data.Map,
+	error) {
+	c, err := lookupLineCounter(ctx, counterName)
+	if err != nil {
+		return nil, err
+	}
+	c.m.Lock()
+	defer c.m.Unlock()
+	counts := c.counts()
+	for i := range c.lines {
+		c.lines[i].in = 0
+		c.lines[i].out = 0
+	}
+	return counts, nil
+}
+
+// counts returns counts of lines. The caller must hold the lock.
+func (c *lineCounter) counts() data.Map {
+	counts := data.Map{}
+	for _, l := range c.lines {
+		counts[l.name] = data.Map{
+			"in":  data.Int(l.in),
+			"out": data.Int(l.out),
+		}
+	}
+	return counts
+}
@@ -0,0 +1,150 @@
+package opencv
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"testing"
+	"time"
+)
+
+func trackedRect(id int64, x, y int) data.Map {
+	r := rectMap(x, y, 10, 10)
+	r["track_id"] = data.Int(id)
+	return r
+}
+
+func TestNewLineCounter(t *testing.T) {
+	Convey("Given a SensorBee's core.Context", t, func() {
+		ctx := &core.Context{}
+		line := func(name string, x2 int) data.Map {
+			return data.Map{
+				"name": data.String(name),
+				"from": data.Map{"x": data.Int(0), "y": data.Int(0)},
+				"to":   data.Map{"x": data.Int(x2), "y": data.Int(0)},
+			}
+		}
+		Convey("When create state with invalid parameters", func() {
+			cases := map[string]data.Map{
+				"no lines":        {},
+				"empty lines":     {"lines": data.Array{}},
+				"duplicated name": {"lines": data.Array{line("a", 1), line("a", 2)}},
+				"zero length":     {"lines": data.Array{line("a", 0)}},
+				"missing to": {"lines": data.Array{data.Map{
+					"name": data.String("a"),
+					"from": data.Map{"x": data.Int(0), "y": data.Int(0)},
+				}}},
+				"unsupported anchor": {"lines": data.Array{line("a", 1)},
+					"anchor": data.String("top")},
+				"zero max_age": {"lines": data.Array{line("a", 1)},
+					"max_age": data.Int(0)},
+			}
+			for name, params := range cases {
+				Convey("Then it should return an error: "+name, func() {
+					_, err := NewLineCounter(ctx, params)
+					So(err, ShouldNotBeNil)
+				})
+			}
+		})
+	})
+}
+
+func TestCountCrossings(t *testing.T) {
+	Convey("Given a line counter state which has a horizontal line", t, func() {
+		ctx := core.NewContext(nil)
+		st, err := NewLineCounter(ctx, data.Map{
+			"lines": data.Array{data.Map{
+				"name": data.String("door"),
+				"from": data.Map{"x": data.Int(0), "y": data.Int(50)},
+				"to":   data.Map{"x": data.Int(100), "y": data.Int(50)},
+			}},
+		})
+		So(err, ShouldBeNil)
+		So(ctx.SharedStates.Add("counter", "opencv_line_counter", st),
+			ShouldBeNil)
+		now := time.Date(2016, 1, 2, 3, 4, 5, 0, time.UTC)
+
+		Convey("When an object moves down across the line", func() {
+			_, err := CountCrossings(ctx, "counter",
+				data.Array{trackedRect(1, 40, 20)}, now)
+			So(err, ShouldBeNil)
+			_, err = CountCrossings(ctx, "counter",
+				data.Array{trackedRect(1, 40, 42)}, now)
+			So(err, ShouldBeNil)
+			ret, err := CountCrossings(ctx, "counter",
+				data.Array{trackedRect(1, 40, 60)}, now)
+			Convey("Then it should be counted as in", func() {
+				So(err, ShouldBeNil)
+				So(ret["events"], ShouldResemble, data.Array{data.Map{
+					"line":      data.String("door"),
+					"direction": data.String("in"),
+					"track_id":  data.Int(1),
+					"time":      data.Timestamp(now),
+				}})
+				So(ret["counts"], ShouldResemble, data.Map{
+					"door": data.Map{"in": data.Int(1), "out": data.Int(0)},
+				})
+			})
+
+			Convey("And when it moves back up", func() {
+				ret, err := CountCrossings(ctx, "counter",
+					data.Array{trackedRect(1, 40, 30)}, now)
+				Convey("Then it should be counted as out", func() {
+					So(err, ShouldBeNil)
+					So(ret["events"], ShouldHaveLength, 1)
+					So(ret["counts"], ShouldResemble, data.Map{
+						"door": data.Map{"in": data.Int(1), "out": data.Int(1)},
+					})
+				})
+			})
+
+			Convey("And when reset the counter", func() {
+				counts, err := ResetLineCounter(ctx, "counter")
+				So(err, ShouldBeNil)
+				ret, err := CountCrossings(ctx, "counter", data.Array{}, now)
+				So(err, ShouldBeNil)
+				Convey("Then it should return counts before reset", func() {
+					So(counts, ShouldResemble, data.Map{
+						"door": data.Map{"in": data.Int(1), "out": data.Int(0)},
+					})
+					So(ret["counts"], ShouldResemble, data.Map{
+						"door": data.Map{"in": data.Int(0), "out": data.Int(0)},
+					})
+				})
+			})
+		})
+
+		Convey("When an object moves beyond the end of the line", func() {
+			_, err := CountCrossings(ctx, "counter",
+				data.Array{trackedRect(2, 150, 20)}, now)
+			So(err, ShouldBeNil)
+			ret, err := CountCrossings(ctx, "counter",
+				data.Array{trackedRect(2, 150, 60)}, now)
+			Convey("Then it should not be counted", func() {
+				So(err, ShouldBeNil)
+				So(ret["events"], ShouldBeEmpty)
+			})
+		})
+
+		Convey("When rects have no confirmed track ID", func() {
+			r := rectMap(40, 20, 10, 10)
+			r["track_id"] = data.Null{}
+			_, err := CountCrossings(ctx, "counter", data.Array{r}, now)
+			So(err, ShouldBeNil)
+			r["y"] = data.Int(60)
+			ret, err := CountCrossings(ctx, "counter", data.Array{r}, now)
+			Convey("Then they should be ignored", func() {
+				So(err, ShouldBeNil)
+				So(ret["events"], ShouldBeEmpty)
+			})
+		})
+
+		Convey("When rects have no track ID field", func() {
+			_, err := CountCrossings(ctx, "counter",
+				data.Array{rectMap(40, 20, 10, 10)}, now)
+			Convey("Then it should return an error", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
@@ -0,0 +1,245 @@
+//go:build cgo
+// +build cgo
+
+package opencv
+
+import (
+	"fmt"
+	"gopkg.in/sensorbee/opencv.v0/bridge"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"sync"
+)
+
+var (
+	blurPath            = data.MustCompilePath("blur")
+	diffThresholdPath   = data.MustCompilePath("diff_threshold")
+	dilatePath          = data.MustCompilePath("dilate")
+	motionThresholdPath = data.MustCompilePath("motion_threshold")
+)
+
+// NewMotionDetector returns motionDetector state, which detects motion by
+// difference between a frame and the previous frame of the same key.
+//
+// blur: The size of a Gaussian filter applied to grayscale frames before
+// difference to ignore noise, required to be odd. 0 disables the filter.
+// Default is 5.
+//
+// diff_threshold: Pixels whose difference of intensity is larger than it
+// are changed. Default is 25.
+//
+// dilate: The number of dilation of changed pixels to merge near regions.
+// Default is 2.
+//
+// min_area: Changed regions whose area is less than it are not returned as
+// rectangles. Default is 0.
+//
+// motion_threshold: A frame is moving when the ratio of changed pixels is
+// larger than it. Default is 0.01.
+//
+// max_age: The number of frames of all keys after which the previous frame
+// of a key which is not given is deleted, required to be larger than the
+// number of keys. Default is 300.
+func NewMotionDetector(ctx *core.Context, params data.Map) (core.SharedState,
+	error) {
+	d := &motionDetector{
+		blur:            5,
+		diffThreshold:   25,
+		dilate:          2,
+		motionThreshold: 0.01,
+		prevs:           map[string]bridge.Mat{},
+	}
+	maxAge := int64(300)
+	if v, err := params.Get(blurPath); err == nil {
+		b, err := data.AsInt(v)
+		if err != nil {
+			return nil, err
+		}
+		if b < 0 || b > 0 && b%2 == 0 {
+			return nil, fmt.Errorf("blur must be 0 or a positive odd number: %v",
+				b)
+		}
+		d.blur = int(b)
+	}
+	if v, err := params.Get(diffThresholdPath); err == nil {
+		t, err := data.ToFloat(v)
+		if err != nil {
+			return nil, err
+		}
+		if t < 0 || t > 255 {
+			return nil, fmt.Errorf("diff_threshold must be from 0 to 255: %v", t)
+		}
+		d.diffThreshold = t
+	}
+	if v, err := params.Get(dilatePath); err == nil {
+		n, err := data.AsInt(v)
+		if err != nil {
+			return nil, err
+		}
+		if n < 0 {
+			return nil, fmt.Errorf("dilate must not be negative: %v", n)
+		}
+		d.dilate = int(n)
+	}
+	minArea, err := parseMinArea(params)
+	if err != nil {
+		return nil, err
+	}
+	d.minArea = minArea
+	if v, err := params.Get(motionThresholdPath); err == nil {
+		t, err := data.ToFloat(v)
+		if err != nil {
+			return nil, err
+		}
+		if t < 0 || t > 1 {
+			return nil, fmt.Errorf("motion_threshold must be from 0 to 1: %v", t)
+		}
+		d.motionThreshold = t
+	}
+	if v, err := params.Get(maxAgePath); err == nil {
+		if maxAge, err = data.AsInt(v); err != nil {
+			return nil, err
+		}
+		if maxAge < 1 {
+			return nil, fmt.Errorf("max_age must be positive: %v", maxAge)
+		}
+	}
+	d.keys = newIdleKeys(int(maxAge))
+	return d, nil
+}
+
+// motionDetector has the previous grayscale frame of each key.
+type motionDetector struct {
+	blur            int
+	diffThreshold   float64
+	dilate          int
+	minArea         float64
+	motionThreshold float64
+
+	m     sync.Mutex
+	prevs map[string]bridge.Mat
+	keys  *idleKeys
+}
+
+// Terminate deletes all previous frames.
+func (d *motionDetector) Terminate(ctx *core.Context) error {
+	d.m.Lock()
+	defer d.m.Unlock()
+	for k, prev := range d.prevs {
+		prev.Delete()
+		delete(d.prevs, k)
+		d.keys.forget(k)
+	}
+	return nil
+}
+
+func lookupMotionDetector(ctx *core.Context, name string) (*motionDetector,
+	error) {
+	st, err := ctx.SharedStates.Get(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if s, ok := st.(*motionDetector); ok {
+		return s, nil
+	}
+	return nil, fmt.Errorf("state '%v' cannot be converted to motion_detector.state",
+		name)
+}
+
+// DetectMotion compares the frame with the previous frame of the key, and
+// remembers the frame as the next previous frame.
+//
+// detectorName: motionDetector state name.
+//
+// img: a frame as RawData map structure.
+//
+// key: optional key of the stream, e.g. a camera ID. Frames of different keys
+// are not compared. Default is an empty string.
+//
+// Returns a map which has "score", "rects" and "moving". "score" is the ratio
+// of changed pixels from 0 to 1, "rects" is an array of bounding rectangles of
+// changed regions, and "moving" is true when the score is larger than
+// motion_threshold. The first frame of a key, or a frame whose size differs
+// from the previous frame, has no motion.
+func DetectMotion(ctx *core.Context, detectorName string, img data.Map,
+	key ...string) (data.Map, error) {
+	if len(key) > 1 {
+		return nil, fmt.Errorf("too many keys: %v", len(key))
+	}
+	d, err := lookupMotionDetector(ctx, detectorName)
+	if err != nil {
+		return nil, err
+	}
+	k := ""
+	if len(key) == 1 {
+		k = key[0]
+	}
+
+	raw, err := ConvertMapToRawData(img)
+	if err != nil {
+		return nil, err
+	}
+	mat, err := defaultMatVec3bPool.get(&raw)
+	if err != nil {
+		return nil, err
+	}
+	defer defaultMatVec3bPool.put(mat)
+	gray, err := bridge.ToBlurredGray(mat, d.blur)
+	if err != nil {
+		return nil, err
+	}
+
+	mask, err := d.diff(k, gray)
+	if err != nil {
+		return nil, err
+	}
+	if mask == nil {
+		return data.Map{
+			"score":  data.Float(0),
+			"rects":  data.Array{},
+			"moving": data.False,
+		}, nil
+	}
+	defer mask.Delete()
+
+	rects, maskRaw, err := foregroundRegions(*mask, d.minArea)
+	if err != nil {
+		return nil, err
+	}
+	score := maskRaw.foregroundRatio()
+	return data.Map{
+		"score":  data.Float(score),
+		"rects":  rects,
+		"moving": data.Bool(score > d.motionThreshold),
+	}, nil
+}
+
+// diff remembers the frame of the key, and returns a mask of changed pixels
+// from the previous frame. The mask is nil for the first frame of the key or
+// a frame whose size differs from the previous frame. The mask is required
+// to be deleted by the caller. Previous frames of idle keys are deleted.
+func (d *motionDetector) diff(key string, gray bridge.Mat) (*bridge.Mat,
+	error) {
+	d.m.Lock()
+	defer d.m.Unlock()
+	for _, k := range d.keys.touch(key) {
+		prev := d.prevs[k]
+		prev.Delete()
+		delete(d.prevs, k)
+	}
+	prev, ok := d.prevs[key]
+	d.prevs[key] = gray
+	if !ok {
+		return nil, nil
+	}
+	defer prev.Delete()
+	if prev.Rows() != gray.Rows() || prev.Cols() != gray.Cols() {
+		return nil, nil
+	}
+	mask, err := bridge.DiffMask(prev, gray, d.diffThreshold, d.dilate)
+	if err != nil {
+		return nil, err
+	}
+	return &mask, nil
+}
@@ -0,0 +1,135 @@
+//go:build cgo
+// +build cgo
+
+package opencv
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"testing"
+)
+
+func TestNewMotionDetector(t *testing.T) {
+	Convey("Given a SensorBee's core.Context", t, func() {
+		ctx := &core.Context{}
+		Convey("When create state with invalid parameters", func() {
+			cases := map[string]data.Map{
+				"even blur":              {"blur": data.Int(4)},
+				"negative blur":          {"blur": data.Int(-1)},
+				"large diff_threshold":   {"diff_threshold": data.Int(256)},
+				"negative dilate":        {"dilate": data.Int(-1)},
+				"negative min_area":      {"min_area": data.Float(-1)},
+				"large motion_threshold": {"motion_threshold": data.Float(1.5)},
+				"zero max_age":           {"max_age": data.Int(0)},
+			}
+			for name, params := range cases {
+				Convey("Then it should return an error: "+name, func() {
+					_, err := NewMotionDetector(ctx, params)
+					So(err, ShouldNotBeNil)
+				})
+			}
+		})
+	})
+}
+
+func TestDetectMotion(t *testing.T) {
+	Convey("Given a motion detector state", t, func() {
+		ctx := core.NewContext(nil)
+		st, err := NewMotionDetector(ctx, data.Map{"blur": data.Int(0)})
+		So(err, ShouldBeNil)
+		So(ctx.SharedStates.Add("m", "opencv_motion_detector", st), ShouldBeNil)
+		Reset(func() {
+			st.Terminate(ctx)
+		})
+		black := filledCVMAT(8, 8, 0)
+		white := filledCVMAT(8, 8, 255)
+		noMotion := data.Map{
+			"score":  data.Float(0),
+			"rects":  data.Array{},
+			"moving": data.False,
+		}
+
+		Convey("When detect the first frame", func() {
+			m, err := DetectMotion(ctx, "m", black)
+			Convey("Then it should have no motion", func() {
+				So(err, ShouldBeNil)
+				So(m, ShouldResemble, noMotion)
+			})
+		})
+		Convey("When detect a changed frame", func() {
+			_, err := DetectMotion(ctx, "m", black)
+			So(err, ShouldBeNil)
+			m, err := DetectMotion(ctx, "m", white)
+			Convey("Then the whole frame should be moving", func() {
+				So(err, ShouldBeNil)
+				So(m, ShouldResemble, data.Map{
+					"score": data.Float(1),
+					"rects": data.Array{data.Map{
+						"x":      data.Int(0),
+						"y":      data.Int(0),
+						"width":  data.Int(8),
+						"height": data.Int(8),
+					}},
+					"moving": data.True,
+				})
+			})
+			Convey("And detect the same frame again", func() {
+				m, err := DetectMotion(ctx, "m", white)
+				Convey("Then it should have no motion", func() {
+					So(err, ShouldBeNil)
+					So(m, ShouldResemble, noMotion)
+				})
+			})
+		})
+		Convey("When detect frames of different keys", func() {
+			_, err := DetectMotion(ctx, "m", black, "cam1")
+			So(err, ShouldBeNil)
+			m, err := DetectMotion(ctx, "m", white, "cam2")
+			Convey("Then they should not be compared", func() {
+				So(err, ShouldBeNil)
+				So(m, ShouldResemble, noMotion)
+			})
+		})
+		Convey("When the frame size is changed", func() {
+			_, err := DetectMotion(ctx, "m", black)
+			So(err, ShouldBeNil)
+			m, err := DetectMotion(ctx, "m", filledCVMAT(4, 4, 255))
+			Convey("Then it should have no motion", func() {
+				So(err, ShouldBeNil)
+				So(m, ShouldResemble, noMotion)
+			})
+		})
+		Convey("When a key is not given for more than max_age frames", func() {
+			st, err := NewMotionDetector(ctx, data.Map{
+				"blur":    data.Int(0),
+				"max_age": data.Int(1),
+			})
+			So(err, ShouldBeNil)
+			So(ctx.SharedStates.Add("m_idle", "opencv_motion_detector", st),
+				ShouldBeNil)
+			Reset(func() {
+				st.Terminate(ctx)
+			})
+			_, err = DetectMotion(ctx, "m_idle", black, "cam1")
+			So(err, ShouldBeNil)
+			_, err = DetectMotion(ctx, "m_idle", white, "cam2")
+			So(err, ShouldBeNil)
+			_, err = DetectMotion(ctx, "m_idle", white, "cam2")
+			So(err, ShouldBeNil)
+			Convey("Then the previous frame of the key should be deleted", func() {
+				d := st.(*motionDetector)
+				So(d.prevs, ShouldNotContainKey, "cam1")
+				m, err := DetectMotion(ctx, "m_idle", white, "cam1")
+				So(err, ShouldBeNil)
+				So(m, ShouldResemble, noMotion)
+			})
+		})
+		Convey("When detect with two keys", func() {
+			_, err := DetectMotion(ctx, "m", black, "cam1", "cam2")
+			Convey("Then it should return an error", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
@@ -0,0 +1,329 @@
+package opencv
+
+import (
+	"fmt"
+	"gopkg.in/sensorbee/opencv.v0/bridge"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"math"
+	"strings"
+	"sync"
+)
+
+var (
+	matchPath        = data.MustCompilePath("match")
+	iouThresholdPath = data.MustCompilePath("iou_threshold")
+	maxDistancePath  = data.MustCompilePath("max_distance")
+	maxAgePath       = data.MustCompilePath("max_age")
+	minHitsPath      = data.MustCompilePath("min_hits")
+)
+
+// unmatchedCost is a cost of a track and a rectangle which cannot be
+// matched. Costs of matchable pairs are from 0 to 1.
+const unmatchedCost = 1e6
+
+// NewMultiTracker returns multiTracker state, which gives persistent IDs to
+// rectangles detected in each frame, e.g. by DetectMultiScale, by matching
+// them with tracks of previous frames.
+//
+// match: "iou" (rectangles are matched by intersection over union) or
+// "centroid" (rectangles are matched by the distance of their centers).
+// Positions of tracks are predicted by their velocity before matching, and
+// pairs are assigned by the Hungarian method. Default is "iou".
+//
+// iou_threshold: The minimum IoU of a matched pair for "iou". Default is 0.3.
+//
+// max_distance: The maximum distance of centers of a matched pair in pixels
+// for "centroid". Default is 50.
+//
+// max_age: The number of consecutive frames a track survives without any
+// matched rectangle. Default is 5.
+//
+// min_hits: The number of matched frames until a track is confirmed. A
+// confirmed track has an ID, which is unique in the state. Default is 3.
+func NewMultiTracker(ctx *core.Context, params data.Map) (core.SharedState,
+	error) {
+	t := &multiTracker{
+		match:        "iou",
+		iouThreshold: 0.3,
+		maxDistance:  50,
+		maxAge:       5,
+		minHits:      3,
+		tracks:       map[string][]*trackedObject{},
+	}
+	if v, err := params.Get(matchPath); err == nil {
+		if t.match, err = data.AsString(v); err != nil {
+			return nil, err
+		}
+		t.match = strings.ToLower(t.match)
+		if t.match != "iou" && t.match != "centroid" {
+			return nil, fmt.Errorf("'%v' match is not supported", t.match)
+		}
+	}
+	if v, err := params.Get(iouThresholdPath); err == nil {
+		if t.iouThreshold, err = data.ToFloat(v); err != nil {
+			return nil, err
+		}
+		if t.iouThreshold <= 0 || t.iouThreshold > 1 {
+			return nil, fmt.Errorf("iou_threshold must be in (0, 1]: %v",
+				t.iouThreshold)
+		}
+	}
+	if v, err := params.Get(maxDistancePath); err == nil {
+		if t.maxDistance, err = data.ToFloat(v); err != nil {
+			return nil, err
+		}
+		if t.maxDistance <= 0 {
+			return nil, fmt.Errorf("max_distance must be positive: %v",
+				t.maxDistance)
+		}
+	}
+	if v, err := params.Get(maxAgePath); err == nil {
+		n, err := data.AsInt(v)
+		if err != nil {
+			return nil, err
+		}
+		if n < 0 {
+			return nil, fmt.Errorf("max_age must not be negative: %v", n)
+		}
+		t.maxAge = int(n)
+	}
+	if v, err := params.Get(minHitsPath); err == nil {
+		n, err := data.AsInt(v)
+		if err != nil {
+			return nil, err
+		}
+		if n < 1 {
+			return nil, fmt.Errorf("min_hits must be positive: %v", n)
+		}
+		t.minHits = int(n)
+	}
+	return t, nil
+}
+
+// multiTracker has tracks of each key. Frames of a key are required to be
+// tracked in order, so calls are serialized by the mutex.
+type multiTracker struct {
+	match        string
+	iouThreshold float64
+	maxDistance  float64
+	maxAge       int
+	minHits      int
+
+	m      sync.Mutex
+	tracks map[string][]*trackedObject
+	lastID int64
+}
+
+// trackedObject is a track of an object.
+type trackedObject struct {
+	// id is 0 until the track is confirmed.
+	id   int64
+	rect bridge.Rect
+	// vx and vy are the velocity of the center in pixels per frame.
+	vx float64
+	vy float64
+	// age is the number of frames since the track started.
+	age int
+	// hits is the number of matched frames.
+	hits int
+	// misses is the number of consecutive frames without a match.
+	misses int
+}
+
+// Terminate discards all tracks.
+func (t *multiTracker) Terminate(ctx *core.Context) error {
+	t.m.Lock()
+	defer t.m.Unlock()
+	t.tracks = map[string][]*trackedObject{}
+	return nil
+}
+
+func lookupMultiTracker(ctx *core.Context, name string) (*multiTracker,
+	error) {
+	st, err := ctx.SharedStates.Get(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if s, ok := st.(*multiTracker); ok {
+		return s, nil
+	}
+	return nil, fmt.Errorf("state '%v' cannot be converted to multi_tracker.state",
+		name)
+}
+
+// TrackObjects matches rectangles of a frame with tracks of previous frames
+// of the key.
+//
+// trackerName: multiTracker state name.
+//
+// rects: an array of maps which have "x", "y", "width" and "height", e.g. the
+// result of DetectMultiScale.
+//
+// key: optional key of the stream, e.g. a camera ID. Tracks of different keys
+// are not matched. Default is an empty string.
+//
+// Returns a map which has "rects" and "events". "rects" is the same array as
+// rects, each map of it additionally has "track_id", "age" and "velocity".
+// "track_id" is null until the track is confirmed by min_hits, "age" is the
+// number of frames since the track started, and "velocity" is a map of "x"
+// and "y" in pixels per frame. "events" is an array of maps which have
+// "type", "track_id", "age" and "rect". "type" is "start" when a track is
+// confirmed and "end" when a confirmed track is lost for more than max_age
+// frames, "rect" of "end" is the last matched rectangle.
+func TrackObjects(ctx *core.Context, trackerName string, rects data.Array,
+	key ...string) (data.Map, error) {
+	if len(key) > 1 {
+		return nil, fmt.Errorf("too many keys: %v", len(key))
+	}
+	t, err := lookupMultiTracker(ctx, trackerName)
+	if err != nil {
+		return nil, err
+	}
+	k := ""
+	if len(key) == 1 {
+		k = key[0]
+	}
+	brRects, err := convertToBridgeRects(rects)
+	if err != nil {
+		return nil, err
+	}
+	maps := make([]data.Map, len(rects))
+	for i, r := range rects {
+		m, err := data.AsMap(r)
+		if err != nil {
+			return nil, err
+		}
+		maps[i] = m
+	}
+
+	t.m.Lock()
+	defer t.m.Unlock()
+	matched, events := t.update(k, brRects)
+	ret := make(data.Array, len(rects))
+	for i, o := range matched {
+		m := maps[i].Copy()
+		if o.id == 0 {
+			m["track_id"] = data.Null{}
+		} else {
+			m["track_id"] = data.Int(o.id)
+		}
+		m["age"] = data.Int(o.age)
+		m["velocity"] = data.Map{
+			"x": data.Float(o.vx),
+			"y": data.Float(o.vy),
+		}
+		ret[i] = m
+	}
+	return data.Map{
+		"rects":  ret,
+		"events": events,
+	}, nil
+}
+
+// update updates tracks of the key with rectangles of a frame. It returns the
+// track of each rectangle and events. The caller must hold the lock.
+func (t *multiTracker) update(key string, rects []bridge.Rect) (
+	[]*trackedObject, data.Array) {
+	tracks := t.tracks[key]
+	cost := make([][]float64, len(tracks))
+	for i, o := range tracks {
+		cost[i] = make([]float64, len(rects))
+		predicted := o.predict()
+		for j, r := range rects {
+			cost[i][j] = t.cost(predicted, r)
+		}
+	}
+	assignment := hungarian(cost)
+
+	events := data.Array{}
+	matched := make([]*trackedObject, len(rects))
+	alive := make([]*trackedObject, 0, len(tracks)+len(rects))
+	for i, o := range tracks {
+		o.age++
+		if j := assignment[i]; j >= 0 && cost[i][j] < unmatchedCost {
+			o.hit(rects[j])
+			matched[j] = o
+		} else {
+			o.misses++
+		}
+		if o.misses > t.maxAge {
+			if o.id != 0 {
+				events = append(events, o.event("end"))
+			}
+			continue
+		}
+		alive = append(alive, o)
+	}
+	for j, r := range rects {
+		if matched[j] == nil {
+			o := &trackedObject{rect: r, age: 1, hits: 1}
+			matched[j] = o
+			alive = append(alive, o)
+		}
+	}
+	for _, o := range alive {
+		if o.id == 0 && o.misses == 0 && o.hits >= t.minHits {
+			t.lastID++
+			o.id = t.lastID
+			events = append(events, o.event("start"))
+		}
+	}
+	if len(alive) == 0 {
+		delete(t.tracks, key)
+	} else {
+		t.tracks[key] = alive
+	}
+	return matched, events
+}
+
+// cost returns the cost of matching the predicted rectangle of a track and a
+// rectangle, which is unmatchedCost when they cannot be matched.
+func (t *multiTracker) cost(predicted, r bridge.Rect) float64 {
+	if t.match == "centroid" {
+		px, py := rectCenter(predicted)
+		rx, ry := rectCenter(r)
+		d := math.Hypot(px-rx, py-ry)
+		if d > t.maxDistance {
+			return unmatchedCost
+		}
+		return d / t.maxDistance
+	}
+	iou := rectIoU(predicted, r)
+	if iou < t.iouThreshold {
+		return unmatchedCost
+	}
+	return 1 - iou
+}
+
+// predict returns the rectangle of the track in the next frame, which is
+// moved by the velocity.
+func (o *trackedObject) predict() bridge.Rect {
+	n := float64(o.misses + 1)
+	r := o.rect
+	r.X += roundInt(o.vx * n)
+	r.Y += roundInt(o.vy * n)
+	return r
+}
+
+// hit updates the track with the matched rectangle.
+func (o *trackedObject) hit(r bridge.Rect) {
+	n := float64(o.misses + 1)
+	px, py := rectCenter(o.rect)
+	rx, ry := rectCenter(r)
+	o.vx = (rx - px) / n
+	o.vy = (ry - py) / n
+	o.rect = r
+	o.hits++
+	o.misses = 0
+}
+
+func (o *trackedObject) event(typ string) data.Map {
+	return data.Map{
+		"type":     data.String(typ),
+		"track_id": data.Int(o.id),
+		"age":      data.Int(o.age),
+		"rect":     convertFromBridgeRect(o.rect),
+	}
+}
@@ -0,0 +1,135 @@
+package opencv
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"testing"
+)
+
+func rectMap(x, y, width, height int) data.Map {
+	return data.Map{
+		"x":      data.Int(x),
+		"y":      data.Int(y),
+		"width":  data.Int(width),
+		"height": data.Int(height),
+	}
+}
+
+func TestNewMultiTracker(t *testing.T) {
+	Convey("Given a SensorBee's core.Context", t, func() {
+		ctx := &core.Context{}
+		Convey("When create state with invalid parameters", func() {
+			cases := map[string]data.Map{
+				"unsupported match":     {"match": data.String("kalman")},
+				"zero iou_threshold":    {"iou_threshold": data.Float(0)},
+				"negative max_distance": {"max_distance": data.Int(-1)},
+				"negative max_age":      {"max_age": data.Int(-1)},
+				"zero min_hits":         {"min_hits": data.Int(0)},
+			}
+			for name, params := range cases {
+				Convey("Then it should return an error: "+name, func() {
+					_, err := NewMultiTracker(ctx, params)
+					So(err, ShouldNotBeNil)
+				})
+			}
+		})
+	})
+}
+
+func TestTrackObjects(t *testing.T) {
+	for _, match := range []string{"iou", "centroid"} {
+		Convey("Given a multi tracker state matching by "+match, t, func() {
+			ctx := core.NewContext(nil)
+			st, err := NewMultiTracker(ctx, data.Map{
+				"match":    data.String(match),
+				"max_age":  data.Int(1),
+				"min_hits": data.Int(2),
+			})
+			So(err, ShouldBeNil)
+			So(ctx.SharedStates.Add("mot", "opencv_multi_tracker", st),
+				ShouldBeNil)
+
+			Convey("When track two moving objects", func() {
+				var rets []data.Map
+				for i := 0; i < 3; i++ {
+					ret, err := TrackObjects(ctx, "mot", data.Array{
+						rectMap(10+4*i, 10, 20, 20),
+						rectMap(100, 100-4*i, 20, 20),
+					})
+					So(err, ShouldBeNil)
+					rets = append(rets, ret)
+				}
+				Convey("Then IDs should be given after min_hits", func() {
+					first := rets[0]["rects"].(data.Array)
+					So(first[0].(data.Map)["track_id"], ShouldEqual, data.Null{})
+					So(rets[0]["events"], ShouldBeEmpty)
+					So(rets[1]["events"], ShouldHaveLength, 2)
+					last := rets[2]["rects"].(data.Array)
+					So(last[0].(data.Map)["track_id"], ShouldEqual, data.Int(1))
+					So(last[1].(data.Map)["track_id"], ShouldEqual, data.Int(2))
+					So(last[0].(data.Map)["age"], ShouldEqual, data.Int(3))
+					So(rets[2]["events"], ShouldBeEmpty)
+				})
+				Convey("Then rects should have velocity", func() {
+					last := rets[2]["rects"].(data.Array)
+					So(last[0].(data.Map)["velocity"], ShouldResemble, data.Map{
+						"x": data.Float(4), "y": data.Float(0)})
+					So(last[1].(data.Map)["velocity"], ShouldResemble, data.Map{
+						"x": data.Float(0), "y": data.Float(-4)})
+				})
+				Convey("Then rects should keep other fields", func() {
+					ret, err := TrackObjects(ctx, "mot", data.Array{
+						data.Map{
+							"x": data.Int(22), "y": data.Int(10),
+							"width": data.Int(20), "height": data.Int(20),
+							"weight": data.Float(3),
+						},
+					})
+					So(err, ShouldBeNil)
+					r := ret["rects"].(data.Array)[0].(data.Map)
+					So(r["track_id"], ShouldEqual, data.Int(1))
+					So(r["weight"], ShouldEqual, data.Float(3))
+				})
+
+				Convey("And when the objects disappear", func() {
+					ret1, err := TrackObjects(ctx, "mot", data.Array{})
+					So(err, ShouldBeNil)
+					ret2, err := TrackObjects(ctx, "mot", data.Array{})
+					So(err, ShouldBeNil)
+					Convey("Then tracks should end after max_age", func() {
+						So(ret1["events"], ShouldBeEmpty)
+						events := ret2["events"].(data.Array)
+						So(events, ShouldHaveLength, 2)
+						e := events[0].(data.Map)
+						So(e["type"], ShouldEqual, data.String("end"))
+						So(e["track_id"], ShouldEqual, data.Int(1))
+						So(e["rect"], ShouldResemble, rectMap(18, 10, 20, 20))
+					})
+				})
+			})
+
+			Convey("When track objects of different keys", func() {
+				for i := 0; i < 2; i++ {
+					_, err := TrackObjects(ctx, "mot", data.Array{
+						rectMap(10, 10, 20, 20)}, "cam1")
+					So(err, ShouldBeNil)
+				}
+				ret, err := TrackObjects(ctx, "mot", data.Array{
+					rectMap(10, 10, 20, 20)}, "cam2")
+				Convey("Then they should not be matched", func() {
+					So(err, ShouldBeNil)
+					r := ret["rects"].(data.Array)[0].(data.Map)
+					So(r["track_id"], ShouldEqual, data.Null{})
+				})
+			})
+
+			Convey("When give too many keys", func() {
+				_, err := TrackObjects(ctx, "mot", data.Array{}, "a", "b")
+				Convey("Then it should return an error", func() {
+					So(err, ShouldNotBeNil)
+				})
+			})
+		})
+	}
+}
@@ -0,0 +1,464 @@
+//go:build cgo
+// +build cgo
+
+package opencv
+
+import (
+	"fmt"
+	"gopkg.in/sensorbee/opencv.v0/bridge"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"strings"
+	"sync"
+)
+
+var (
+	methodPath       = data.MustCompilePath("method")
+	pyrScalePath     = data.MustCompilePath("pyr_scale")
+	levelsPath       = data.MustCompilePath("levels")
+	winSizePath      = data.MustCompilePath("win_size")
+	iterationsPath   = data.MustCompilePath("iterations")
+	polyNPath        = data.MustCompilePath("poly_n")
+	polySigmaPath    = data.MustCompilePath("poly_sigma")
+	maxCornersPath   = data.MustCompilePath("max_corners")
+	qualityLevelPath = data.MustCompilePath("quality_level")
+	minDistancePath  = data.MustCompilePath("min_distance")
+	maxLevelPath     = data.MustCompilePath("max_level")
+	minPointsPath    = data.MustCompilePath("min_points")
+	binsPath         = data.MustCompilePath("bins")
+	maxMagnitudePath = data.MustCompilePath("max_magnitude")
+	renderPath       = data.MustCompilePath("render")
+	renderStepPath   = data.MustCompilePath("render_step")
+)
+
+// Methods of optical flow.
+const (
+	flowFarneback = "farneback"
+	flowLK        = "lk"
+)
+
+// NewOpticalFlow returns opticalFlow state, which computes optical flow
+// between a frame and the previous frame of the same key.
+//
+// method: "farneback" (dense optical flow of all pixels by Farneback method)
+// or "lk" (sparse optical flow of feature points by pyramidal Lucas-Kanade
+// method). Default is "farneback".
+//
+// The following parameters are for "farneback", see
+// cv::calcOpticalFlowFarneback.
+//
+// pyr_scale: The scale of each pyramid layer, less than 1. Default is 0.5.
+//
+// levels: The number of pyramid layers. Default is 3.
+//
+// win_size: The averaging window size, it is also the search window size of
+// "lk". Default is 15.
+//
+// iterations: The number of iterations at each pyramid level. Default is 3.
+//
+// poly_n: The size of the pixel neighborhood, typically 5 or 7. Default is 5.
+//
+// poly_sigma: The standard deviation of the Gaussian of poly_n, typically
+// 1.1 for 5 and 1.5 for 7. Default is 1.2.
+//
+// The following parameters are for "lk". Feature points are found by
+// cv::goodFeaturesToTrack on the first frame, and tracked points are tracked
+// again on the next frame. New points are found when the number of tracked
+// points becomes less than min_points.
+//
+// max_corners: The maximum number of feature points. Default is 100.
+//
+// quality_level: The minimal quality of feature points relative to the best
+// one. Default is 0.01.
+//
+// min_distance: The minimum distance between feature points. Default is 10.
+//
+// max_level: The maximal pyramid level. Default is 3.
+//
+// min_points: Feature points are found again when tracked points are less
+// than it. Default is 10.
+//
+// The following parameters are for summaries and rendering.
+//
+// bins: The number of bins of the magnitude histogram. Default is 8.
+//
+// max_magnitude: The upper bound of the magnitude histogram in pixels,
+// larger vectors are in the last bin. Default is 20.
+//
+// render: If set `true` then results have "image", the frame which flow is
+// drawn on. Default is false.
+//
+// render_step: Flow vectors of "farneback" are drawn at every this number of
+// pixels. Default is 16.
+//
+// max_age: The number of frames of all keys after which the previous frame
+// of a key which is not given is deleted, required to be larger than the
+// number of keys. Default is 300.
+func NewOpticalFlow(ctx *core.Context, params data.Map) (core.SharedState,
+	error) {
+	f := &opticalFlow{
+		method:       flowFarneback,
+		farneback:    bridge.NewFarnebackParams(),
+		maxCorners:   100,
+		qualityLevel: 0.01,
+		minDistance:  10,
+		maxLevel:     3,
+		minPoints:    10,
+		bins:         8,
+		maxMagnitude: 20,
+		renderStep:   16,
+		tracks:       map[string]*flowTrack{},
+		keys:         newIdleKeys(300),
+	}
+	if v, err := params.Get(methodPath); err == nil {
+		m, err := data.AsString(v)
+		if err != nil {
+			return nil, err
+		}
+		switch l := strings.ToLower(m); l {
+		case flowFarneback, flowLK:
+			f.method = l
+		default:
+			return nil, fmt.Errorf("'%v' method is not supported", m)
+		}
+	}
+
+	if v, err := params.Get(pyrScalePath); err == nil {
+		s, err := data.ToFloat(v)
+		if err != nil {
+			return nil, err
+		}
+		if s <= 0 || s >= 1 {
+			return nil, fmt.Errorf("pyr_scale must be between 0 and 1: %v", s)
+		}
+		f.farneback.PyrScale = s
+	}
+	if v, err := params.Get(polySigmaPath); err == nil {
+		s, err := data.ToFloat(v)
+		if err != nil {
+			return nil, err
+		}
+		if s <= 0 {
+			return nil, fmt.Errorf("poly_sigma must be positive: %v", s)
+		}
+		f.farneback.PolySigma = s
+	}
+	if v, err := params.Get(qualityLevelPath); err == nil {
+		q, err := data.ToFloat(v)
+		if err != nil {
+			return nil, err
+		}
+		if q <= 0 || q >= 1 {
+			return nil, fmt.Errorf("quality_level must be between 0 and 1: %v",
+				q)
+		}
+		f.qualityLevel = q
+	}
+	if v, err := params.Get(minDistancePath); err == nil {
+		d, err := data.ToFloat(v)
+		if err != nil {
+			return nil, err
+		}
+		if d < 0 {
+			return nil, fmt.Errorf("min_distance must not be negative: %v", d)
+		}
+		f.minDistance = d
+	}
+	if v, err := params.Get(maxMagnitudePath); err == nil {
+		m, err := data.ToFloat(v)
+		if err != nil {
+			return nil, err
+		}
+		if m <= 0 {
+			return nil, fmt.Errorf("max_magnitude must be positive: %v", m)
+		}
+		f.maxMagnitude = m
+	}
+	if v, err := params.Get(renderPath); err == nil {
+		if f.render, err = data.AsBool(v); err != nil {
+			return nil, err
+		}
+	}
+
+	// integer parameters and their minimum values
+	intParams := []struct {
+		path data.Path
+		name string
+		dst  *int
+		min  int
+	}{
+		{levelsPath, "levels", &f.farneback.Levels, 0},
+		{winSizePath, "win_size", &f.farneback.WinSize, 3},
+		{iterationsPath, "iterations", &f.farneback.Iterations, 1},
+		{polyNPath, "poly_n", &f.farneback.PolyN, 1},
+		{maxCornersPath, "max_corners", &f.maxCorners, 1},
+		{maxLevelPath, "max_level", &f.maxLevel, 0},
+		{minPointsPath, "min_points", &f.minPoints, 0},
+		{binsPath, "bins", &f.bins, 1},
+		{renderStepPath, "render_step", &f.renderStep, 1},
+		{maxAgePath, "max_age", &f.keys.maxAge, 1},
+	}
+	for _, p := range intParams {
+		v, err := params.Get(p.path)
+		if err != nil {
+			continue
+		}
+		n, err := data.AsInt(v)
+		if err != nil {
+			return nil, err
+		}
+		if n < int64(p.min) {
+			return nil, fmt.Errorf("%v must be %v or larger: %v", p.name, p.min,
+				n)
+		}
+		*p.dst = int(n)
+	}
+	return f, nil
+}
+
+// opticalFlow has the previous grayscale frame and feature points of each
+// key.
+type opticalFlow struct {
+	method       string
+	farneback    bridge.FarnebackParams
+	maxCorners   int
+	qualityLevel float64
+	minDistance  float64
+	maxLevel     int
+	minPoints    int
+	bins         int
+	maxMagnitude float64
+	render       bool
+	renderStep   int
+
+	m      sync.Mutex
+	tracks map[string]*flowTrack
+	keys   *idleKeys
+}
+
+// flowTrack is the previous frame of a key. Frames of the same key are
+// computed in order by the mutex, frames of different keys are computed
+// concurrently.
+type flowTrack struct {
+	m      sync.Mutex
+	prev   *bridge.Mat
+	points []bridge.Point2f
+	// deleted is true when the track is removed from the state.
+	deleted bool
+}
+
+// delete deletes the previous frame. The track is required to be locked and
+// removed from the state.
+func (t *flowTrack) delete() {
+	if t.prev != nil {
+		t.prev.Delete()
+		t.prev = nil
+	}
+	t.points = nil
+	t.deleted = true
+}
+
+// Terminate deletes all previous frames.
+func (f *opticalFlow) Terminate(ctx *core.Context) error {
+	f.m.Lock()
+	defer f.m.Unlock()
+	for k, t := range f.tracks {
+		t.m.Lock()
+		t.delete()
+		t.m.Unlock()
+		delete(f.tracks, k)
+		f.keys.forget(k)
+	}
+	return nil
+}
+
+func lookupOpticalFlow(ctx *core.Context, name string) (*opticalFlow, error) {
+	st, err := ctx.SharedStates.Get(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if s, ok := st.(*opticalFlow); ok {
+		return s, nil
+	}
+	return nil, fmt.Errorf("state '%v' cannot be converted to optical_flow.state",
+		name)
+}
+
+// track returns the flowTrack of the key, which is locked. Tracks of idle
+// keys are deleted.
+func (f *opticalFlow) track(key string) *flowTrack {
+	for {
+		f.m.Lock()
+		t, ok := f.tracks[key]
+		if !ok {
+			t = &flowTrack{}
+			f.tracks[key] = t
+		}
+		var idle []*flowTrack
+		for _, k := range f.keys.touch(key) {
+			idle = append(idle, f.tracks[k])
+			delete(f.tracks, k)
+		}
+		f.m.Unlock()
+
+		for _, it := range idle {
+			it.m.Lock()
+			it.delete()
+			it.m.Unlock()
+		}
+		t.m.Lock()
+		if !t.deleted {
+			return t
+		}
+		// The track was deleted while waiting for the lock.
+		t.m.Unlock()
+	}
+}
+
+// CalcOpticalFlow computes optical flow from the previous frame of the key
+// to the frame, and remembers the frame as the next previous frame.
+//
+// flowName: opticalFlow state name.
+//
+// img: a frame as RawData map structure.
+//
+// key: optional key of the stream, e.g. a camera ID. Frames of different keys
+// are not compared. Default is an empty string.
+//
+// Returns a summary map of flow vectors, which has "count" of vectors,
+// "mean" vector as a map of "x" and "y", "angle" of the mean vector in
+// degrees (0 is right and 90 is down), mean "magnitude" and "histogram" of
+// magnitudes, which is an array of ratios of vectors in each bin. "lk" also
+// returns "points", an array of tracked point pairs which have "from" and
+// "to" points. When render is true, the map has "image" which flow is drawn
+// on. The first frame of a key, or a frame whose size differs from the
+// previous frame, has no vector.
+func CalcOpticalFlow(ctx *core.Context, flowName string, img data.Map,
+	key ...string) (data.Map, error) {
+	if len(key) > 1 {
+		return nil, fmt.Errorf("too many keys: %v", len(key))
+	}
+	f, err := lookupOpticalFlow(ctx, flowName)
+	if err != nil {
+		return nil, err
+	}
+	k := ""
+	if len(key) == 1 {
+		k = key[0]
+	}
+
+	raw, err := ConvertMapToRawData(img)
+	if err != nil {
+		return nil, err
+	}
+	mat, err := defaultMatVec3bPool.get(&raw)
+	if err != nil {
+		return nil, err
+	}
+	defer defaultMatVec3bPool.put(mat)
+	gray, err := bridge.ToBlurredGray(mat, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	t := f.track(k)
+	defer t.m.Unlock()
+	prev := t.prev
+	t.prev = &gray
+	if prev != nil {
+		defer prev.Delete()
+		if prev.Rows() != gray.Rows() || prev.Cols() != gray.Cols() {
+			prev = nil
+		}
+	}
+
+	var ret data.Map
+	if f.method == flowLK {
+		ret, err = f.calcLK(t, prev, gray, mat)
+	} else {
+		ret, err = f.calcFarneback(prev, gray, mat)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if f.render {
+		rendered := ToRawData(mat)
+		ret["image"] = rendered.ConvertToDataMap()
+	}
+	return ret, nil
+}
+
+// calcFarneback computes dense optical flow and draws it on img when render
+// is true. prev is nil when there is no previous frame.
+func (f *opticalFlow) calcFarneback(prev *bridge.Mat, gray bridge.Mat,
+	img bridge.MatVec3b) (data.Map, error) {
+	if prev == nil {
+		s := summarizeFlow(nil, f.bins, f.maxMagnitude)
+		return s.toMap(), nil
+	}
+	flow, err := bridge.CalcOpticalFlowFarneback(*prev, gray, f.farneback)
+	if err != nil {
+		return nil, err
+	}
+	defer flow.Delete()
+	vectors, err := flow.ToFloat32s()
+	if err != nil {
+		return nil, err
+	}
+	if f.render {
+		if err := bridge.DrawFlow(img, flow, f.renderStep); err != nil {
+			return nil, err
+		}
+	}
+	s := summarizeFlow(vectors, f.bins, f.maxMagnitude)
+	return s.toMap(), nil
+}
+
+// calcLK tracks feature points of the track, and draws them on img when
+// render is true. prev is nil when there is no previous frame. Feature points
+// are found again when tracked points are not enough.
+func (f *opticalFlow) calcLK(t *flowTrack, prev *bridge.Mat, gray bridge.Mat,
+	img bridge.MatVec3b) (data.Map, error) {
+	var from, to []bridge.Point2f
+	if prev != nil && len(t.points) > 0 {
+		var err error
+		from, to, err = bridge.CalcOpticalFlowPyrLK(*prev, gray, t.points,
+			f.farneback.WinSize, f.maxLevel)
+		if err != nil {
+			return nil, err
+		}
+	}
+	t.points = to
+	if len(t.points) < f.minPoints || len(t.points) == 0 {
+		points, err := bridge.GoodFeaturesToTrack(gray, f.maxCorners,
+			f.qualityLevel, f.minDistance)
+		if err != nil {
+			return nil, err
+		}
+		t.points = points
+	}
+	if f.render {
+		if err := bridge.DrawFlowPoints(img, from, to); err != nil {
+			return nil, err
+		}
+	}
+
+	s := summarizeFlow(flowVectors(from, to), f.bins, f.maxMagnitude)
+	ret := s.toMap()
+	pairs := make(data.Array, len(from))
+	for i := range from {
+		pairs[i] = data.Map{
+			"from": data.Map{
+				"x": data.Float(from[i].X),
+				"y": data.Float(from[i].Y),
+			},
+			"to": data.Map{
+				"x": data.Float(to[i].X),
+				"y": data.Float(to[i].Y),
+			},
+		}
+	}
+	ret["points"] = pairs
+	return ret, nil
+}
@@ -0,0 +1,149 @@
+//go:build cgo
+// +build cgo
+
+package opencv
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"testing"
+)
+
+// squareCVMAT returns a black "cvmat" RawData map which has a white square.
+func squareCVMAT(width, height, x, y, size int) data.Map {
+	b := make([]byte, width*height*3)
+	for j := y; j < y+size; j++ {
+		for i := x; i < x+size; i++ {
+			for c := 0; c < 3; c++ {
+				b[(j*width+i)*3+c] = 255
+			}
+		}
+	}
+	return data.Map{
+		"format": data.String("cvmat"),
+		"width":  data.Int(width),
+		"height": data.Int(height),
+		"image":  data.Blob(b),
+	}
+}
+
+func TestNewOpticalFlow(t *testing.T) {
+	Convey("Given a SensorBee's core.Context", t, func() {
+		ctx := &core.Context{}
+		Convey("When create state with invalid parameters", func() {
+			cases := map[string]data.Map{
+				"unsupported method": {"method": data.String("horn")},
+				"large pyr_scale":    {"pyr_scale": data.Float(1)},
+				"small win_size":     {"win_size": data.Int(1)},
+				"zero bins":          {"bins": data.Int(0)},
+				"zero max_magnitude": {"max_magnitude": data.Int(0)},
+				"quality_level":      {"quality_level": data.Float(0)},
+				"invalid render":     {"render": data.String("yes")},
+				"zero max_age":       {"max_age": data.Int(0)},
+			}
+			for name, params := range cases {
+				Convey("Then it should return an error: "+name, func() {
+					_, err := NewOpticalFlow(ctx, params)
+					So(err, ShouldNotBeNil)
+				})
+			}
+		})
+	})
+}
+
+func TestCalcOpticalFlow(t *testing.T) {
+	Convey("Given a dense optical flow state", t, func() {
+		ctx := core.NewContext(nil)
+		st, err := NewOpticalFlow(ctx, data.Map{
+			"bins":   data.Int(4),
+			"render": data.True,
+		})
+		So(err, ShouldBeNil)
+		So(ctx.SharedStates.Add("flow", "opencv_optical_flow", st), ShouldBeNil)
+		Reset(func() {
+			st.Terminate(ctx)
+		})
+		frame := squareCVMAT(32, 32, 8, 8, 8)
+
+		Convey("When compute the first frame", func() {
+			f, err := CalcOpticalFlow(ctx, "flow", frame)
+			Convey("Then it should have no vector", func() {
+				So(err, ShouldBeNil)
+				So(f["count"], ShouldEqual, data.Int(0))
+				So(f["histogram"], ShouldResemble, data.Array{
+					data.Float(0), data.Float(0), data.Float(0), data.Float(0)})
+			})
+			Convey("Then it should have the rendered image", func() {
+				So(f["image"], ShouldNotBeNil)
+			})
+		})
+		Convey("When compute the same frame twice", func() {
+			_, err := CalcOpticalFlow(ctx, "flow", frame, "cam1")
+			So(err, ShouldBeNil)
+			f, err := CalcOpticalFlow(ctx, "flow", frame, "cam1")
+			Convey("Then it should have still vectors of all pixels", func() {
+				So(err, ShouldBeNil)
+				So(f["count"], ShouldEqual, data.Int(32*32))
+				m, err := data.AsFloat(f["magnitude"])
+				So(err, ShouldBeNil)
+				So(m, ShouldBeLessThan, 0.1)
+			})
+		})
+		Convey("When a key is not given for more than max_age frames", func() {
+			st, err := NewOpticalFlow(ctx, data.Map{"max_age": data.Int(1)})
+			So(err, ShouldBeNil)
+			So(ctx.SharedStates.Add("flow_idle", "opencv_optical_flow", st),
+				ShouldBeNil)
+			Reset(func() {
+				st.Terminate(ctx)
+			})
+			_, err = CalcOpticalFlow(ctx, "flow_idle", frame, "cam1")
+			So(err, ShouldBeNil)
+			_, err = CalcOpticalFlow(ctx, "flow_idle", frame, "cam2")
+			So(err, ShouldBeNil)
+			_, err = CalcOpticalFlow(ctx, "flow_idle", frame, "cam2")
+			So(err, ShouldBeNil)
+			Convey("Then the previous frame of the key should be deleted", func() {
+				So(st.(*opticalFlow).tracks, ShouldNotContainKey, "cam1")
+				f, err := CalcOpticalFlow(ctx, "flow_idle", frame, "cam1")
+				So(err, ShouldBeNil)
+				So(f["count"], ShouldEqual, data.Int(0))
+			})
+		})
+	})
+
+	Convey("Given a sparse optical flow state", t, func() {
+		ctx := core.NewContext(nil)
+		st, err := NewOpticalFlow(ctx, data.Map{
+			"method":    data.String("lk"),
+			"max_level": data.Int(0),
+		})
+		So(err, ShouldBeNil)
+		So(ctx.SharedStates.Add("lk", "opencv_optical_flow", st), ShouldBeNil)
+		Reset(func() {
+			st.Terminate(ctx)
+		})
+		frame := squareCVMAT(32, 32, 8, 8, 8)
+
+		Convey("When compute the first frame", func() {
+			f, err := CalcOpticalFlow(ctx, "lk", frame)
+			Convey("Then it should have no point pair", func() {
+				So(err, ShouldBeNil)
+				So(f["points"], ShouldResemble, data.Array{})
+			})
+		})
+		Convey("When compute the same frame twice", func() {
+			_, err := CalcOpticalFlow(ctx, "lk", frame)
+			So(err, ShouldBeNil)
+			f, err := CalcOpticalFlow(ctx, "lk", frame)
+			Convey("Then it should track corners of the square", func() {
+				So(err, ShouldBeNil)
+				points, err := data.AsArray(f["points"])
+				So(err, ShouldBeNil)
+				So(points, ShouldNotBeEmpty)
+				So(f["count"], ShouldEqual, data.Int(len(points)))
+			})
+		})
+	})
+}
@@ -1,3 +1,6 @@
+//go:build cgo
+// +build cgo
+
 package plugin
 
 import (
@@ -24,9 +27,95 @@ func init() {
 		udf.UDSCreatorFunc(opencv.NewCascadeClassifier))
 	udf.MustRegisterGlobalUDF("opencv_detect_multi_scale",
 		udf.MustConvertGeneric(opencv.DetectMultiScale))
+	udf.MustRegisterGlobalUDF("opencv_detect_nested",
+		udf.MustConvertGeneric(opencv.DetectNested))
 	udf.MustRegisterGlobalUDF("opencv_draw_rects",
 		udf.MustConvertGeneric(opencv.DrawRectsToImage))
 
+	// HOG descriptor
+	udf.MustRegisterGlobalUDSCreator("opencv_hog_descriptor",
+		udf.UDSCreatorFunc(opencv.NewHOGDescriptor))
+	udf.MustRegisterGlobalUDF("opencv_hog_detect",
+		udf.MustConvertGeneric(opencv.HOGDetect))
+
+	// dnn
+	udf.MustRegisterGlobalUDSCreator("opencv_dnn_net",
+		udf.UDSCreatorFunc(opencv.NewDNNNet))
+	udf.MustRegisterGlobalUDF("opencv_dnn_forward",
+		udf.MustConvertGeneric(opencv.DNNForward))
+	udf.MustRegisterGlobalUDF("opencv_dnn_detect",
+		udf.MustConvertGeneric(opencv.DNNDetect))
+
+	// background subtractor
+	udf.MustRegisterGlobalUDSCreator("opencv_background_subtractor",
+		udf.UDSCreatorFunc(opencv.NewBackgroundSubtractor))
+	udf.MustRegisterGlobalUDF("opencv_subtract_background",
+		udf.MustConvertGeneric(opencv.SubtractBackground))
+
+	// motion detector
+	udf.MustRegisterGlobalUDSCreator("opencv_motion_detector",
+		udf.UDSCreatorFunc(opencv.NewMotionDetector))
+	udf.MustRegisterGlobalUDF("opencv_motion",
+		udf.MustConvertGeneric(opencv.DetectMotion))
+
+	// optical flow
+	udf.MustRegisterGlobalUDSCreator("opencv_optical_flow",
+		udf.UDSCreatorFunc(opencv.NewOpticalFlow))
+	udf.MustRegisterGlobalUDF("opencv_calc_optical_flow",
+		udf.MustConvertGeneric(opencv.CalcOpticalFlow))
+
+	// tracker
+	udf.MustRegisterGlobalUDSCreator("opencv_tracker",
+		udf.UDSCreatorFunc(opencv.NewTracker))
+	udf.MustRegisterGlobalUDF("opencv_init_tracker",
+		udf.MustConvertGeneric(opencv.InitTracker))
+	udf.MustRegisterGlobalUDF("opencv_update_tracker",
+		udf.MustConvertGeneric(opencv.UpdateTracker))
+
+	// multi-object tracker
+	udf.MustRegisterGlobalUDSCreator("opencv_multi_tracker",
+		udf.UDSCreatorFunc(opencv.NewMultiTracker))
+	udf.MustRegisterGlobalUDF("opencv_track_objects",
+		udf.MustConvertGeneric(opencv.TrackObjects))
+
+	// line counter
+	udf.MustRegisterGlobalUDSCreator("opencv_line_counter",
+		udf.UDSCreatorFunc(opencv.NewLineCounter))
+	udf.MustRegisterGlobalUDF("opencv_count_crossings",
+		udf.MustConvertGeneric(opencv.CountCrossings))
+	udf.MustRegisterGlobalUDF("opencv_reset_line_counter",
+		udf.MustConvertGeneric(opencv.ResetLineCounter))
+
+	// rect
+	udf.MustRegisterGlobalUDF("opencv_nms",
+		udf.MustConvertGeneric(opencv.NonMaximumSuppression))
+	udf.MustRegisterGlobalUDF("opencv_group_rects",
+		udf.MustConvertGeneric(opencv.GroupRects))
+	udf.MustRegisterGlobalUDF("opencv_rect_iou",
+		udf.MustConvertGeneric(opencv.RectIoU))
+	udf.MustRegisterGlobalUDF("opencv_rect_overlap",
+		udf.MustConvertGeneric(opencv.RectOverlap))
+	udf.MustRegisterGlobalUDF("opencv_rect_intersection",
+		udf.MustConvertGeneric(opencv.RectIntersection))
+	udf.MustRegisterGlobalUDF("opencv_rect_union",
+		udf.MustConvertGeneric(opencv.RectUnion))
+	udf.MustRegisterGlobalUDF("opencv_rect_area",
+		udf.MustConvertGeneric(opencv.RectArea))
+	udf.MustRegisterGlobalUDF("opencv_rect_center",
+		udf.MustConvertGeneric(opencv.RectCenter))
+	udf.MustRegisterGlobalUDF("opencv_scale_rect",
+		udf.MustConvertGeneric(opencv.ScaleRect))
+	udf.MustRegisterGlobalUDF("opencv_pad_rect",
+		udf.MustConvertGeneric(opencv.PadRect))
+	udf.MustRegisterGlobalUDF("opencv_clamp_rect",
+		udf.MustConvertGeneric(opencv.ClampRect))
+	udf.MustRegisterGlobalUDF("opencv_rect_contains",
+		udf.MustConvertGeneric(opencv.RectContains))
+
+	// version
+	udf.MustRegisterGlobalUDF("opencv_version",
+		udf.MustConvertGeneric(opencv.Version))
+
 	// mount image
 	udf.MustRegisterGlobalUDSCreator("opencv_shared_image",
 		udf.UDSCreatorFunc(opencv.NewSharedImage))
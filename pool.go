@@ -0,0 +1,66 @@
+//go:build cgo
+// +build cgo
+
+package opencv
+
+import (
+	"fmt"
+	"gopkg.in/sensorbee/opencv.v0/bridge"
+	"runtime"
+)
+
+// matVec3bPool is a free list of MatVec3b reused across UDF invocations. A
+// MatVec3b keeps its buffer after it is returned to the pool, and the buffer
+// is reused when a frame of the same size is copied to it, so continuous
+// frames from a camera do not cause allocation on C heap.
+//
+// sync.Pool cannot be used for MatVec3b because objects in sync.Pool are
+// dropped without notice and C++ objects would leak. The pool holds a limited
+// number of MatVec3b and deletes overflowed ones.
+type matVec3bPool struct {
+	mats chan bridge.MatVec3b
+}
+
+func newMatVec3bPool(size int) *matVec3bPool {
+	return &matVec3bPool{
+		mats: make(chan bridge.MatVec3b, size),
+	}
+}
+
+// defaultMatVec3bPool is used by UDFs. The size is enough to hold a MatVec3b
+// per concurrent UDF call.
+var defaultMatVec3bPool = newMatVec3bPool(runtime.NumCPU() * 2)
+
+// get returns a MatVec3b which has a copy of the RawData. The MatVec3b is
+// required to put back to the pool after using.
+func (p *matVec3bPool) get(r *RawData) (bridge.MatVec3b, error) {
+	if r.Format != TypeCVMAT {
+		return bridge.MatVec3b{}, fmt.Errorf("'%v' cannot convert to 'MatVec3b'",
+			r.Format)
+	}
+	if err := r.validateSize(); err != nil {
+		return bridge.MatVec3b{}, err
+	}
+
+	var m bridge.MatVec3b
+	select {
+	case m = <-p.mats:
+	default:
+		m = bridge.NewMatVec3b()
+	}
+	if err := m.CopyFromRawData(r.Width, r.Height, r.stride(), r.Data); err != nil {
+		p.put(m)
+		return bridge.MatVec3b{}, err
+	}
+	return m, nil
+}
+
+// put returns the MatVec3b to the pool. The MatVec3b is deleted when the pool
+// is full.
+func (p *matVec3bPool) put(m bridge.MatVec3b) {
+	select {
+	case p.mats <- m:
+	default:
+		m.Delete()
+	}
+}
@@ -3,14 +3,21 @@ package opencv
 import (
 	"bytes"
 	"fmt"
-	"gopkg.in/sensorbee/opencv.v0/bridge"
 	"gopkg.in/sensorbee/sensorbee.v0/data"
 	"image"
+	"image/draw"
 	"image/jpeg"
+	"strconv"
+	"strings"
+	"sync"
 )
 
 var (
-	imagePath = data.MustCompilePath("image")
+	formatPath = data.MustCompilePath("format")
+	widthPath  = data.MustCompilePath("width")
+	heightPath = data.MustCompilePath("height")
+	imagePath  = data.MustCompilePath("image")
+	stepPath   = data.MustCompilePath("step")
 )
 
 // TypeImageFormat is an ID of image format type.
@@ -24,8 +31,99 @@ const (
 	TypeCVMAT4b
 	// TypeJPEG is JPEG format
 	TypeJPEG
+	// TypeCVMAT1b is OpenCV cv::Mat_<uchar> format, used for gray scale
+	// images
+	TypeCVMAT1b
 )
 
+// MatDepth is a depth of cv::Mat elements, values are same as OpenCV's CV_8U,
+// CV_8S and so on.
+type MatDepth int
+
+const (
+	// MatDepth8U is 8-bit unsigned integer, CV_8U
+	MatDepth8U MatDepth = iota
+	// MatDepth8S is 8-bit signed integer, CV_8S
+	MatDepth8S
+	// MatDepth16U is 16-bit unsigned integer, CV_16U
+	MatDepth16U
+	// MatDepth16S is 16-bit signed integer, CV_16S
+	MatDepth16S
+	// MatDepth32S is 32-bit signed integer, CV_32S
+	MatDepth32S
+	// MatDepth32F is 32-bit floating point number, CV_32F
+	MatDepth32F
+	// MatDepth64F is 64-bit floating point number, CV_64F
+	MatDepth64F
+)
+
+var (
+	matDepthNames = []string{"8U", "8S", "16U", "16S", "32S", "32F", "64F"}
+	matDepthSizes = []int{1, 1, 2, 2, 4, 4, 8}
+)
+
+func (d MatDepth) String() string {
+	if d < MatDepth8U || d > MatDepth64F {
+		return "unknown"
+	}
+	return matDepthNames[d]
+}
+
+const (
+	// typeCVMATBase is added to OpenCV's type value (e.g. CV_32FC1) to make
+	// the ID of cv::Mat format which does not have own name.
+	typeCVMATBase   TypeImageFormat = 1 << 16
+	cvChannelShift                  = 3
+	cvMaxChannels                   = 512
+	cvMATFormatName                 = "cvmat_"
+)
+
+// TypeCVMATOf returns the format of cv::Mat whose elements have the depth and
+// the number of channels. 8-bit unsigned 1, 3 and 4 channels formats are
+// "cvmat1b", "cvmat" and "cvmat4b". Other formats are named as
+// "cvmat_{depth}C{channels}", e.g. "cvmat_32FC1" is a cv::Mat of CV_32FC1 and
+// "cvmat_16UC1" is a cv::Mat of CV_16UC1.
+func TypeCVMATOf(depth MatDepth, channels int) TypeImageFormat {
+	if depth == MatDepth8U {
+		switch channels {
+		case 1:
+			return TypeCVMAT1b
+		case 3:
+			return TypeCVMAT
+		case 4:
+			return TypeCVMAT4b
+		}
+	}
+	if depth < MatDepth8U || depth > MatDepth64F || channels < 1 ||
+		channels > cvMaxChannels {
+		return typeUnknownFormat
+	}
+	return typeCVMATBase + TypeImageFormat(int(depth)+(channels-1)<<cvChannelShift)
+}
+
+// MatType returns the depth and the number of channels of cv::Mat format. ok
+// is false when the format is not a cv::Mat format, like "jpeg".
+func (t TypeImageFormat) MatType() (depth MatDepth, channels int, ok bool) {
+	switch t {
+	case TypeCVMAT:
+		return MatDepth8U, 3, true
+	case TypeCVMAT4b:
+		return MatDepth8U, 4, true
+	case TypeCVMAT1b:
+		return MatDepth8U, 1, true
+	}
+	if t < typeCVMATBase {
+		return 0, 0, false
+	}
+	cvType := int(t - typeCVMATBase)
+	depth = MatDepth(cvType & (1<<cvChannelShift - 1))
+	channels = cvType>>cvChannelShift + 1
+	if depth > MatDepth64F || channels > cvMaxChannels {
+		return 0, 0, false
+	}
+	return depth, channels, true
+}
+
 func (t TypeImageFormat) String() string {
 	switch t {
 	case TypeCVMAT:
@@ -34,9 +132,13 @@ func (t TypeImageFormat) String() string {
 		return "cvmat4b"
 	case TypeJPEG:
 		return "jpeg"
-	default:
-		return "unknown"
+	case TypeCVMAT1b:
+		return "cvmat1b"
+	}
+	if depth, ch, ok := t.MatType(); ok {
+		return fmt.Sprintf("%s%vC%d", cvMATFormatName, depth, ch)
 	}
+	return "unknown"
 }
 
 // GetTypeImageFormat returns image format type.
@@ -48,50 +150,51 @@ func GetTypeImageFormat(str string) TypeImageFormat {
 		return TypeCVMAT4b
 	case "jpeg":
 		return TypeJPEG
+	case "cvmat1b":
+		return TypeCVMAT1b
 	default:
+		return parseCVMATFormat(str)
+	}
+}
+
+// parseCVMATFormat parses "cvmat_{depth}C{channels}" style format name.
+func parseCVMATFormat(str string) TypeImageFormat {
+	if !strings.HasPrefix(str, cvMATFormatName) {
+		return typeUnknownFormat
+	}
+	t := strings.ToUpper(str[len(cvMATFormatName):])
+	i := strings.LastIndex(t, "C")
+	if i < 0 {
+		return typeUnknownFormat
+	}
+	ch, err := strconv.Atoi(t[i+1:])
+	if err != nil {
 		return typeUnknownFormat
 	}
+	for d, name := range matDepthNames {
+		if name == t[:i] {
+			return TypeCVMATOf(MatDepth(d), ch)
+		}
+	}
+	return typeUnknownFormat
 }
 
-// RawData is represented of `cv::Mat_<cv::Vec3b>` structure.
+// RawData is represented of `cv::Mat` structure, the type of elements is
+// decided by Format, e.g. "cvmat" is `cv::Mat_<cv::Vec3b>`.
+//
+// Step is the number of bytes of each row. When Step is 0, rows are tightly
+// packed, that is Step equals to `Width * channels`. When Step is larger than
+// that, each row except the last one is followed by padding bytes, which
+// happens when RawData is created from a non-continuous cv::Mat like a region
+// of interest.
 type RawData struct {
 	Format TypeImageFormat
 	Width  int
 	Height int
+	Step   int
 	Data   []byte
 }
 
-// ToRawData converts MatVec3b to RawData.
-func ToRawData(m bridge.MatVec3b) RawData {
-	w, h, data := m.ToRawData()
-	return RawData{
-		Format: TypeCVMAT,
-		Width:  w,
-		Height: h,
-		Data:   data,
-	}
-}
-
-// ToMatVec3b converts RawData to MatVec3b. Returned MatVec3b is required to
-// delete after using.
-func (r *RawData) ToMatVec3b() (bridge.MatVec3b, error) {
-	if r.Format != TypeCVMAT {
-		return bridge.MatVec3b{}, fmt.Errorf("'%v' cannot convert to 'MatVec3b'",
-			r.Format)
-	}
-	return bridge.ToMatVec3b(r.Width, r.Height, r.Data), nil
-}
-
-func toRawMap(m *bridge.MatVec3b) data.Map {
-	r := ToRawData(*m)
-	return data.Map{
-		"format": data.String(r.Format.String()), // = cv::Mat_<cv::Vec3b> = "cvmat"
-		"width":  data.Int(r.Width),
-		"height": data.Int(r.Height),
-		"image":  data.Blob(r.Data),
-	}
-}
-
 // ConvertMapToRawData returns RawData from data.Map. This function is
 // utility method for other plug-in.
 func ConvertMapToRawData(dm data.Map) (RawData, error) {
@@ -128,23 +231,266 @@ func ConvertMapToRawData(dm data.Map) (RawData, error) {
 		}
 	}
 
+	var step int64 // optional
+	if s, err := dm.Get(stepPath); err == nil {
+		if step, err = data.ToInt(s); err != nil {
+			return RawData{}, err
+		}
+	}
+
 	return RawData{
 		Format: format,
 		Width:  int(width),
 		Height: int(height),
+		Step:   int(step),
 		Data:   img,
 	}, nil
 }
 
 // ConvertToDataMap returns data.map. This function is utility method for
-// other plug-in.
+// other plug-in. "step" is set only when rows are not tightly packed.
 func (r *RawData) ConvertToDataMap() data.Map {
-	return data.Map{
+	m := data.Map{
 		"format": data.String(r.Format.String()),
 		"width":  data.Int(r.Width),
 		"height": data.Int(r.Height),
 		"image":  data.Blob(r.Data),
 	}
+	if r.Step != 0 && r.Step != r.Width*r.Format.pixelSize() {
+		m["step"] = data.Int(r.Step)
+	}
+	return m
+}
+
+// pixelSize returns the number of bytes per pixel of cv::Mat formats, returns
+// 0 when the format is not a cv::Mat format.
+func (t TypeImageFormat) pixelSize() int {
+	depth, ch, ok := t.MatType()
+	if !ok {
+		return 0
+	}
+	return matDepthSizes[depth] * ch
+}
+
+// stride returns the number of bytes of each row.
+func (r *RawData) stride() int {
+	if r.Step > 0 {
+		return r.Step
+	}
+	return r.Width * r.Format.pixelSize()
+}
+
+// validateSize returns an error when Data is too short to hold the image of
+// Width, Height and Step. The last row does not need to have padding bytes.
+func (r *RawData) validateSize() error {
+	ch := r.Format.pixelSize()
+	if ch == 0 {
+		return fmt.Errorf("'%v' is not a raw pixel format", r.Format)
+	}
+	if r.Width < 0 || r.Height < 0 || r.Step < 0 {
+		return fmt.Errorf("invalid image size: width=%d, height=%d, step=%d",
+			r.Width, r.Height, r.Step)
+	}
+	rowSize := r.Width * ch
+	if r.stride() < rowSize {
+		return fmt.Errorf("step %d is shorter than a row of %d bytes", r.Step,
+			rowSize)
+	}
+	size := 0
+	if r.Width > 0 && r.Height > 0 {
+		size = (r.Height-1)*r.stride() + rowSize
+	}
+	if len(r.Data) < size {
+		return fmt.Errorf("image data size %d is too short for %dx%d '%v' (step=%d)",
+			len(r.Data), r.Width, r.Height, r.Format, r.stride())
+	}
+	return nil
+}
+
+// foregroundRatio returns the ratio of foreground pixels, which are 255, in a
+// "cvmat1b" mask. Returns 0 when the mask is empty.
+func (r *RawData) foregroundRatio() float64 {
+	if r.Width == 0 || r.Height == 0 {
+		return 0
+	}
+	count := 0
+	stride := r.stride()
+	for y := 0; y < r.Height; y++ {
+		for _, v := range r.Data[y*stride : y*stride+r.Width] {
+			if v == 255 {
+				count++
+			}
+		}
+	}
+	return float64(count) / float64(r.Width*r.Height)
+}
+
+// ToImage converts RawData to Go image. "cvmat" is converted to
+// `*image.RGBA`, "cvmat4b" to `*image.NRGBA`, "cvmat1b" to `*image.Gray` and
+// "cvmat_16UC1" to `*image.Gray16`. "jpeg" is decoded by "image/jpeg"
+// package. Other cv::Mat formats cannot be converted.
+func (r *RawData) ToImage() (image.Image, error) {
+	if r.Format == TypeJPEG {
+		return jpeg.Decode(bytes.NewReader(r.Data))
+	}
+	if r.Format.pixelSize() == 0 {
+		return nil, fmt.Errorf("'%v' cannot convert to image", r.Format)
+	}
+	if err := r.validateSize(); err != nil {
+		return nil, err
+	}
+
+	rect := image.Rect(0, 0, r.Width, r.Height)
+	step := r.stride()
+	switch r.Format {
+	case TypeCVMAT:
+		img := image.NewRGBA(rect)
+		r.fillRGBA(img)
+		return img, nil
+	case TypeCVMAT4b:
+		// BGRA to RGBA, OpenCV's alpha channel is not premultiplied.
+		img := image.NewNRGBA(rect)
+		for y := 0; y < r.Height; y++ {
+			pix := img.Pix[y*img.Stride : y*img.Stride+r.Width*4]
+			src := r.Data[y*step:]
+			for i := 0; i < len(pix); i += 4 {
+				pix[i+0] = src[i+2]
+				pix[i+1] = src[i+1]
+				pix[i+2] = src[i+0]
+				pix[i+3] = src[i+3]
+			}
+		}
+		return img, nil
+	case TypeCVMAT1b:
+		img := image.NewGray(rect)
+		for y := 0; y < r.Height; y++ {
+			copy(img.Pix[y*img.Stride:y*img.Stride+r.Width], r.Data[y*step:])
+		}
+		return img, nil
+	case TypeCVMATOf(MatDepth16U, 1):
+		// cv::Mat is little endian on supported platforms, image.Gray16 is
+		// big endian.
+		img := image.NewGray16(rect)
+		for y := 0; y < r.Height; y++ {
+			pix := img.Pix[y*img.Stride : y*img.Stride+r.Width*2]
+			src := r.Data[y*step:]
+			for i := 0; i < len(pix); i += 2 {
+				pix[i+0] = src[i+1]
+				pix[i+1] = src[i+0]
+			}
+		}
+		return img, nil
+	default:
+		return nil, fmt.Errorf("'%v' cannot convert to image", r.Format)
+	}
+}
+
+// FromImage converts Go image to RawData with the format. When the format is
+// "jpeg", the image is encoded with default quality.
+func FromImage(img image.Image, format TypeImageFormat) (RawData, error) {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	switch format {
+	case TypeCVMAT:
+		rgba := image.NewRGBA(image.Rect(0, 0, w, h))
+		draw.Draw(rgba, rgba.Bounds(), img, b.Min, draw.Src)
+		buf := make([]byte, w*h*3)
+		for i, j := 0, 0; i < len(rgba.Pix); i, j = i+4, j+3 {
+			buf[j+0] = rgba.Pix[i+2]
+			buf[j+1] = rgba.Pix[i+1]
+			buf[j+2] = rgba.Pix[i+0]
+		}
+		return RawData{Format: format, Width: w, Height: h, Data: buf}, nil
+	case TypeCVMAT4b:
+		nrgba := image.NewNRGBA(image.Rect(0, 0, w, h))
+		draw.Draw(nrgba, nrgba.Bounds(), img, b.Min, draw.Src)
+		buf := make([]byte, w*h*4)
+		for i := 0; i < len(nrgba.Pix); i += 4 {
+			buf[i+0] = nrgba.Pix[i+2]
+			buf[i+1] = nrgba.Pix[i+1]
+			buf[i+2] = nrgba.Pix[i+0]
+			buf[i+3] = nrgba.Pix[i+3]
+		}
+		return RawData{Format: format, Width: w, Height: h, Data: buf}, nil
+	case TypeCVMAT1b:
+		gray := image.NewGray(image.Rect(0, 0, w, h))
+		draw.Draw(gray, gray.Bounds(), img, b.Min, draw.Src)
+		return RawData{Format: format, Width: w, Height: h, Data: gray.Pix}, nil
+	case TypeCVMATOf(MatDepth16U, 1):
+		gray := image.NewGray16(image.Rect(0, 0, w, h))
+		draw.Draw(gray, gray.Bounds(), img, b.Min, draw.Src)
+		buf := make([]byte, w*h*2)
+		for i := 0; i < len(buf); i += 2 {
+			buf[i+0] = gray.Pix[i+1]
+			buf[i+1] = gray.Pix[i+0]
+		}
+		return RawData{Format: format, Width: w, Height: h, Data: buf}, nil
+	case TypeJPEG:
+		buf := bytes.NewBuffer([]byte{})
+		if err := jpeg.Encode(buf, img, nil); err != nil {
+			return RawData{}, err
+		}
+		return RawData{Format: format, Width: w, Height: h, Data: buf.Bytes()}, nil
+	default:
+		return RawData{}, fmt.Errorf("image cannot convert to '%v'", format)
+	}
+}
+
+// fillRGBA converts "cvmat" or "cvmat4b" data to RGBA pixels of img, img is
+// required to have the same size. Alpha values of "cvmat4b" are copied as
+// they are, they are not premultiplied.
+func (r *RawData) fillRGBA(img *image.RGBA) {
+	step := r.stride()
+	for y := 0; y < r.Height; y++ {
+		pix := img.Pix[y*img.Stride : y*img.Stride+r.Width*4]
+		src := r.Data[y*step:]
+		if r.Format == TypeCVMAT4b {
+			// BGRA to RGBA
+			for i := 0; i < len(pix); i += 4 {
+				pix[i+0] = src[i+2]
+				pix[i+1] = src[i+1]
+				pix[i+2] = src[i+0]
+				pix[i+3] = src[i+3]
+			}
+			continue
+		}
+		// BGR to RGB
+		for i, j := 0, 0; i < len(pix); i, j = i+4, j+3 {
+			pix[i+0] = src[j+2]
+			pix[i+1] = src[j+1]
+			pix[i+2] = src[j+0]
+			pix[i+3] = 0xFF
+		}
+	}
+}
+
+// rgbaPool and bufferPool hold Go memory which is used only in a function
+// call, e.g. an image converted for JPEG encoding.
+var (
+	rgbaPool = sync.Pool{
+		New: func() interface{} {
+			return &image.RGBA{}
+		},
+	}
+	bufferPool = sync.Pool{
+		New: func() interface{} {
+			return &bytes.Buffer{}
+		},
+	}
+)
+
+// getRGBA returns a RGBA image of the size from rgbaPool. Pixels are not
+// cleared. The image is required to put back to rgbaPool after using.
+func getRGBA(width int, height int) *image.RGBA {
+	img := rgbaPool.Get().(*image.RGBA)
+	size := width * height * 4
+	if cap(img.Pix) < size {
+		img.Pix = make([]byte, size)
+	}
+	img.Pix = img.Pix[:size]
+	img.Stride = width * 4
+	img.Rect = image.Rect(0, 0, width, height)
+	return img
 }
 
 // ToJpegData convert JPGE format image bytes.
@@ -152,26 +498,33 @@ func (r *RawData) ToJpegData(quality int) ([]byte, error) {
 	if r.Format == TypeJPEG {
 		return r.Data, nil
 	}
-	// BGR to RGB
-	rgba := image.NewRGBA(image.Rect(0, 0, r.Width, r.Height))
-	if r.Format == TypeCVMAT {
-		for i, j := 0, 0; i < len(rgba.Pix); i, j = i+4, j+3 {
-			rgba.Pix[i+0] = r.Data[j+2]
-			rgba.Pix[i+1] = r.Data[j+1]
-			rgba.Pix[i+2] = r.Data[j+0]
-			rgba.Pix[i+3] = 0xFF
+
+	var img image.Image
+	switch r.Format {
+	case TypeCVMAT, TypeCVMAT4b:
+		// JPEG has no alpha channel, colors of "cvmat4b" are encoded as they
+		// are and are not blended with the alpha value.
+		if err := r.validateSize(); err != nil {
+			return []byte{}, err
 		}
-	} else if r.Format == TypeCVMAT4b {
-		for i, j := 0, 0; i < len(rgba.Pix); i, j = i+4, j+3 {
-			rgba.Pix[i+0] = r.Data[j+2]
-			rgba.Pix[i+1] = r.Data[j+1]
-			rgba.Pix[i+2] = r.Data[j+0]
-			rgba.Pix[i+3] = r.Data[j+3]
+		rgba := getRGBA(r.Width, r.Height)
+		defer rgbaPool.Put(rgba)
+		r.fillRGBA(rgba)
+		img = rgba
+	default:
+		i, err := r.ToImage()
+		if err != nil {
+			return []byte{}, err
 		}
-	} else {
-		return []byte{}, fmt.Errorf("'%v' cannot convert to JPEG", r.Format)
+		img = i
+	}
+
+	w := bufferPool.Get().(*bytes.Buffer)
+	defer bufferPool.Put(w)
+	w.Reset()
+	if err := jpeg.Encode(w, img, &jpeg.Options{Quality: quality}); err != nil {
+		return []byte{}, err
 	}
-	w := bytes.NewBuffer([]byte{})
-	err := jpeg.Encode(w, rgba, &jpeg.Options{Quality: quality})
-	return w.Bytes(), err
+	// the buffer is reused, returns a copy
+	return append([]byte{}, w.Bytes()...), nil
 }
@@ -0,0 +1,84 @@
+//go:build cgo
+// +build cgo
+
+package opencv
+
+import (
+	"fmt"
+	"gopkg.in/sensorbee/opencv.v0/bridge"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+)
+
+// Conversions between RawData and bridge types, which require cgo and OpenCV.
+// Other RawData utilities are built without cgo.
+
+// ToRawData converts MatVec3b to RawData.
+func ToRawData(m bridge.MatVec3b) RawData {
+	w, h, step, data := m.ToRawData()
+	if step == w*3 {
+		step = 0
+	}
+	return RawData{
+		Format: TypeCVMAT,
+		Width:  w,
+		Height: h,
+		Step:   step,
+		Data:   data,
+	}
+}
+
+// ToMatVec3b converts RawData to MatVec3b. Returned MatVec3b is required to
+// delete after using.
+func (r *RawData) ToMatVec3b() (bridge.MatVec3b, error) {
+	if r.Format != TypeCVMAT {
+		return bridge.MatVec3b{}, fmt.Errorf("'%v' cannot convert to 'MatVec3b'",
+			r.Format)
+	}
+	if err := r.validateSize(); err != nil {
+		return bridge.MatVec3b{}, err
+	}
+	return bridge.ToMatVec3b(r.Width, r.Height, r.stride(), r.Data)
+}
+
+// MatToRawData converts Mat to RawData. The format is decided by the type of
+// the Mat, see TypeCVMATOf. Returns an error when the depth of the Mat is not
+// supported, e.g. CV_16F of OpenCV 4.
+func MatToRawData(m bridge.Mat) (RawData, error) {
+	if t := m.Type(); t.ElemSize1() == 0 {
+		return RawData{}, fmt.Errorf("unsupported type of Mat: depth=%v",
+			t.Depth())
+	}
+	rows, cols, t, step, data := m.ToRawData()
+	if step == cols*t.ElemSize() {
+		step = 0
+	}
+	return RawData{
+		Format: TypeCVMATOf(MatDepth(t.Depth()), t.Channels()),
+		Width:  cols,
+		Height: rows,
+		Step:   step,
+		Data:   data,
+	}, nil
+}
+
+// ToMat converts RawData of any cv::Mat format to Mat. Returned Mat is
+// required to delete after using.
+func (r *RawData) ToMat() (bridge.Mat, error) {
+	depth, ch, ok := r.Format.MatType()
+	if !ok {
+		return bridge.Mat{}, fmt.Errorf("'%v' cannot convert to 'Mat'", r.Format)
+	}
+	if err := r.validateSize(); err != nil {
+		return bridge.Mat{}, err
+	}
+	t, err := bridge.NewMatType(int(depth), ch)
+	if err != nil {
+		return bridge.Mat{}, err
+	}
+	return bridge.NewMatFromBytes(r.Height, r.Width, t, r.stride(), r.Data)
+}
+
+func toRawMap(m *bridge.MatVec3b) data.Map {
+	r := ToRawData(*m) // = cv::Mat_<cv::Vec3b> = "cvmat"
+	return r.ConvertToDataMap()
+}
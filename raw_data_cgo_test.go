@@ -0,0 +1,124 @@
+//go:build cgo
+// +build cgo
+
+package opencv
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/opencv.v0/bridge"
+	"testing"
+)
+
+func TestRawDataToMatVec3b(t *testing.T) {
+	Convey("Given a 2x2 cvmat RawData", t, func() {
+		raw := RawData{
+			Format: TypeCVMAT,
+			Width:  2,
+			Height: 2,
+			Data:   []byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12},
+		}
+		Convey("When convert to MatVec3b and modify the source data", func() {
+			mat, err := raw.ToMatVec3b()
+			So(err, ShouldBeNil)
+			defer mat.Delete()
+			raw.Data[0] = 99
+			Convey("Then the MatVec3b should not be affected", func() {
+				ret := ToRawData(mat)
+				So(ret.Data[0], ShouldEqual, 1)
+			})
+		})
+
+		Convey("When convert to MatVec3b and back to RawData", func() {
+			mat, err := raw.ToMatVec3b()
+			So(err, ShouldBeNil)
+			defer mat.Delete()
+			ret := ToRawData(mat)
+			Convey("Then the data should not share the memory", func() {
+				So(ret.Data, ShouldResemble, raw.Data)
+				ret.Data[0] = 99
+				So(raw.Data[0], ShouldEqual, 1)
+			})
+		})
+
+		Convey("When the data is too short", func() {
+			raw.Data = raw.Data[:11]
+			Convey("Then it should return an error", func() {
+				_, err := raw.ToMatVec3b()
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
+
+func TestRawDataToMat(t *testing.T) {
+	Convey("Given a 1x2 cvmat_32FC1 RawData", t, func() {
+		raw := RawData{
+			Format: TypeCVMATOf(MatDepth32F, 1),
+			Width:  2,
+			Height: 1,
+		}
+		m, err := bridge.NewMatFromFloat32s(1, 2, 1, []float32{0.5, -1.5})
+		So(err, ShouldBeNil)
+		defer m.Delete()
+		converted, err := MatToRawData(m)
+		So(err, ShouldBeNil)
+		raw.Data = converted.Data
+
+		Convey("When convert to Mat", func() {
+			mat, err := raw.ToMat()
+			So(err, ShouldBeNil)
+			defer mat.Delete()
+			Convey("Then the Mat should have the type and values", func() {
+				So(mat.Rows(), ShouldEqual, 1)
+				So(mat.Cols(), ShouldEqual, 2)
+				So(mat.Type(), ShouldEqual, bridge.CvType32FC1)
+				f, err := mat.ToFloat32s()
+				So(err, ShouldBeNil)
+				So(f, ShouldResemble, []float32{0.5, -1.5})
+				_, err = mat.ToUint16s()
+				So(err, ShouldNotBeNil)
+			})
+			Convey("Then it should be converted back to the same RawData", func() {
+				converted, err := MatToRawData(mat)
+				So(err, ShouldBeNil)
+				So(converted, ShouldResemble, raw)
+			})
+		})
+
+		Convey("When the data is too short", func() {
+			raw.Data = raw.Data[:7]
+			Convey("Then it should return an error", func() {
+				_, err := raw.ToMat()
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
+
+func BenchmarkToRawMap(b *testing.B) {
+	raw := newBenchmarkFrame(1920, 1080)
+	mat, err := raw.ToMatVec3b()
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer mat.Delete()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		toRawMap(&mat)
+	}
+}
+
+func TestUnsupportedMatType(t *testing.T) {
+	Convey("Given a Mat type of an unsupported depth", t, func() {
+		// depth 7 is CV_16F of OpenCV 4
+		mt := bridge.MatType(7)
+		Convey("When get its name and element size", func() {
+			Convey("Then they should be unknown instead of panic", func() {
+				So(mt.String(), ShouldEqual, "unknown")
+				So(mt.ElemSize1(), ShouldEqual, 0)
+				So(mt.ElemSize(), ShouldEqual, 0)
+			})
+		})
+	})
+}
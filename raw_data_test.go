@@ -0,0 +1,429 @@
+package opencv
+
+import (
+	"bytes"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"testing"
+)
+
+func TestTypeImageFormat(t *testing.T) {
+	Convey("Given cv::Mat formats", t, func() {
+		Convey("When get 8-bit unsigned formats", func() {
+			Convey("Then they should be named formats", func() {
+				So(TypeCVMATOf(MatDepth8U, 1), ShouldEqual, TypeCVMAT1b)
+				So(TypeCVMATOf(MatDepth8U, 3), ShouldEqual, TypeCVMAT)
+				So(TypeCVMATOf(MatDepth8U, 4), ShouldEqual, TypeCVMAT4b)
+				So(GetTypeImageFormat("cvmat_8UC3"), ShouldEqual, TypeCVMAT)
+			})
+		})
+
+		Convey("When get other formats", func() {
+			f := TypeCVMATOf(MatDepth32F, 1)
+			Convey("Then they should be named with depth and channels", func() {
+				So(f.String(), ShouldEqual, "cvmat_32FC1")
+				So(GetTypeImageFormat("cvmat_32FC1"), ShouldEqual, f)
+				So(GetTypeImageFormat("cvmat_32fc1"), ShouldEqual, f)
+				So(TypeCVMATOf(MatDepth16U, 1).String(), ShouldEqual, "cvmat_16UC1")
+				So(TypeCVMATOf(MatDepth64F, 2).String(), ShouldEqual, "cvmat_64FC2")
+				So(TypeCVMATOf(MatDepth8U, 2).String(), ShouldEqual, "cvmat_8UC2")
+			})
+			Convey("Then they should have depth and channels", func() {
+				d, ch, ok := GetTypeImageFormat("cvmat_16SC3").MatType()
+				So(ok, ShouldBeTrue)
+				So(d, ShouldEqual, MatDepth16S)
+				So(ch, ShouldEqual, 3)
+			})
+		})
+
+		Convey("When get invalid formats", func() {
+			Convey("Then they should be unknown", func() {
+				for _, n := range []string{"cvmat_", "cvmat_32F", "cvmat_32XC1",
+					"cvmat_8UC0", "cvmat_8UCa", "mat_8UC1"} {
+					So(GetTypeImageFormat(n), ShouldEqual, typeUnknownFormat)
+				}
+				_, _, ok := TypeJPEG.MatType()
+				So(ok, ShouldBeFalse)
+			})
+		})
+	})
+}
+
+func TestRawDataToImage(t *testing.T) {
+	Convey("Given a 2x1 RawData", t, func() {
+		Convey("When the format is cvmat", func() {
+			raw := RawData{
+				Format: TypeCVMAT,
+				Width:  2,
+				Height: 1,
+				Data:   []byte{1, 2, 3, 4, 5, 6},
+			}
+			img, err := raw.ToImage()
+			So(err, ShouldBeNil)
+			Convey("Then it should be converted to RGBA image", func() {
+				rgba, ok := img.(*image.RGBA)
+				So(ok, ShouldBeTrue)
+				So(rgba.Bounds(), ShouldResemble, image.Rect(0, 0, 2, 1))
+				So(rgba.Pix, ShouldResemble, []byte{3, 2, 1, 0xFF, 6, 5, 4, 0xFF})
+			})
+		})
+
+		Convey("When the format is cvmat4b", func() {
+			raw := RawData{
+				Format: TypeCVMAT4b,
+				Width:  2,
+				Height: 1,
+				Data:   []byte{1, 2, 3, 4, 5, 6, 7, 8},
+			}
+			img, err := raw.ToImage()
+			So(err, ShouldBeNil)
+			Convey("Then it should be converted to NRGBA image", func() {
+				nrgba, ok := img.(*image.NRGBA)
+				So(ok, ShouldBeTrue)
+				So(nrgba.Bounds(), ShouldResemble, image.Rect(0, 0, 2, 1))
+				So(nrgba.Pix, ShouldResemble, []byte{3, 2, 1, 4, 7, 6, 5, 8})
+			})
+		})
+
+		Convey("When the format is cvmat1b", func() {
+			raw := RawData{
+				Format: TypeCVMAT1b,
+				Width:  2,
+				Height: 1,
+				Data:   []byte{10, 20},
+			}
+			img, err := raw.ToImage()
+			So(err, ShouldBeNil)
+			Convey("Then it should be converted to Gray image", func() {
+				gray, ok := img.(*image.Gray)
+				So(ok, ShouldBeTrue)
+				So(gray.Bounds(), ShouldResemble, image.Rect(0, 0, 2, 1))
+				So(gray.Pix, ShouldResemble, []byte{10, 20})
+			})
+		})
+
+		Convey("When the format is jpeg", func() {
+			src := image.NewGray(image.Rect(0, 0, 2, 1))
+			buf := bytes.NewBuffer([]byte{})
+			So(jpeg.Encode(buf, src, nil), ShouldBeNil)
+			raw := RawData{
+				Format: TypeJPEG,
+				Width:  2,
+				Height: 1,
+				Data:   buf.Bytes(),
+			}
+			img, err := raw.ToImage()
+			So(err, ShouldBeNil)
+			Convey("Then it should be decoded", func() {
+				So(img.Bounds(), ShouldResemble, image.Rect(0, 0, 2, 1))
+			})
+		})
+
+		Convey("When the format is cvmat_16UC1", func() {
+			raw := RawData{
+				Format: TypeCVMATOf(MatDepth16U, 1),
+				Width:  2,
+				Height: 1,
+				Data:   []byte{0x01, 0x02, 0x03, 0x04},
+			}
+			img, err := raw.ToImage()
+			So(err, ShouldBeNil)
+			Convey("Then it should be converted to Gray16 image", func() {
+				gray, ok := img.(*image.Gray16)
+				So(ok, ShouldBeTrue)
+				So(gray.Gray16At(0, 0).Y, ShouldEqual, 0x0201)
+				So(gray.Gray16At(1, 0).Y, ShouldEqual, 0x0403)
+			})
+			Convey("Then it should be converted back from the image", func() {
+				back, err := FromImage(img, raw.Format)
+				So(err, ShouldBeNil)
+				So(back, ShouldResemble, raw)
+			})
+		})
+
+		Convey("When the format is not convertible cv::Mat format", func() {
+			raw := RawData{
+				Format: TypeCVMATOf(MatDepth32F, 1),
+				Width:  1,
+				Height: 1,
+				Data:   []byte{0, 0, 0, 0},
+			}
+			Convey("Then it should return an error", func() {
+				_, err := raw.ToImage()
+				So(err, ShouldNotBeNil)
+			})
+		})
+
+		Convey("When the rows are padded with step", func() {
+			raw := RawData{
+				Format: TypeCVMAT,
+				Width:  1,
+				Height: 2,
+				Step:   5,
+				Data:   []byte{1, 2, 3, 0, 0, 4, 5, 6},
+			}
+			img, err := raw.ToImage()
+			So(err, ShouldBeNil)
+			Convey("Then padding bytes should be skipped", func() {
+				rgba, ok := img.(*image.RGBA)
+				So(ok, ShouldBeTrue)
+				So(rgba.Pix, ShouldResemble, []byte{3, 2, 1, 0xFF, 6, 5, 4, 0xFF})
+			})
+		})
+
+		Convey("When the step is shorter than a row", func() {
+			raw := RawData{
+				Format: TypeCVMAT,
+				Width:  2,
+				Height: 1,
+				Step:   3,
+				Data:   []byte{1, 2, 3, 4, 5, 6},
+			}
+			Convey("Then it should return an error", func() {
+				_, err := raw.ToImage()
+				So(err, ShouldNotBeNil)
+			})
+		})
+
+		Convey("When the data is shorter than the step requires", func() {
+			raw := RawData{
+				Format: TypeCVMAT1b,
+				Width:  2,
+				Height: 2,
+				Step:   4,
+				Data:   []byte{1, 2, 0, 0, 3},
+			}
+			Convey("Then it should return an error", func() {
+				_, err := raw.ToImage()
+				So(err, ShouldNotBeNil)
+			})
+		})
+
+		Convey("When the data is shorter than the size", func() {
+			raw := RawData{
+				Format: TypeCVMAT,
+				Width:  2,
+				Height: 1,
+				Data:   []byte{1, 2, 3},
+			}
+			Convey("Then it should return an error", func() {
+				_, err := raw.ToImage()
+				So(err, ShouldNotBeNil)
+			})
+		})
+
+		Convey("When the format is unknown", func() {
+			raw := RawData{
+				Width:  2,
+				Height: 1,
+				Data:   []byte{1, 2, 3, 4, 5, 6},
+			}
+			Convey("Then it should return an error", func() {
+				_, err := raw.ToImage()
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
+
+func TestConvertMapToRawData(t *testing.T) {
+	Convey("Given a RawData map", t, func() {
+		m := data.Map{
+			"format": data.String("cvmat"),
+			"width":  data.Int(1),
+			"height": data.Int(2),
+			"image":  data.Blob([]byte{1, 2, 3, 0, 4, 5, 6}),
+		}
+		Convey("When the map has step", func() {
+			m["step"] = data.Int(4)
+			raw, err := ConvertMapToRawData(m)
+			So(err, ShouldBeNil)
+			Convey("Then RawData should have the step", func() {
+				So(raw.Step, ShouldEqual, 4)
+			})
+			Convey("Then converted map should have the step", func() {
+				So(raw.ConvertToDataMap(), ShouldResemble, m)
+			})
+		})
+
+		Convey("When the map does not have step", func() {
+			raw, err := ConvertMapToRawData(m)
+			So(err, ShouldBeNil)
+			Convey("Then RawData should be tightly packed", func() {
+				So(raw.Step, ShouldEqual, 0)
+				So(raw.stride(), ShouldEqual, 3)
+			})
+			Convey("Then converted map should not have step", func() {
+				_, ok := raw.ConvertToDataMap()["step"]
+				So(ok, ShouldBeFalse)
+			})
+		})
+
+		Convey("When the map has invalid step", func() {
+			m["step"] = data.String("a")
+			Convey("Then it should return an error", func() {
+				_, err := ConvertMapToRawData(m)
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
+
+func TestRawDataForegroundRatio(t *testing.T) {
+	Convey("Given a cvmat1b mask which has padding bytes", t, func() {
+		raw := RawData{
+			Format: TypeCVMAT1b,
+			Width:  2,
+			Height: 2,
+			Step:   3,
+			Data:   []byte{255, 127, 255, 0, 255},
+		}
+		Convey("When compute the foreground ratio", func() {
+			ratio := raw.foregroundRatio()
+			Convey("Then it should count only 255 pixels", func() {
+				So(ratio, ShouldEqual, 0.5)
+			})
+		})
+		Convey("When the mask is empty", func() {
+			raw = RawData{Format: TypeCVMAT1b}
+			Convey("Then the ratio should be zero", func() {
+				So(raw.foregroundRatio(), ShouldEqual, 0)
+			})
+		})
+	})
+}
+
+func TestFromImage(t *testing.T) {
+	Convey("Given a 2x1 NRGBA image which has offset bounds", t, func() {
+		img := image.NewNRGBA(image.Rect(1, 1, 3, 2))
+		img.SetNRGBA(1, 1, color.NRGBA{R: 10, G: 20, B: 30, A: 0xFF})
+		img.SetNRGBA(2, 1, color.NRGBA{R: 40, G: 50, B: 60, A: 0xFF})
+
+		Convey("When convert to cvmat", func() {
+			raw, err := FromImage(img, TypeCVMAT)
+			So(err, ShouldBeNil)
+			Convey("Then it should have BGR data", func() {
+				So(raw.Format, ShouldEqual, TypeCVMAT)
+				So(raw.Width, ShouldEqual, 2)
+				So(raw.Height, ShouldEqual, 1)
+				So(raw.Data, ShouldResemble, []byte{30, 20, 10, 60, 50, 40})
+			})
+		})
+
+		Convey("When convert to cvmat4b", func() {
+			raw, err := FromImage(img, TypeCVMAT4b)
+			So(err, ShouldBeNil)
+			Convey("Then it should have BGRA data", func() {
+				So(raw.Format, ShouldEqual, TypeCVMAT4b)
+				So(raw.Data, ShouldResemble, []byte{30, 20, 10, 0xFF, 60, 50, 40, 0xFF})
+			})
+		})
+
+		Convey("When convert to cvmat1b", func() {
+			raw, err := FromImage(img, TypeCVMAT1b)
+			So(err, ShouldBeNil)
+			Convey("Then it should have gray data", func() {
+				So(raw.Format, ShouldEqual, TypeCVMAT1b)
+				So(len(raw.Data), ShouldEqual, 2)
+				So(raw.Data[0], ShouldBeLessThan, raw.Data[1])
+			})
+		})
+
+		Convey("When convert to jpeg", func() {
+			raw, err := FromImage(img, TypeJPEG)
+			So(err, ShouldBeNil)
+			Convey("Then it should be able to be decoded", func() {
+				So(raw.Format, ShouldEqual, TypeJPEG)
+				dec, err := raw.ToImage()
+				So(err, ShouldBeNil)
+				So(dec.Bounds(), ShouldResemble, image.Rect(0, 0, 2, 1))
+			})
+		})
+
+		Convey("When convert to unknown format", func() {
+			Convey("Then it should return an error", func() {
+				_, err := FromImage(img, typeUnknownFormat)
+				So(err, ShouldNotBeNil)
+			})
+		})
+
+		Convey("When convert to a format and convert back to image", func() {
+			for _, f := range []TypeImageFormat{TypeCVMAT, TypeCVMAT4b} {
+				raw, err := FromImage(img, f)
+				So(err, ShouldBeNil)
+				back, err := raw.ToImage()
+				So(err, ShouldBeNil)
+				Convey("Then pixels should be kept with "+f.String(), func() {
+					r, g, b, a := back.At(1, 0).RGBA()
+					So([]uint32{r >> 8, g >> 8, b >> 8, a >> 8}, ShouldResemble,
+						[]uint32{40, 50, 60, 0xFF})
+				})
+			}
+		})
+	})
+}
+
+func TestRawDataToJpegData(t *testing.T) {
+	Convey("Given a 2x2 cvmat4b RawData", t, func() {
+		raw := RawData{
+			Format: TypeCVMAT4b,
+			Width:  2,
+			Height: 2,
+			Data: []byte{
+				0, 0, 0xFF, 0xFF, 0, 0, 0xFF, 0xFF,
+				0, 0, 0xFF, 0xFF, 0, 0, 0xFF, 0xFF,
+			},
+		}
+		Convey("When convert to JPEG", func() {
+			b, err := raw.ToJpegData(100)
+			So(err, ShouldBeNil)
+			Convey("Then every pixel should be red", func() {
+				img, err := jpeg.Decode(bytes.NewReader(b))
+				So(err, ShouldBeNil)
+				for y := 0; y < 2; y++ {
+					for x := 0; x < 2; x++ {
+						r, g, b, _ := img.At(x, y).RGBA()
+						So(r>>8, ShouldBeGreaterThan, 0xF0)
+						So(g>>8, ShouldBeLessThan, 0x10)
+						So(b>>8, ShouldBeLessThan, 0x10)
+					}
+				}
+			})
+		})
+	})
+}
+
+func newBenchmarkFrame(width int, height int) RawData {
+	return RawData{
+		Format: TypeCVMAT,
+		Width:  width,
+		Height: height,
+		Data:   make([]byte, width*height*3),
+	}
+}
+
+func BenchmarkConvertMapToRawData(b *testing.B) {
+	raw := newBenchmarkFrame(1920, 1080)
+	m := raw.ConvertToDataMap()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := ConvertMapToRawData(m); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkToJpegData(b *testing.B) {
+	raw := newBenchmarkFrame(1920, 1080)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := raw.ToJpegData(50); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
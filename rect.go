@@ -0,0 +1,434 @@
+package opencv
+
+import (
+	"fmt"
+	"gopkg.in/sensorbee/opencv.v0/bridge"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"sort"
+)
+
+var (
+	xPath = data.MustCompilePath("x")
+	yPath = data.MustCompilePath("y")
+)
+
+func convertToBridgeRects(rects data.Array) ([]bridge.Rect, error) {
+	brRects := make([]bridge.Rect, len(rects))
+	for i, r := range rects {
+		rect, err := convertToBridgeRect(r)
+		if err != nil {
+			return nil, err
+		}
+		brRects[i] = rect
+	}
+	return brRects, nil
+}
+
+// convertToBridgeRect converts a map which has "x", "y", "width" and "height"
+// to a rectangle.
+func convertToBridgeRect(r data.Value) (bridge.Rect, error) {
+	rmap, err := data.AsMap(r)
+	if err != nil {
+		return bridge.Rect{}, err
+	}
+	var x int64
+	if xv, err := rmap.Get(xPath); err != nil {
+		return bridge.Rect{}, err
+	} else if x, err = data.ToInt(xv); err != nil {
+		return bridge.Rect{}, err
+	}
+	var y int64
+	if yv, err := rmap.Get(yPath); err != nil {
+		return bridge.Rect{}, err
+	} else if y, err = data.ToInt(yv); err != nil {
+		return bridge.Rect{}, err
+	}
+	var width int64
+	if wv, err := rmap.Get(widthPath); err != nil {
+		return bridge.Rect{}, err
+	} else if width, err = data.ToInt(wv); err != nil {
+		return bridge.Rect{}, err
+	}
+	var height int64
+	if hv, err := rmap.Get(heightPath); err != nil {
+		return bridge.Rect{}, err
+	} else if height, err = data.ToInt(hv); err != nil {
+		return bridge.Rect{}, err
+	}
+	return bridge.Rect{
+		X:      int(x),
+		Y:      int(y),
+		Width:  int(width),
+		Height: int(height),
+	}, nil
+}
+
+// convertToBridgePolygon converts an array of maps which have "x" and "y" to
+// a polygon. The polygon is required to have 3 points at least.
+func convertToBridgePolygon(points data.Array) ([]bridge.Point, error) {
+	if len(points) < 3 {
+		return nil, fmt.Errorf("polygon requires 3 points at least: %v",
+			len(points))
+	}
+	polygon := make([]bridge.Point, len(points))
+	for i, p := range points {
+		pmap, err := data.AsMap(p)
+		if err != nil {
+			return nil, err
+		}
+		var x int64
+		if xv, err := pmap.Get(xPath); err != nil {
+			return nil, err
+		} else if x, err = data.ToInt(xv); err != nil {
+			return nil, err
+		}
+		var y int64
+		if yv, err := pmap.Get(yPath); err != nil {
+			return nil, err
+		} else if y, err = data.ToInt(yv); err != nil {
+			return nil, err
+		}
+		polygon[i] = bridge.Point{X: int(x), Y: int(y)}
+	}
+	return polygon, nil
+}
+
+// convertFromBridgeRect converts a rectangle to a map which has "x", "y",
+// "width" and "height".
+func convertFromBridgeRect(r bridge.Rect) data.Map {
+	return data.Map{
+		"x":      data.Int(r.X),
+		"y":      data.Int(r.Y),
+		"width":  data.Int(r.Width),
+		"height": data.Int(r.Height),
+	}
+}
+
+// NonMaximumSuppression drops rectangles overlapped with a higher scored
+// rectangle, e.g. duplicated detections of cascade classifiers and HOG
+// descriptors.
+//
+// rects: an array of maps which have "x", "y", "width" and "height". Other
+// fields are kept as they are.
+//
+// iouThreshold: rectangles whose intersection over union with a higher
+// scored one is larger than it are dropped, from 0 to 1. 1 keeps all.
+//
+// scoreField: optional field name of scores, e.g. "weight" of
+// opencv_hog_detect or "confidence" of opencv_dnn_detect. Default is empty,
+// larger rectangles are scored higher.
+//
+// Returns kept rectangles in descending order of scores.
+func NonMaximumSuppression(rects data.Array, iouThreshold float64,
+	scoreField ...string) (data.Array, error) {
+	if len(scoreField) > 1 {
+		return nil, fmt.Errorf("too many score fields: %v", len(scoreField))
+	}
+	if iouThreshold < 0 || iouThreshold > 1 {
+		return nil, fmt.Errorf("iou_threshold must be in [0, 1]: %v",
+			iouThreshold)
+	}
+	var scorePath data.Path
+	if len(scoreField) == 1 && scoreField[0] != "" {
+		p, err := data.CompilePath(scoreField[0])
+		if err != nil {
+			return nil, err
+		}
+		scorePath = p
+	}
+
+	brRects, err := convertToBridgeRects(rects)
+	if err != nil {
+		return nil, err
+	}
+	scores := make([]float64, len(rects))
+	for i, r := range brRects {
+		if scorePath == nil {
+			scores[i] = float64(rectArea(r))
+			continue
+		}
+		m, err := data.AsMap(rects[i])
+		if err != nil {
+			return nil, err
+		}
+		v, err := m.Get(scorePath)
+		if err != nil {
+			return nil, err
+		}
+		if scores[i], err = data.ToFloat(v); err != nil {
+			return nil, err
+		}
+	}
+
+	kept := suppressRects(brRects, scores, iouThreshold)
+	ret := make(data.Array, len(kept))
+	for i, k := range kept {
+		ret[i] = rects[k]
+	}
+	return ret, nil
+}
+
+// suppressRects returns indices of rectangles which are not overlapped with a
+// higher scored rectangle by IoU larger than threshold, in descending order
+// of scores.
+func suppressRects(rects []bridge.Rect, scores []float64,
+	threshold float64) []int {
+	order := make([]int, len(rects))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return scores[order[i]] > scores[order[j]]
+	})
+	kept := []int{}
+	for _, i := range order {
+		suppressed := false
+		for _, k := range kept {
+			if rectIoU(rects[k], rects[i]) > threshold {
+				suppressed = true
+				break
+			}
+		}
+		if !suppressed {
+			kept = append(kept, i)
+		}
+	}
+	return kept
+}
+
+// Geometry UDFs of rectangle maps, which have "x", "y", "width" and
+// "height". Rectangles returned by UDFs transforming a rectangle keep other
+// fields of the given map, e.g. "weight".
+
+// RectIoU returns intersection over union of two rectangles, which is from 0
+// (not overlapped) to 1 (same rectangles).
+func RectIoU(a, b data.Map) (float64, error) {
+	ra, rb, err := convertToBridgeRectPair(a, b)
+	if err != nil {
+		return 0, err
+	}
+	return rectIoU(ra, rb), nil
+}
+
+// RectOverlap returns the ratio of the area of a which is overlapped with b,
+// e.g. how much of a face is in a zone, from 0 to 1. It is 0 when a is empty.
+func RectOverlap(a, b data.Map) (float64, error) {
+	ra, rb, err := convertToBridgeRectPair(a, b)
+	if err != nil {
+		return 0, err
+	}
+	area := rectArea(ra)
+	if area == 0 {
+		return 0, nil
+	}
+	return float64(rectArea(intersectRects(ra, rb))) / float64(area), nil
+}
+
+// RectIntersection returns the intersection of two rectangles. It is a
+// rectangle of zero size at the origin when they do not overlap.
+func RectIntersection(a, b data.Map) (data.Map, error) {
+	ra, rb, err := convertToBridgeRectPair(a, b)
+	if err != nil {
+		return nil, err
+	}
+	return convertFromBridgeRect(intersectRects(ra, rb)), nil
+}
+
+// RectUnion returns the smallest rectangle which contains both rectangles.
+func RectUnion(a, b data.Map) (data.Map, error) {
+	ra, rb, err := convertToBridgeRectPair(a, b)
+	if err != nil {
+		return nil, err
+	}
+	return convertFromBridgeRect(unionRects(ra, rb)), nil
+}
+
+// RectArea returns the area of the rectangle. It is 0 when the rectangle is
+// empty, i.e. its width or height is not positive.
+func RectArea(rect data.Map) (int, error) {
+	r, err := convertToBridgeRect(rect)
+	if err != nil {
+		return 0, err
+	}
+	return rectArea(r), nil
+}
+
+// RectCenter returns the center of the rectangle as a map which has "x" and
+// "y".
+func RectCenter(rect data.Map) (data.Map, error) {
+	r, err := convertToBridgeRect(rect)
+	if err != nil {
+		return nil, err
+	}
+	x, y := rectCenter(r)
+	return data.Map{
+		"x": data.Float(x),
+		"y": data.Float(y),
+	}, nil
+}
+
+// ScaleRect scales the rectangle by the factor keeping its center, e.g. 1.5
+// enlarges a face rectangle to include the hair.
+func ScaleRect(rect data.Map, factor float64) (data.Map, error) {
+	if factor < 0 {
+		return nil, fmt.Errorf("factor must not be negative: %v", factor)
+	}
+	r, err := convertToBridgeRect(rect)
+	if err != nil {
+		return nil, err
+	}
+	x, y := rectCenter(r)
+	w := float64(r.Width) * factor
+	h := float64(r.Height) * factor
+	return withBridgeRect(rect, bridge.Rect{
+		X:      roundInt(x - w/2),
+		Y:      roundInt(y - h/2),
+		Width:  roundInt(w),
+		Height: roundInt(h),
+	}), nil
+}
+
+// PadRect adds the padding in pixels to each side of the rectangle. A
+// negative padding shrinks the rectangle, its size does not become less than
+// zero.
+func PadRect(rect data.Map, padding int) (data.Map, error) {
+	r, err := convertToBridgeRect(rect)
+	if err != nil {
+		return nil, err
+	}
+	r.X -= padding
+	r.Y -= padding
+	r.Width = maxInt(r.Width+2*padding, 0)
+	r.Height = maxInt(r.Height+2*padding, 0)
+	return withBridgeRect(rect, r), nil
+}
+
+// ClampRect returns the part of the rectangle inside an image of the width
+// and the height. It is a rectangle of zero size at the origin when the
+// rectangle is out of the image.
+func ClampRect(rect data.Map, width, height int) (data.Map, error) {
+	r, err := convertToBridgeRect(rect)
+	if err != nil {
+		return nil, err
+	}
+	return withBridgeRect(rect, clampRect(r, width, height)), nil
+}
+
+// RectContains returns true when the point, a map which has "x" and "y", is
+// in the rectangle. As same as OpenCV, the left and the top edges are in the
+// rectangle and the right and the bottom edges are not.
+func RectContains(rect data.Map, point data.Map) (bool, error) {
+	r, err := convertToBridgeRect(rect)
+	if err != nil {
+		return false, err
+	}
+	var x float64
+	if xv, err := point.Get(xPath); err != nil {
+		return false, err
+	} else if x, err = data.ToFloat(xv); err != nil {
+		return false, err
+	}
+	var y float64
+	if yv, err := point.Get(yPath); err != nil {
+		return false, err
+	} else if y, err = data.ToFloat(yv); err != nil {
+		return false, err
+	}
+	return float64(r.X) <= x && x < float64(r.X+r.Width) &&
+		float64(r.Y) <= y && y < float64(r.Y+r.Height), nil
+}
+
+func convertToBridgeRectPair(a, b data.Map) (bridge.Rect, bridge.Rect,
+	error) {
+	ra, err := convertToBridgeRect(a)
+	if err != nil {
+		return bridge.Rect{}, bridge.Rect{}, err
+	}
+	rb, err := convertToBridgeRect(b)
+	if err != nil {
+		return bridge.Rect{}, bridge.Rect{}, err
+	}
+	return ra, rb, nil
+}
+
+// withBridgeRect returns a copy of the rectangle map whose "x", "y", "width"
+// and "height" are replaced with r.
+func withBridgeRect(rect data.Map, r bridge.Rect) data.Map {
+	m := rect.Copy()
+	for k, v := range convertFromBridgeRect(r) {
+		m[k] = v
+	}
+	return m
+}
+
+// intersectRects returns the intersection of two rectangles. The rectangle is
+// empty (zero size) when they do not overlap.
+func intersectRects(a, b bridge.Rect) bridge.Rect {
+	x1, y1 := maxInt(a.X, b.X), maxInt(a.Y, b.Y)
+	x2 := minInt(a.X+a.Width, b.X+b.Width)
+	y2 := minInt(a.Y+a.Height, b.Y+b.Height)
+	if x2 <= x1 || y2 <= y1 {
+		return bridge.Rect{}
+	}
+	return bridge.Rect{X: x1, Y: y1, Width: x2 - x1, Height: y2 - y1}
+}
+
+// rectIoU returns intersection over union of two rectangles, which is from 0
+// (not overlapped) to 1 (same rectangles).
+func rectIoU(a, b bridge.Rect) float64 {
+	i := intersectRects(a, b)
+	inter := rectArea(i)
+	union := rectArea(a) + rectArea(b) - inter
+	if union <= 0 {
+		return 0
+	}
+	return float64(inter) / float64(union)
+}
+
+// clampRect returns the part of the rectangle inside an image of the size.
+func clampRect(r bridge.Rect, width, height int) bridge.Rect {
+	return intersectRects(r, bridge.Rect{Width: width, Height: height})
+}
+
+// unionRects returns the smallest rectangle which contains both rectangles.
+// An empty rectangle is ignored.
+func unionRects(a, b bridge.Rect) bridge.Rect {
+	if a.Width <= 0 || a.Height <= 0 {
+		return b
+	}
+	if b.Width <= 0 || b.Height <= 0 {
+		return a
+	}
+	x1, y1 := minInt(a.X, b.X), minInt(a.Y, b.Y)
+	x2 := maxInt(a.X+a.Width, b.X+b.Width)
+	y2 := maxInt(a.Y+a.Height, b.Y+b.Height)
+	return bridge.Rect{X: x1, Y: y1, Width: x2 - x1, Height: y2 - y1}
+}
+
+// rectArea returns the area of the rectangle, which is 0 when the width or
+// the height is not positive.
+func rectArea(r bridge.Rect) int {
+	if r.Width <= 0 || r.Height <= 0 {
+		return 0
+	}
+	return r.Width * r.Height
+}
+
+// rectCenter returns the center of the rectangle.
+func rectCenter(r bridge.Rect) (float64, float64) {
+	return float64(r.X) + float64(r.Width)/2, float64(r.Y) + float64(r.Height)/2
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,55 @@
+//go:build cgo
+// +build cgo
+
+package opencv
+
+import (
+	"fmt"
+	"gopkg.in/sensorbee/opencv.v0/bridge"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+)
+
+// GroupRects clusters similar rectangles by OpenCV's groupRectangles, which
+// is an alternative of NonMaximumSuppression for rectangles without scores.
+//
+// rects: an array of maps which have "x", "y", "width" and "height".
+//
+// groupThreshold: clusters which have groupThreshold or fewer rectangles are
+// dropped. 0 returns rects without grouping.
+//
+// eps: optional relative difference of sides to merge rectangles. Default is
+// 0.2.
+//
+// Returns an array of the average rectangles of clusters, each map also has
+// "count", the number of rectangles in the cluster.
+func GroupRects(rects data.Array, groupThreshold int, eps ...float64) (
+	data.Array, error) {
+	if len(eps) > 1 {
+		return nil, fmt.Errorf("too many eps: %v", len(eps))
+	}
+	if groupThreshold < 0 {
+		return nil, fmt.Errorf("group_threshold must not be negative: %v",
+			groupThreshold)
+	}
+	e := 0.2
+	if len(eps) == 1 {
+		if e = eps[0]; e < 0 {
+			return nil, fmt.Errorf("eps must not be negative: %v", e)
+		}
+	}
+	brRects, err := convertToBridgeRects(rects)
+	if err != nil {
+		return nil, err
+	}
+	grouped, counts, err := bridge.GroupRectangles(brRects, groupThreshold, e)
+	if err != nil {
+		return nil, err
+	}
+	ret := make(data.Array, len(grouped))
+	for i, r := range grouped {
+		m := convertFromBridgeRect(r)
+		m["count"] = data.Int(counts[i])
+		ret[i] = m
+	}
+	return ret, nil
+}
@@ -0,0 +1,37 @@
+//go:build cgo
+// +build cgo
+
+package opencv
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"testing"
+)
+
+func TestGroupRects(t *testing.T) {
+	Convey("Given overlapped rectangles and a separated one", t, func() {
+		rects := data.Array{
+			rectMap(10, 10, 20, 20),
+			rectMap(11, 10, 20, 20),
+			rectMap(10, 11, 20, 20),
+			rectMap(100, 100, 20, 20),
+		}
+		Convey("When group them", func() {
+			ret, err := GroupRects(rects, 1)
+			Convey("Then it should return the cluster of overlapped ones", func() {
+				So(err, ShouldBeNil)
+				So(ret, ShouldHaveLength, 1)
+				r := ret[0].(data.Map)
+				So(r["count"], ShouldEqual, data.Int(3))
+				So(r["width"], ShouldEqual, data.Int(20))
+			})
+		})
+		Convey("When group them with an invalid threshold", func() {
+			_, err := GroupRects(rects, -1)
+			Convey("Then it should return an error", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
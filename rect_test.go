@@ -0,0 +1,254 @@
+package opencv
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/opencv.v0/bridge"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"testing"
+)
+
+func TestConvertToBridgeRect(t *testing.T) {
+	Convey("Given a rectangle map", t, func() {
+		r := data.Map{
+			"x":      data.Int(1),
+			"y":      data.Int(2),
+			"width":  data.Int(3),
+			"height": data.Float(4),
+		}
+		Convey("When convert to a bridge rectangle", func() {
+			rect, err := convertToBridgeRect(r)
+			Convey("Then it should have the values", func() {
+				So(err, ShouldBeNil)
+				So(rect, ShouldResemble, bridge.Rect{X: 1, Y: 2, Width: 3, Height: 4})
+			})
+			Convey("Then it should be converted back to the same map", func() {
+				So(convertFromBridgeRect(rect), ShouldResemble, data.Map{
+					"x":      data.Int(1),
+					"y":      data.Int(2),
+					"width":  data.Int(3),
+					"height": data.Int(4),
+				})
+			})
+		})
+
+		Convey("When a value is missing", func() {
+			delete(r, "height")
+			_, err := convertToBridgeRect(r)
+			Convey("Then it should return an error", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
+
+func TestConvertToBridgePolygon(t *testing.T) {
+	Convey("Given an array of point maps", t, func() {
+		points := data.Array{
+			data.Map{"x": data.Int(0), "y": data.Int(0)},
+			data.Map{"x": data.Int(10), "y": data.Int(0)},
+			data.Map{"x": data.Int(10), "y": data.Int(20)},
+		}
+		Convey("When convert to a polygon", func() {
+			polygon, err := convertToBridgePolygon(points)
+			Convey("Then it should have the points", func() {
+				So(err, ShouldBeNil)
+				So(polygon, ShouldResemble, []bridge.Point{
+					{X: 0, Y: 0}, {X: 10, Y: 0}, {X: 10, Y: 20},
+				})
+			})
+		})
+
+		Convey("When the array has only 2 points", func() {
+			_, err := convertToBridgePolygon(points[:2])
+			Convey("Then it should return an error", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+
+		Convey("When a point is not a map", func() {
+			points[1] = data.Int(1)
+			_, err := convertToBridgePolygon(points)
+			Convey("Then it should return an error", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
+
+func TestRectIoU(t *testing.T) {
+	Convey("Given two overlapped rectangles", t, func() {
+		a := bridge.Rect{X: 0, Y: 0, Width: 10, Height: 10}
+		b := bridge.Rect{X: 5, Y: 0, Width: 10, Height: 10}
+		Convey("When compute the intersection and IoU", func() {
+			Convey("Then they should be the overlapped part", func() {
+				So(intersectRects(a, b), ShouldResemble,
+					bridge.Rect{X: 5, Y: 0, Width: 5, Height: 10})
+				So(rectIoU(a, b), ShouldAlmostEqual, 50.0/150.0)
+			})
+		})
+		Convey("When they are not overlapped", func() {
+			b.X = 20
+			Convey("Then IoU should be zero", func() {
+				So(intersectRects(a, b), ShouldResemble, bridge.Rect{})
+				So(rectIoU(a, b), ShouldEqual, 0)
+			})
+		})
+		Convey("When clamp a rectangle to an image", func() {
+			Convey("Then it should be inside the image", func() {
+				So(clampRect(b, 12, 8), ShouldResemble,
+					bridge.Rect{X: 5, Y: 0, Width: 7, Height: 8})
+			})
+		})
+	})
+}
+
+func TestNonMaximumSuppression(t *testing.T) {
+	Convey("Given overlapped rectangles which have weights", t, func() {
+		rects := data.Array{
+			data.Map{"x": data.Int(0), "y": data.Int(0), "width": data.Int(10),
+				"height": data.Int(10), "weight": data.Float(1)},
+			data.Map{"x": data.Int(1), "y": data.Int(1), "width": data.Int(10),
+				"height": data.Int(10), "weight": data.Float(2)},
+			data.Map{"x": data.Int(50), "y": data.Int(50), "width": data.Int(5),
+				"height": data.Int(5), "weight": data.Float(0.5)},
+		}
+		Convey("When suppress them by weights", func() {
+			ret, err := NonMaximumSuppression(rects, 0.3, "weight")
+			Convey("Then it should keep the most weighted one of overlapped", func() {
+				So(err, ShouldBeNil)
+				So(ret, ShouldResemble, data.Array{rects[1], rects[2]})
+			})
+		})
+		Convey("When suppress them by areas", func() {
+			ret, err := NonMaximumSuppression(rects, 0.3)
+			Convey("Then it should keep the first of the same areas", func() {
+				So(err, ShouldBeNil)
+				So(ret, ShouldResemble, data.Array{rects[0], rects[2]})
+			})
+		})
+		Convey("When suppress them with threshold 1", func() {
+			ret, err := NonMaximumSuppression(rects, 1, "weight")
+			Convey("Then it should keep all in order of weights", func() {
+				So(err, ShouldBeNil)
+				So(ret, ShouldResemble, data.Array{rects[1], rects[0], rects[2]})
+			})
+		})
+		Convey("When suppress them by a missing field", func() {
+			_, err := NonMaximumSuppression(rects, 0.3, "confidence")
+			Convey("Then it should return an error", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+		Convey("When suppress them with an invalid threshold", func() {
+			_, err := NonMaximumSuppression(rects, 1.5)
+			Convey("Then it should return an error", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
+
+func TestRectGeometry(t *testing.T) {
+	Convey("Given two overlapped rectangles", t, func() {
+		a := rectMap(0, 0, 10, 10)
+		b := data.Map{
+			"x": data.Int(5), "y": data.Int(5),
+			"width": data.Int(10), "height": data.Int(10),
+			"weight": data.Float(1.5),
+		}
+		Convey("When compute their IoU and overlap", func() {
+			iou, err := RectIoU(a, b)
+			So(err, ShouldBeNil)
+			overlap, err := RectOverlap(a, b)
+			So(err, ShouldBeNil)
+			Convey("Then they should be ratios of the intersection", func() {
+				So(iou, ShouldAlmostEqual, 25.0/175)
+				So(overlap, ShouldAlmostEqual, 0.25)
+			})
+		})
+		Convey("When compute their intersection and union", func() {
+			i, err := RectIntersection(a, b)
+			So(err, ShouldBeNil)
+			u, err := RectUnion(a, b)
+			So(err, ShouldBeNil)
+			Convey("Then they should be rectangles", func() {
+				So(i, ShouldResemble, rectMap(5, 5, 5, 5))
+				So(u, ShouldResemble, rectMap(0, 0, 15, 15))
+			})
+		})
+		Convey("When compute the area and the center", func() {
+			area, err := RectArea(b)
+			So(err, ShouldBeNil)
+			c, err := RectCenter(b)
+			So(err, ShouldBeNil)
+			Convey("Then they should be computed", func() {
+				So(area, ShouldEqual, 100)
+				So(c, ShouldResemble, data.Map{"x": data.Float(10), "y": data.Float(10)})
+			})
+		})
+		Convey("When scale, pad and clamp the rectangle", func() {
+			s, err := ScaleRect(b, 1.5)
+			So(err, ShouldBeNil)
+			p, err := PadRect(b, -6)
+			So(err, ShouldBeNil)
+			c, err := ClampRect(b, 12, 8)
+			So(err, ShouldBeNil)
+			Convey("Then they should keep other fields", func() {
+				So(s["weight"], ShouldEqual, data.Float(1.5))
+				So(p["weight"], ShouldEqual, data.Float(1.5))
+				So(c["weight"], ShouldEqual, data.Float(1.5))
+				So(b["x"], ShouldEqual, data.Int(5))
+			})
+			Convey("Then they should be transformed", func() {
+				So(s["x"], ShouldEqual, data.Int(3))
+				So(s["width"], ShouldEqual, data.Int(15))
+				So(p["x"], ShouldEqual, data.Int(11))
+				So(p["width"], ShouldEqual, data.Int(0))
+				So(c["width"], ShouldEqual, data.Int(7))
+				So(c["height"], ShouldEqual, data.Int(3))
+			})
+		})
+		Convey("When compute areas of rectangles which have negative sizes", func() {
+			Convey("Then they should be empty", func() {
+				for _, r := range []data.Map{
+					rectMap(0, 0, -10, 10),
+					rectMap(0, 0, 10, -10),
+					rectMap(0, 0, -10, -10),
+				} {
+					area, err := RectArea(r)
+					So(err, ShouldBeNil)
+					So(area, ShouldEqual, 0)
+					overlap, err := RectOverlap(r, a)
+					So(err, ShouldBeNil)
+					So(overlap, ShouldEqual, 0)
+					iou, err := RectIoU(r, a)
+					So(err, ShouldBeNil)
+					So(iou, ShouldEqual, 0)
+				}
+			})
+		})
+		Convey("When scale the rectangle by a negative factor", func() {
+			_, err := ScaleRect(b, -1)
+			Convey("Then it should return an error", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+		Convey("When check points are in the rectangle", func() {
+			Convey("Then edges should be handled as same as OpenCV", func() {
+				for _, c := range []struct {
+					x, y     data.Value
+					expected bool
+				}{
+					{data.Int(5), data.Int(5), true},
+					{data.Float(14.5), data.Float(9), true},
+					{data.Int(15), data.Int(9), false},
+					{data.Int(9), data.Int(4), false},
+				} {
+					in, err := RectContains(b, data.Map{"x": c.x, "y": c.y})
+					So(err, ShouldBeNil)
+					So(in, ShouldEqual, c.expected)
+				}
+			})
+		})
+	})
+}
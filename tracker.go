@@ -0,0 +1,294 @@
+//go:build cgo
+// +build cgo
+
+package opencv
+
+import (
+	"fmt"
+	"gopkg.in/sensorbee/opencv.v0/bridge"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"strings"
+	"sync"
+)
+
+// NewTracker returns tracker state, which tracks single objects initialized
+// by rectangles, e.g. detected by DetectMultiScale, in following frames.
+// Detection can be run occasionally and tracking in between.
+//
+// algorithm: "kcf" (Kernelized Correlation Filters), "csrt" (Discriminative
+// Correlation Filter with Channel and Spatial Reliability) or "mil" (Multiple
+// Instance Learning). KCF and CSRT require the tracking module of
+// opencv_contrib, CSRT requires OpenCV 3.4.1 or later, and MIL is built in
+// since OpenCV 4.5.1. Default is the first available one in that order, e.g.
+// "mil" of OpenCV 4.5.1 or later without opencv_contrib.
+//
+// max_age: The number of frames of all keys after which the object of a key
+// which is not given is discarded, required to be larger than the number of
+// keys. Default is 300.
+func NewTracker(ctx *core.Context, params data.Map) (core.SharedState, error) {
+	available := bridge.AvailableTrackers()
+	if len(available) == 0 {
+		return nil, fmt.Errorf(
+			"tracker requires the tracking module of opencv_contrib")
+	}
+	algorithm := available[0]
+	if v, err := params.Get(algorithmPath); err == nil {
+		if algorithm, err = data.AsString(v); err != nil {
+			return nil, err
+		}
+	}
+	algorithm = strings.ToUpper(algorithm)
+	found := false
+	for _, a := range available {
+		if a == algorithm {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf(
+			"'%v' algorithm is not available, available algorithms are: %v",
+			strings.ToLower(algorithm),
+			strings.ToLower(strings.Join(available, ", ")))
+	}
+	maxAge := int64(300)
+	if v, err := params.Get(maxAgePath); err == nil {
+		if maxAge, err = data.AsInt(v); err != nil {
+			return nil, err
+		}
+		if maxAge < 1 {
+			return nil, fmt.Errorf("max_age must be positive: %v", maxAge)
+		}
+	}
+	return &tracker{
+		algorithm: algorithm,
+		tracks:    map[string]*objectTrack{},
+		keys:      newIdleKeys(int(maxAge)),
+	}, nil
+}
+
+// tracker has a cv::Tracker of each key.
+type tracker struct {
+	algorithm string
+
+	m      sync.Mutex
+	tracks map[string]*objectTrack
+	keys   *idleKeys
+}
+
+// objectTrack is the tracked object of a key. Frames of the same key are
+// tracked in order by the mutex, frames of different keys are tracked
+// concurrently.
+type objectTrack struct {
+	m sync.Mutex
+	t *bridge.Tracker
+	// width and height are the frame size of initialization.
+	width  int
+	height int
+	// deleted is true when the track is removed from the state.
+	deleted bool
+}
+
+// discard deletes the tracker of the object. The track is required to be
+// locked.
+func (o *objectTrack) discard() {
+	if o.t != nil {
+		o.t.Delete()
+		o.t = nil
+	}
+}
+
+// Terminate deletes all trackers.
+func (t *tracker) Terminate(ctx *core.Context) error {
+	t.m.Lock()
+	defer t.m.Unlock()
+	for k, o := range t.tracks {
+		o.m.Lock()
+		o.discard()
+		o.deleted = true
+		o.m.Unlock()
+		delete(t.tracks, k)
+		t.keys.forget(k)
+	}
+	return nil
+}
+
+func lookupTracker(ctx *core.Context, name string) (*tracker, error) {
+	st, err := ctx.SharedStates.Get(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if s, ok := st.(*tracker); ok {
+		return s, nil
+	}
+	return nil, fmt.Errorf("state '%v' cannot be converted to tracker.state",
+		name)
+}
+
+// track returns the objectTrack of the key, which is locked. Objects of idle
+// keys are discarded.
+func (t *tracker) track(key string) *objectTrack {
+	for {
+		t.m.Lock()
+		o, ok := t.tracks[key]
+		if !ok {
+			o = &objectTrack{}
+			t.tracks[key] = o
+		}
+		var idle []*objectTrack
+		for _, k := range t.keys.touch(key) {
+			idle = append(idle, t.tracks[k])
+			delete(t.tracks, k)
+		}
+		t.m.Unlock()
+
+		for _, it := range idle {
+			it.m.Lock()
+			it.discard()
+			it.deleted = true
+			it.m.Unlock()
+		}
+		o.m.Lock()
+		if !o.deleted {
+			return o
+		}
+		// The track was deleted while waiting for the lock.
+		o.m.Unlock()
+	}
+}
+
+// trackerKey returns the optional key of UDFs.
+func trackerKey(key []string) (string, error) {
+	switch len(key) {
+	case 0:
+		return "", nil
+	case 1:
+		return key[0], nil
+	default:
+		return "", fmt.Errorf("too many keys: %v", len(key))
+	}
+}
+
+// InitTracker starts tracking the object in the rectangle of the frame. The
+// object tracked by the key until then is discarded.
+//
+// trackerName: tracker state name.
+//
+// img: a frame as RawData map structure.
+//
+// rect: a map which has "x", "y", "width" and "height" of the object, the
+// part outside of the frame is ignored.
+//
+// key: optional key of the object, e.g. a camera ID or an object ID. Objects
+// of different keys are tracked separately. Default is an empty string.
+//
+// Returns the rectangle which is tracked.
+func InitTracker(ctx *core.Context, trackerName string, img data.Map,
+	rect data.Map, key ...string) (data.Map, error) {
+	k, err := trackerKey(key)
+	if err != nil {
+		return nil, err
+	}
+	t, err := lookupTracker(ctx, trackerName)
+	if err != nil {
+		return nil, err
+	}
+	r, err := convertToBridgeRect(rect)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := ConvertMapToRawData(img)
+	if err != nil {
+		return nil, err
+	}
+	r = clampRect(r, raw.Width, raw.Height)
+	if r.Width == 0 || r.Height == 0 {
+		return nil, fmt.Errorf("rect is out of the frame: %v", rect)
+	}
+	mat, err := defaultMatVec3bPool.get(&raw)
+	if err != nil {
+		return nil, err
+	}
+	defer defaultMatVec3bPool.put(mat)
+
+	bt, err := bridge.NewTracker(t.algorithm)
+	if err != nil {
+		return nil, err
+	}
+	if err := bt.Init(mat, r); err != nil {
+		bt.Delete()
+		return nil, err
+	}
+
+	o := t.track(k)
+	defer o.m.Unlock()
+	if o.t != nil {
+		o.t.Delete()
+	}
+	o.t = &bt
+	o.width, o.height = raw.Width, raw.Height
+	return convertFromBridgeRect(r), nil
+}
+
+// UpdateTracker finds the object of the key in the frame.
+//
+// trackerName: tracker state name.
+//
+// img: a frame as RawData map structure, which is required to have the same
+// size as the frame of InitTracker.
+//
+// key: optional key of the object. Default is an empty string.
+//
+// Returns a map which has "rect" and "success". "success" is false when the
+// object is lost or the key is not initialized by InitTracker, "rect" is null
+// in that case. The tracker of a lost object is deleted, so the object is
+// required to be initialized again.
+func UpdateTracker(ctx *core.Context, trackerName string, img data.Map,
+	key ...string) (data.Map, error) {
+	k, err := trackerKey(key)
+	if err != nil {
+		return nil, err
+	}
+	t, err := lookupTracker(ctx, trackerName)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := ConvertMapToRawData(img)
+	if err != nil {
+		return nil, err
+	}
+
+	lost := data.Map{
+		"rect":    data.Null{},
+		"success": data.False,
+	}
+	o := t.track(k)
+	defer o.m.Unlock()
+	if o.t == nil {
+		return lost, nil
+	}
+	if raw.Width != o.width || raw.Height != o.height {
+		return nil, fmt.Errorf("frame size %vx%v differs from %vx%v of init",
+			raw.Width, raw.Height, o.width, o.height)
+	}
+	mat, err := defaultMatVec3bPool.get(&raw)
+	if err != nil {
+		return nil, err
+	}
+	defer defaultMatVec3bPool.put(mat)
+
+	r, ok, err := o.t.Update(mat)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		o.discard()
+		return lost, nil
+	}
+	return data.Map{
+		"rect":    convertFromBridgeRect(r),
+		"success": data.True,
+	}, nil
+}
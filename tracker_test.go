@@ -0,0 +1,137 @@
+//go:build cgo
+// +build cgo
+
+package opencv
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/opencv.v0/bridge"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"strings"
+	"testing"
+)
+
+func TestNewTracker(t *testing.T) {
+	Convey("Given a SensorBee's core.Context", t, func() {
+		ctx := &core.Context{}
+		Convey("When create state with an unsupported algorithm", func() {
+			_, err := NewTracker(ctx, data.Map{
+				"algorithm": data.String("median_flow"),
+			})
+			Convey("Then it should return an error", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+		if len(bridge.AvailableTrackers()) > 0 {
+			Convey("When create state without parameters", func() {
+				st, err := NewTracker(ctx, data.Map{})
+				Convey("Then it should use the first available algorithm", func() {
+					So(err, ShouldBeNil)
+					So(st.(*tracker).algorithm, ShouldEqual,
+						bridge.AvailableTrackers()[0])
+				})
+			})
+			Convey("When create state with zero max_age", func() {
+				_, err := NewTracker(ctx, data.Map{"max_age": data.Int(0)})
+				Convey("Then it should return an error", func() {
+					So(err, ShouldNotBeNil)
+				})
+			})
+		}
+	})
+}
+
+func TestTracker(t *testing.T) {
+	available := bridge.AvailableTrackers()
+	if len(available) == 0 {
+		t.Skip("no tracker is available in the linked OpenCV")
+	}
+	Convey("Given a tracker state", t, func() {
+		ctx := core.NewContext(nil)
+		st, err := NewTracker(ctx, data.Map{
+			"algorithm": data.String(strings.ToLower(available[0])),
+		})
+		So(err, ShouldBeNil)
+		So(ctx.SharedStates.Add("tracker", "opencv_tracker", st), ShouldBeNil)
+		Reset(func() {
+			st.Terminate(ctx)
+		})
+		frame := squareCVMAT(64, 64, 24, 24, 16)
+
+		Convey("When update before init", func() {
+			ret, err := UpdateTracker(ctx, "tracker", frame)
+			Convey("Then it should not succeed", func() {
+				So(err, ShouldBeNil)
+				So(ret["success"], ShouldEqual, data.False)
+				So(ret["rect"], ShouldEqual, data.Null{})
+			})
+		})
+		Convey("When init with a rect out of the frame", func() {
+			_, err := InitTracker(ctx, "tracker", frame, data.Map{
+				"x": data.Int(100), "y": data.Int(100),
+				"width": data.Int(10), "height": data.Int(10),
+			})
+			Convey("Then it should return an error", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+		Convey("When init with the square and update with the same frame", func() {
+			r, err := InitTracker(ctx, "tracker", frame, data.Map{
+				"x": data.Int(20), "y": data.Int(20),
+				"width": data.Int(24), "height": data.Int(24),
+			}, "obj1")
+			So(err, ShouldBeNil)
+			So(r["width"], ShouldEqual, data.Int(24))
+			ret, err := UpdateTracker(ctx, "tracker", frame, "obj1")
+			Convey("Then it should track the square", func() {
+				So(err, ShouldBeNil)
+				So(ret["success"], ShouldEqual, data.True)
+				rect, err := convertToBridgeRect(ret["rect"])
+				So(err, ShouldBeNil)
+				So(rectIoU(rect, bridge.Rect{X: 20, Y: 20, Width: 24, Height: 24}),
+					ShouldBeGreaterThan, 0.5)
+			})
+			Convey("Then other keys should not be initialized", func() {
+				ret, err := UpdateTracker(ctx, "tracker", frame)
+				So(err, ShouldBeNil)
+				So(ret["success"], ShouldEqual, data.False)
+			})
+		})
+		Convey("When a key is not given for more than max_age frames", func() {
+			st, err := NewTracker(ctx, data.Map{"max_age": data.Int(1)})
+			So(err, ShouldBeNil)
+			So(ctx.SharedStates.Add("tracker_idle", "opencv_tracker", st),
+				ShouldBeNil)
+			Reset(func() {
+				st.Terminate(ctx)
+			})
+			_, err = InitTracker(ctx, "tracker_idle", frame, data.Map{
+				"x": data.Int(20), "y": data.Int(20),
+				"width": data.Int(24), "height": data.Int(24),
+			}, "obj1")
+			So(err, ShouldBeNil)
+			_, err = UpdateTracker(ctx, "tracker_idle", frame, "obj2")
+			So(err, ShouldBeNil)
+			_, err = UpdateTracker(ctx, "tracker_idle", frame, "obj2")
+			So(err, ShouldBeNil)
+			Convey("Then the object of the key should be discarded", func() {
+				So(st.(*tracker).tracks, ShouldNotContainKey, "obj1")
+				ret, err := UpdateTracker(ctx, "tracker_idle", frame, "obj1")
+				So(err, ShouldBeNil)
+				So(ret["success"], ShouldEqual, data.False)
+			})
+		})
+		Convey("When update with a frame of another size", func() {
+			_, err := InitTracker(ctx, "tracker", frame, data.Map{
+				"x": data.Int(20), "y": data.Int(20),
+				"width": data.Int(24), "height": data.Int(24),
+			})
+			So(err, ShouldBeNil)
+			_, err = UpdateTracker(ctx, "tracker", squareCVMAT(32, 32, 8, 8, 8))
+			Convey("Then it should return an error", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
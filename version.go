@@ -0,0 +1,56 @@
+//go:build cgo
+// +build cgo
+
+package opencv
+
+import (
+	"gopkg.in/sensorbee/opencv.v0/bridge"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"strconv"
+	"strings"
+)
+
+// Version returns the version of OpenCV linked to the plug-in, it is used to
+// verify deployments.
+//
+// Output
+//
+// version: The version string, e.g. "3.4.1" or "4.5.4-dev".
+//
+// major: The major version.
+//
+// minor: The minor version.
+//
+// revision: The revision.
+//
+// build_information: The output of `cv::getBuildInformation`, which includes
+// enabled modules and video I/O backends.
+func Version(ctx *core.Context) (data.Map, error) {
+	v := bridge.Version()
+	major, minor, revision := parseVersion(v)
+	return data.Map{
+		"version":           data.String(v),
+		"major":             data.Int(major),
+		"minor":             data.Int(minor),
+		"revision":          data.Int(revision),
+		"build_information": data.String(bridge.BuildInformation()),
+	}, nil
+}
+
+// parseVersion parses a version string such as "4.5.4-dev". Missing or
+// malformed numbers are 0.
+func parseVersion(v string) (major, minor, revision int) {
+	if i := strings.IndexAny(v, "-+ "); i >= 0 {
+		v = v[:i]
+	}
+	nums := [3]int{}
+	for i, s := range strings.SplitN(v, ".", 3) {
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			break
+		}
+		nums[i] = n
+	}
+	return nums[0], nums[1], nums[2]
+}
@@ -0,0 +1,55 @@
+//go:build cgo
+// +build cgo
+
+package opencv
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"testing"
+)
+
+func TestParseVersion(t *testing.T) {
+	Convey("Given version strings", t, func() {
+		cases := []struct {
+			version  string
+			expected [3]int
+		}{
+			{"3.4.1", [3]int{3, 4, 1}},
+			{"4.5.4-dev", [3]int{4, 5, 4}},
+			{"4.0", [3]int{4, 0, 0}},
+			{"unknown", [3]int{0, 0, 0}},
+		}
+		for _, c := range cases {
+			c := c
+			Convey("When parse "+c.version, func() {
+				major, minor, revision := parseVersion(c.version)
+				Convey("Then it should return each number", func() {
+					So([3]int{major, minor, revision}, ShouldResemble, c.expected)
+				})
+			})
+		}
+	})
+}
+
+func TestVersion(t *testing.T) {
+	Convey("Given a SensorBee's core.Context", t, func() {
+		ctx := &core.Context{}
+		Convey("When get the linked OpenCV version", func() {
+			ret, err := Version(ctx)
+			So(err, ShouldBeNil)
+			Convey("Then it should have the version and build information", func() {
+				v, err := data.AsString(ret["version"])
+				So(err, ShouldBeNil)
+				So(v, ShouldNotBeEmpty)
+				major, err := data.AsInt(ret["major"])
+				So(err, ShouldBeNil)
+				So(major, ShouldBeGreaterThanOrEqualTo, 3)
+				info, err := data.AsString(ret["build_information"])
+				So(err, ShouldBeNil)
+				So(info, ShouldContainSubstring, "Video I/O")
+			})
+		})
+	})
+}